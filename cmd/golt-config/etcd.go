@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/driver/etcd"
+	_ "github.com/welllog/golt/config/driver/file"
+	"github.com/welllog/golt/config/meta"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// localNamespace is the namespace of the local file served by the file driver.
+const localNamespace = "local"
+
+// newEtcdClient connects to the etcd endpoints, the returned func closes the client.
+var newEtcdClient = func(endpoints []string) (*clientv3.Client, func(), error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return cli, func() { _ = cli.Close() }, nil
+}
+
+// change is a difference of a key between the local file and the etcd prefix:
+// created is only in the local file, deleted is only in etcd.
+type change struct {
+	key    string
+	typ    driver.EventType
+	local  []byte
+	remote []byte
+	// revision is the mod revision of the etcd key, 0 if the key is not in etcd.
+	revision int64
+}
+
+// etcdFlags is the flags shared by diff and push.
+type etcdFlags struct {
+	file      *string
+	endpoints *string
+	prefix    *string
+	timeout   *time.Duration
+}
+
+func addEtcdFlags(fs *flag.FlagSet) etcdFlags {
+	return etcdFlags{
+		file:      fs.String("f", "", "the local config file, the format is decided by the extension"),
+		endpoints: fs.String("endpoints", "127.0.0.1:2379", "the etcd endpoints separated by comma"),
+		prefix:    fs.String("prefix", "", "the etcd key prefix, LIKE: /v1/test/demo4/"),
+		timeout:   fs.Duration("timeout", 10*time.Second, "the timeout of the etcd operations"),
+	}
+}
+
+func (f etcdFlags) check() error {
+	if *f.file == "" {
+		return errors.New("-f is required")
+	}
+	if *f.prefix == "" {
+		return errors.New("-prefix is required")
+	}
+	return nil
+}
+
+func diffCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("diff", "", stderr)
+	flags := addEtcdFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := flags.check(); err != nil {
+		fs.Usage()
+		return err
+	}
+
+	cli, closeClient, err := newEtcdClient(strings.Split(*flags.endpoints, ","))
+	if err != nil {
+		return fmt.Errorf("connect etcd failed: %w", err)
+	}
+	defer closeClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *flags.timeout)
+	defer cancel()
+
+	changes, err := compare(ctx, cli, flags)
+	if err != nil {
+		return err
+	}
+
+	printChanges(stdout, changes)
+	if len(changes) > 0 {
+		return errDiffFound
+	}
+	return nil
+}
+
+func pushCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("push", "", stderr)
+	flags := addEtcdFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "print the keys to write without writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := flags.check(); err != nil {
+		fs.Usage()
+		return err
+	}
+
+	cli, closeClient, err := newEtcdClient(strings.Split(*flags.endpoints, ","))
+	if err != nil {
+		return fmt.Errorf("connect etcd failed: %w", err)
+	}
+	defer closeClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *flags.timeout)
+	defer cancel()
+
+	changes, err := compare(ctx, cli, flags)
+	if err != nil {
+		return err
+	}
+
+	// the keys only in etcd are kept, push never deletes
+	writes := changes[:0]
+	for _, ch := range changes {
+		if ch.typ != driver.EventDeleted {
+			writes = append(writes, ch)
+		}
+	}
+
+	if len(writes) == 0 {
+		fmt.Fprintln(stdout, "nothing to push")
+		return nil
+	}
+
+	printChanges(stdout, writes)
+	if *dryRun {
+		fmt.Fprintf(stdout, "dry run, %d keys not written\n", len(writes))
+		return nil
+	}
+
+	// every written key must be unchanged since compared, otherwise nothing is written
+	cmps := make([]clientv3.Cmp, 0, len(writes))
+	ops := make([]clientv3.Op, 0, len(writes))
+	for _, ch := range writes {
+		key := *flags.prefix + ch.key
+		if ch.typ == driver.EventCreated {
+			cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(key), "=", 0))
+		} else {
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key), "=", ch.revision))
+		}
+		ops = append(ops, clientv3.OpPut(key, string(ch.local)))
+	}
+
+	rsp, err := cli.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+
+	if !rsp.Succeeded {
+		return errors.New("the etcd keys changed during push, nothing is written, please retry")
+	}
+
+	fmt.Fprintf(stdout, "pushed %d keys at revision %d\n", len(writes), rsp.Header.GetRevision())
+	return nil
+}
+
+// compare reads the local file by the file driver and the etcd prefix by the etcd driver,
+// and returns the differences ordered by key.
+func compare(ctx context.Context, cli *clientv3.Client, flags etcdFlags) ([]change, error) {
+	local, err := localEntries(ctx, *flags.file)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := etcdEntries(ctx, cli, *flags.endpoints, *flags.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffEntries(local, remote), nil
+}
+
+func localEntries(ctx context.Context, file string) ([]driver.Entry, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := driver.New(meta.Config{
+		Source:  "file://" + filepath.Dir(path),
+		Configs: []meta.Rule{{Namespace: localNamespace, Path: filepath.Base(path)}},
+	}, newLogger())
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	return driver.Entries(ctx, d, localNamespace)
+}
+
+func etcdEntries(ctx context.Context, cli *clientv3.Client, endpoints, prefix string) ([]driver.Entry, error) {
+	d, err := etcd.NewAdvanced(meta.Config{
+		Source:  "etcd://" + endpoints,
+		Configs: []meta.Rule{{Namespace: localNamespace, Path: prefix}},
+	}, newLogger(), etcd.WithCustomEtcdClient(cli))
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	entries, err := driver.Entries(ctx, d, localNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("read etcd prefix %s failed: %w", prefix, err)
+	}
+	return entries, nil
+}
+
+// diffEntries returns the differences of the entries ordered by key, both entries are ordered by key.
+func diffEntries(local, remote []driver.Entry) []change {
+	var changes []change
+	i, j := 0, 0
+	for i < len(local) || j < len(remote) {
+		switch {
+		case j == len(remote) || (i < len(local) && local[i].Key < remote[j].Key):
+			changes = append(changes, change{key: local[i].Key, typ: driver.EventCreated, local: local[i].Value})
+			i++
+		case i == len(local) || remote[j].Key < local[i].Key:
+			changes = append(changes, change{
+				key: remote[j].Key, typ: driver.EventDeleted, remote: remote[j].Value, revision: remote[j].Revision,
+			})
+			j++
+		default:
+			if string(local[i].Value) != string(remote[j].Value) {
+				changes = append(changes, change{
+					key: local[i].Key, typ: driver.EventUpdated, local: local[i].Value, remote: remote[j].Value,
+					revision: remote[j].Revision,
+				})
+			}
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+// printChanges prints the changes from etcd to the local file, one line per key:
+// "+" is only in the local file, "-" is only in etcd, "~" is changed from the etcd value to the local value.
+func printChanges(w io.Writer, changes []change) {
+	for _, ch := range changes {
+		switch ch.typ {
+		case driver.EventCreated:
+			fmt.Fprintf(w, "+ %s: %s\n", ch.key, strconv.Quote(string(ch.local)))
+		case driver.EventDeleted:
+			fmt.Fprintf(w, "- %s: %s\n", ch.key, strconv.Quote(string(ch.remote)))
+		default:
+			fmt.Fprintf(w, "~ %s: %s => %s\n", ch.key, strconv.Quote(string(ch.remote)), strconv.Quote(string(ch.local)))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Command golt-config validates, reads, dumps the config described by a meta config file,
+// and diffs or pushes a local config file against an etcd prefix.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/welllog/golt/contract"
+	"github.com/welllog/olog"
+)
+
+const (
+	exitOK = 0
+	// exitDiff is returned by diff when the local file and the etcd prefix are different, like diff(1).
+	exitDiff  = 1
+	exitError = 2
+)
+
+const usage = `Usage: golt-config <command> [flags] [args]
+
+Commands:
+  validate  load the meta config file, check every source loads
+  get       read a value: get [flags] <namespace> <key>
+  dump      dump the effective config of all namespaces as a snapshot
+  diff      compare a local config file against an etcd prefix
+  push      write the top-level keys of a local config file into an etcd prefix in one transaction
+
+Run 'golt-config <command> -h' for the flags of the command.
+`
+
+// errDiffFound reports the differences found by diff, it is not printed as an error.
+var errDiffFound = errors.New("differences found")
+
+type command func(args []string, stdout, stderr io.Writer) error
+
+var commands = map[string]command{
+	"validate": validateCmd,
+	"get":      getCmd,
+	"dump":     dumpCmd,
+	"diff":     diffCmd,
+	"push":     pushCmd,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "golt-config: unknown command %s\n\n%s", args[0], usage)
+		return exitError
+	}
+
+	err := cmd(args[1:], stdout, stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errDiffFound):
+		return exitDiff
+	default:
+		fmt.Fprintf(stderr, "golt-config %s: %s\n", args[0], err.Error())
+		return exitError
+	}
+}
+
+// newFlagSet returns the flag set of the command, the usage and parse errors are written to stderr.
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: golt-config %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func newLogger() contract.Logger {
+	logger := olog.DynamicLogger{
+		Caller: olog.Disable,
+	}
+	logger.SetAppName("golt-config")
+	return logger
+}
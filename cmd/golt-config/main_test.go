@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/welllog/golib/testz"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeKV serves the prefix get and the transaction of push.
+type fakeKV struct {
+	clientv3.KV
+	kvs      map[string]*mvccpb.KeyValue
+	revision int64
+	// conflict makes the transaction fail like the compared keys are changed.
+	conflict bool
+}
+
+func (f *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	var op clientv3.Op
+	for _, opt := range opts {
+		opt(&op)
+	}
+
+	var ret clientv3.GetResponse
+	for k, kv := range f.kvs {
+		if k == key || (len(op.RangeBytes()) > 0 && strings.HasPrefix(k, key)) {
+			cp := *kv
+			ret.Kvs = append(ret.Kvs, &cp)
+		}
+	}
+	slices.SortFunc(ret.Kvs, func(a, b *mvccpb.KeyValue) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
+	return &ret, nil
+}
+
+func (f *fakeKV) Txn(ctx context.Context) clientv3.Txn {
+	return &fakeTxn{kv: f}
+}
+
+func (f *fakeKV) put(key, value string) {
+	f.revision++
+	f.kvs[key] = &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: f.revision}
+}
+
+type fakeTxn struct {
+	kv   *fakeKV
+	cmps []clientv3.Cmp
+	ops  []clientv3.Op
+}
+
+func (t *fakeTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *fakeTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.ops = append(t.ops, ops...)
+	return t
+}
+
+func (t *fakeTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	return t
+}
+
+func (t *fakeTxn) Commit() (*clientv3.TxnResponse, error) {
+	if t.kv.conflict || len(t.cmps) != len(t.ops) {
+		return &clientv3.TxnResponse{Header: &etcdserverpb.ResponseHeader{Revision: t.kv.revision}}, nil
+	}
+
+	for _, op := range t.ops {
+		t.kv.put(string(op.KeyBytes()), string(op.ValueBytes()))
+	}
+	return &clientv3.TxnResponse{
+		Succeeded: true,
+		Header:    &etcdserverpb.ResponseHeader{Revision: t.kv.revision},
+	}, nil
+}
+
+func useFakeEtcd(t *testing.T, kv *fakeKV) {
+	old := newEtcdClient
+	newEtcdClient = func([]string) (*clientv3.Client, func(), error) {
+		return &clientv3.Client{KV: kv}, func() {}, nil
+	}
+	t.Cleanup(func() {
+		newEtcdClient = old
+	})
+}
+
+func TestRun_Meta(t *testing.T) {
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: demo\nretry: 3\n"), 0666))
+	metaFile := filepath.Join(dir, "config.yaml")
+	testz.Nil(t, os.WriteFile(metaFile, []byte(`
+- source: file://`+dir+`
+  configs:
+    - namespace: app
+      path: app.yaml
+`), 0666))
+
+	var stdout, stderr bytes.Buffer
+	testz.Equal(t, exitOK, run([]string{"validate", "-c", metaFile}, &stdout, &stderr))
+	testz.Equal(t, "ok\tapp\t2 keys\n", stdout.String())
+
+	stdout.Reset()
+	testz.Equal(t, exitOK, run([]string{"get", "-c", metaFile, "app", "name"}, &stdout, &stderr))
+	testz.Equal(t, "demo\n", stdout.String())
+
+	stdout.Reset()
+	testz.Equal(t, exitError, run([]string{"get", "-c", metaFile, "app", "none"}, &stdout, &stderr))
+
+	stdout.Reset()
+	testz.Equal(t, exitOK, run([]string{"dump", "-c", metaFile}, &stdout, &stderr))
+	testz.Equal(t, true, strings.Contains(stdout.String(), `"value": "demo"`))
+
+	stderr.Reset()
+	testz.Equal(t, exitError, run([]string{"validate", "-c", filepath.Join(dir, "none.yaml")}, &stdout, &stderr))
+	testz.Equal(t, true, stderr.Len() > 0)
+}
+
+func TestRun_DiffAndPush(t *testing.T) {
+	kv := &fakeKV{kvs: make(map[string]*mvccpb.KeyValue)}
+	kv.put("/v1/app/name", "old")
+	kv.put("/v1/app/retry", "3")
+	kv.put("/v1/app/legacy", "yes")
+	useFakeEtcd(t, kv)
+
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("name: demo\nretry: 3\ntimeout: 5s\n"), 0666))
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-f", file, "-prefix", "/v1/app/"}
+	testz.Equal(t, exitDiff, run(append([]string{"diff"}, args...), &stdout, &stderr))
+	testz.Equal(t, "- legacy: \"yes\"\n~ name: \"old\" => \"demo\"\n+ timeout: \"5s\"\n", stdout.String())
+
+	stdout.Reset()
+	testz.Equal(t, exitOK, run(append([]string{"push", "-dry-run"}, args...), &stdout, &stderr))
+	testz.Equal(t, "~ name: \"old\" => \"demo\"\n+ timeout: \"5s\"\ndry run, 2 keys not written\n", stdout.String())
+	testz.Equal(t, "old", string(kv.kvs["/v1/app/name"].Value))
+
+	kv.conflict = true
+	testz.Equal(t, exitError, run(append([]string{"push"}, args...), &stdout, &stderr))
+	testz.Equal(t, "old", string(kv.kvs["/v1/app/name"].Value))
+
+	kv.conflict = false
+	stdout.Reset()
+	testz.Equal(t, exitOK, run(append([]string{"push"}, args...), &stdout, &stderr))
+	testz.Equal(t, true, strings.HasSuffix(stdout.String(), "pushed 2 keys at revision 5\n"))
+	testz.Equal(t, "demo", string(kv.kvs["/v1/app/name"].Value))
+	testz.Equal(t, "5s", string(kv.kvs["/v1/app/timeout"].Value))
+	// push never deletes
+	testz.Equal(t, "yes", string(kv.kvs["/v1/app/legacy"].Value))
+
+	stdout.Reset()
+	testz.Equal(t, exitDiff, run(append([]string{"diff"}, args...), &stdout, &stderr))
+	testz.Equal(t, "- legacy: \"yes\"\n", stdout.String())
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/welllog/golt/config"
+)
+
+func validateCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", "", stderr)
+	metaFile := fs.String("c", "config.yaml", "the meta config file, the format is decided by the extension")
+	timeout := fs.Duration("timeout", 10*time.Second, "the timeout of reading the sources")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// the etcd sources are preloaded, so that the unreachable etcd fails the validation
+	c, err := config.FromFile(*metaFile, config.WithEtcdPreload())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// the snapshot reads every layer of every namespace
+	s, err := c.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, ns := range sortedKeys(s.Namespaces) {
+		fmt.Fprintf(stdout, "ok\t%s\t%d keys\n", ns, len(s.Namespaces[ns]))
+	}
+	// the layers can not be listed are only read by key, they are not validated
+	for _, ns := range sortedKeys(s.Unsupported) {
+		for _, source := range s.Unsupported[ns] {
+			fmt.Fprintf(stdout, "skip\t%s\t%s can not be listed\n", ns, source)
+		}
+	}
+	return nil
+}
+
+func getCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("get", "<namespace> <key>", stderr)
+	metaFile := fs.String("c", "config.yaml", "the meta config file, the format is decided by the extension")
+	timeout := fs.Duration("timeout", 10*time.Second, "the timeout of reading the value")
+	interpolate := fs.Bool("interpolate", false, "expand the ${ENV} and ${namespace:key} references in the value")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("namespace and key are required")
+	}
+
+	var options []config.Option
+	if *interpolate {
+		options = append(options, config.WithInterpolation())
+	}
+
+	c, err := config.FromFile(*metaFile, options...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	namespace, key := fs.Arg(0), fs.Arg(1)
+	value, err := c.String(ctx, namespace, key)
+	if err != nil {
+		return fmt.Errorf("get %s %s failed: %w", namespace, key, err)
+	}
+
+	fmt.Fprintln(stdout, value)
+	return nil
+}
+
+func dumpCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("dump", "", stderr)
+	metaFile := fs.String("c", "config.yaml", "the meta config file, the format is decided by the extension")
+	timeout := fs.Duration("timeout", 10*time.Second, "the timeout of reading the sources")
+	redact := fs.Bool("redact", false, "remove the values of the encrypted secrets")
+	output := fs.String("o", "", "write the snapshot to the file instead of stdout, it can be booted by config.Restore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := config.FromFile(*metaFile)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var options []config.SnapshotOption
+	if *redact {
+		options = append(options, config.RedactSecrets())
+	}
+
+	s, err := c.Snapshot(ctx, options...)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		return s.WriteFile(*output)
+	}
+	return s.Write(stdout)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+	"gopkg.in/yaml.v3"
+)
+
+// ValueError is returned when the value of the key can not be converted to the type.
+type ValueError struct {
+	Namespace string
+	Key       string
+	// Raw is the raw value of the key.
+	Raw string
+	// Type is the target type.
+	Type string
+	Err  error
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("config %s:%s invalid %s value %q: %s", e.Namespace, e.Key, e.Type, e.Raw, e.Err.Error())
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+func valueError(namespace, key, raw, typ string, err error) error {
+	return &ValueError{Namespace: namespace, Key: key, Raw: raw, Type: typ, Err: err}
+}
+
+// DefaultTimeLayouts are the layouts used by Configure.Time when no layout is specified.
+var DefaultTimeLayouts = []string{time.RFC3339Nano, time.DateTime, time.DateOnly}
+
+// Duration parses the value as time.Duration, LIKE: 1m30s, 500ms
+func (c *Configure) Duration(ctx context.Context, namespace, key string) (time.Duration, error) {
+	s, err := c.String(ctx, namespace, key)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, valueError(namespace, key, s, "duration", err)
+	}
+	return d, nil
+}
+
+// Time parses the value as time.Time by the layouts in order, DefaultTimeLayouts is used if layouts is empty.
+func (c *Configure) Time(ctx context.Context, namespace, key string, layouts ...string) (time.Time, error) {
+	s, err := c.String(ctx, namespace, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(layouts) == 0 {
+		layouts = DefaultTimeLayouts
+	}
+
+	for _, layout := range layouts {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, valueError(namespace, key, s, "time", err)
+}
+
+// ByteSize parses the value as the number of bytes, LIKE: 512MiB, 1.5GB, 64k, 1024
+// the units KB, MB, GB, TB, PB are powers of 1000,
+// and the units KiB, MiB, GiB, TiB, PiB and K, M, G, T, P are powers of 1024, the unit is case-insensitive.
+func (c *Configure) ByteSize(ctx context.Context, namespace, key string) (int64, error) {
+	s, err := c.String(ctx, namespace, key)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := parseByteSize(s)
+	if err != nil {
+		return 0, valueError(namespace, key, s, "byte size", err)
+	}
+	return n, nil
+}
+
+// StringSlice parses the value as []string, the value can be a yaml/json array or comma separated string,
+// LIKE: [a, b], ["a", "b"], a,b
+func (c *Configure) StringSlice(ctx context.Context, namespace, key string) ([]string, error) {
+	s, err := c.GetRawString(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	ss, err := parseStringSlice(s)
+	if err != nil {
+		return nil, valueError(namespace, key, s, "string slice", err)
+	}
+	return ss, nil
+}
+
+// StringMap parses the value as map[string]string, the value can be a yaml/json object or comma separated k=v pairs,
+// LIKE: {a: 1, b: 2}, {"a": "1"}, a=1,b=2
+func (c *Configure) StringMap(ctx context.Context, namespace, key string) (map[string]string, error) {
+	s, err := c.GetRawString(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := parseStringMap(s)
+	if err != nil {
+		return nil, valueError(namespace, key, s, "string map", err)
+	}
+	return m, nil
+}
+
+// Get gets the value of the key as T.
+// string, bool, integers, floats, time.Duration, time.Time, []string and map[string]string are parsed like the
+// accessors of Configure, other types are decoded by yaml.
+func Get[T any](ctx context.Context, cfg *Configure, namespace, key string) (T, error) {
+	var v T
+	var ret any
+	var err error
+
+	switch any(v).(type) {
+	case string:
+		ret, err = cfg.String(ctx, namespace, key)
+	case bool:
+		ret, err = cfg.Bool(ctx, namespace, key)
+	case time.Duration:
+		ret, err = cfg.Duration(ctx, namespace, key)
+	case time.Time:
+		ret, err = cfg.Time(ctx, namespace, key)
+	case []string:
+		ret, err = cfg.StringSlice(ctx, namespace, key)
+	case map[string]string:
+		ret, err = cfg.StringMap(ctx, namespace, key)
+	default:
+		rv := reflect.ValueOf(&v).Elem()
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			err = cfg.parseNumber(ctx, namespace, key, rv)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			err = cfg.parseNumber(ctx, namespace, key, rv)
+		case reflect.Float32, reflect.Float64:
+			err = cfg.parseNumber(ctx, namespace, key, rv)
+		default:
+			err = cfg.decodeValue(ctx, namespace, key, rv)
+		}
+		return v, err
+	}
+
+	if err != nil {
+		return v, err
+	}
+	return ret.(T), nil
+}
+
+// GetOrDefault gets the value of the key as T, def is returned if the key not found or the value is invalid.
+func GetOrDefault[T any](ctx context.Context, cfg *Configure, namespace, key string, def T) T {
+	v, err := Get[T](ctx, cfg, namespace, key)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			cfg.logger.Warnf("get %s %s failed, use default value: %s", namespace, key, err.Error())
+		}
+		return def
+	}
+	return v
+}
+
+// parseNumber parses the value into the number rv by its kind and bit size.
+func (c *Configure) parseNumber(ctx context.Context, namespace, key string, rv reflect.Value) error {
+	s, err := c.String(ctx, namespace, key)
+	if err != nil {
+		return err
+	}
+
+	bits := rv.Type().Bits()
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, bits)
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, bits)
+		rv.SetUint(n)
+	default:
+		var f float64
+		f, err = strconv.ParseFloat(s, bits)
+		rv.SetFloat(f)
+	}
+
+	if err != nil {
+		return valueError(namespace, key, s, rv.Type().String(), err)
+	}
+	return nil
+}
+
+// decodeValue decodes the value of the key into rv by yaml, the decoding error is returned as ValueError.
+func (c *Configure) decodeValue(ctx context.Context, namespace, key string, rv reflect.Value) error {
+	b, err := c.UnsafeGetRaw(ctx, namespace, key)
+	if err != nil {
+		return err
+	}
+
+	value := rv.Addr().Interface()
+	if err := driver.MustGetDecoder("yaml")(b, value); err != nil {
+		return valueError(namespace, key, string(b), rv.Type().String(), err)
+	}
+
+	return decryptNested(namespace, key, b, value)
+}
+
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"k":   1 << 10,
+	"m":   1 << 20,
+	"g":   1 << 30,
+	"t":   1 << 40,
+	"p":   1 << 50,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	if i == 0 {
+		return 0, errors.New("missing number")
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, errors.New("unknown unit " + s[i:])
+	}
+
+	// float64(math.MaxInt64) is rounded up to 2^63, which overflows int64
+	size := n * unit
+	if size >= math.MaxInt64 {
+		return 0, errors.New("value out of range")
+	}
+	return int64(size), nil
+}
+
+func parseStringSlice(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	// yaml flow or block sequence, json array is compatible
+	if s[0] == '[' || strings.HasPrefix(s, "- ") {
+		var ss []string
+		if err := yaml.Unmarshal([]byte(s), &ss); err != nil {
+			return nil, err
+		}
+		return ss, nil
+	}
+
+	s = unquote(s)
+	parts := strings.Split(s, ",")
+	ss := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			ss = append(ss, p)
+		}
+	}
+	return ss, nil
+}
+
+func parseStringMap(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return map[string]string{}, nil
+	}
+
+	if isYAMLMap(s) {
+		m := map[string]string{}
+		if err := driver.MustGetDecoder("yaml")([]byte(s), &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	s = unquote(s)
+	m := make(map[string]string)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid pair %q, expect k=v", p)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m, nil
+}
+
+// isYAMLMap reports whether s is a yaml flow mapping or a block mapping, json object is compatible,
+// the colon after the = is part of the k=v value, LIKE: addr=127.0.0.1:6379.
+func isYAMLMap(s string) bool {
+	if s[0] == '{' {
+		return true
+	}
+
+	line, _, _ := strings.Cut(s, "\n")
+	i := strings.IndexByte(line, ':')
+	return i > 0 && !strings.Contains(line[:i], "=")
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/driver/etcd"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestConfigure_Accessors(t *testing.T) {
+	tkv := testKV{}
+	ctx := context.Background()
+	tkv.Put(ctx, "/v1/acc/timeout", "1m30s")
+	tkv.Put(ctx, "/v1/acc/hosts", `["a", "b"]`)
+	tkv.Put(ctx, "/v1/acc/labels", "env=prod, zone=cn")
+	tkv.Put(ctx, "/v1/acc/redis", "addr=127.0.0.1:6379,db=1,url=http://x")
+	tkv.Put(ctx, "/v1/acc/tags", "env: prod\nzone: cn\n")
+	driver.RegisterDriver("etcd", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return etcd.NewAdvanced(config, logger, etcd.WithCustomEtcdClient(&clientv3.Client{KV: &tkv, Watcher: &testWatcher{}}))
+	})
+
+	dir := t.TempDir()
+	content := `timeout: 500ms
+bad_timeout: 5 minutes
+started: 2024-01-02T03:04:05Z
+day: "2024-01-02"
+cache: 512MiB
+disk: 1.5GB
+huge: 8EiB
+hosts: a, b ,c
+ports:
+  - 80
+  - 443
+labels: {env: dev, zone: us}
+retry: 3
+ratio: 0.5
+`
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte(content), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{Source: "file://" + dir, Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml"}}},
+		{Source: "etcd://127.0.0.1:2379", Configs: []meta.Rule{{Namespace: "remote", Path: "/v1/acc/"}}},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	d, err := engine.Duration(ctx, "app", "timeout")
+	testz.Nil(t, err)
+	testz.Equal(t, 500*time.Millisecond, d)
+
+	d, err = engine.Duration(ctx, "remote", "timeout")
+	testz.Nil(t, err)
+	testz.Equal(t, 90*time.Second, d)
+
+	_, err = engine.Duration(ctx, "app", "bad_timeout")
+	var ve *ValueError
+	testz.Equal(t, true, errors.As(err, &ve))
+	testz.Equal(t, "app", ve.Namespace)
+	testz.Equal(t, "bad_timeout", ve.Key)
+	testz.Equal(t, "5 minutes", ve.Raw)
+
+	tm, err := engine.Time(ctx, "app", "started")
+	testz.Nil(t, err)
+	testz.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), tm)
+
+	tm, err = engine.Time(ctx, "app", "day")
+	testz.Nil(t, err)
+	testz.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), tm)
+
+	size, err := engine.ByteSize(ctx, "app", "cache")
+	testz.Nil(t, err)
+	testz.Equal(t, int64(512<<20), size)
+
+	size, err = engine.ByteSize(ctx, "app", "disk")
+	testz.Nil(t, err)
+	testz.Equal(t, int64(1500000000), size)
+
+	_, err = engine.ByteSize(ctx, "app", "hosts")
+	testz.Equal(t, true, errors.As(err, &ve))
+
+	// 8EiB is 2^63, which overflows int64
+	_, err = engine.ByteSize(ctx, "app", "huge")
+	testz.Equal(t, true, errors.As(err, &ve))
+
+	ss, err := engine.StringSlice(ctx, "app", "hosts")
+	testz.Nil(t, err)
+	testz.Equal(t, []string{"a", "b", "c"}, ss)
+
+	ss, err = engine.StringSlice(ctx, "app", "ports")
+	testz.Nil(t, err)
+	testz.Equal(t, []string{"80", "443"}, ss)
+
+	ss, err = engine.StringSlice(ctx, "remote", "hosts")
+	testz.Nil(t, err)
+	testz.Equal(t, []string{"a", "b"}, ss)
+
+	m, err := engine.StringMap(ctx, "app", "labels")
+	testz.Nil(t, err)
+	testz.Equal(t, map[string]string{"env": "dev", "zone": "us"}, m)
+
+	m, err = engine.StringMap(ctx, "remote", "labels")
+	testz.Nil(t, err)
+	testz.Equal(t, map[string]string{"env": "prod", "zone": "cn"}, m)
+
+	// the colon after the = is part of the value
+	m, err = engine.StringMap(ctx, "remote", "redis")
+	testz.Nil(t, err)
+	testz.Equal(t, map[string]string{"addr": "127.0.0.1:6379", "db": "1", "url": "http://x"}, m)
+
+	m, err = engine.StringMap(ctx, "remote", "tags")
+	testz.Nil(t, err)
+	testz.Equal(t, map[string]string{"env": "prod", "zone": "cn"}, m)
+
+	retry, err := Get[uint8](ctx, engine, "app", "retry")
+	testz.Nil(t, err)
+	testz.Equal(t, uint8(3), retry)
+
+	ratio, err := Get[float32](ctx, engine, "app", "ratio")
+	testz.Nil(t, err)
+	testz.Equal(t, float32(0.5), ratio)
+
+	d, err = Get[time.Duration](ctx, engine, "remote", "timeout")
+	testz.Nil(t, err)
+	testz.Equal(t, 90*time.Second, d)
+
+	ports, err := Get[[]int](ctx, engine, "app", "ports")
+	testz.Nil(t, err)
+	testz.Equal(t, []int{80, 443}, ports)
+
+	_, err = Get[int8](ctx, engine, "app", "cache")
+	testz.Equal(t, true, errors.As(err, &ve))
+
+	_, err = Get[[]int](ctx, engine, "app", "labels")
+	testz.Equal(t, true, errors.As(err, &ve))
+	testz.Equal(t, "[]int", ve.Type)
+	testz.Equal(t, "{env: dev, zone: us}", ve.Raw)
+
+	_, err = Get[[]int](ctx, engine, "app", "none")
+	testz.Equal(t, ErrNotFound, err)
+
+	testz.Equal(t, 10, GetOrDefault(ctx, engine, "app", "none", 10))
+	testz.Equal(t, 3, GetOrDefault(ctx, engine, "app", "retry", 10))
+	testz.Equal(t, time.Second, GetOrDefault(ctx, engine, "app", "bad_timeout", time.Second))
+}
@@ -8,6 +8,8 @@ import (
 	"unsafe"
 )
 
+// AtomicStore decodes the value of the key and stores it to the pointer that dst points to atomically,
+// dst must be a pointer to a pointer. for new code, Watch provides a type safe watched value.
 func AtomicStore(ctx context.Context, cfg *Configure, namespace, key string, dst any, unmarshalFunc func([]byte, any) error) error {
 	val := reflect.ValueOf(dst)
 	if val.Kind() != reflect.Ptr {
@@ -29,6 +31,7 @@ func AtomicStore(ctx context.Context, cfg *Configure, namespace, key string, dst
 	return nil
 }
 
+// AtomicLoad loads the pointer that src points to atomically, src must be a pointer to a pointer.
 func AtomicLoad(src any) unsafe.Pointer {
 	val := reflect.ValueOf(src)
 	return atomic.LoadPointer((*unsafe.Pointer)(val.UnsafePointer()))
@@ -1,12 +1,17 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/welllog/golib/strz"
 	"github.com/welllog/golt/config/driver"
+	_ "github.com/welllog/golt/config/driver/env"
 	_ "github.com/welllog/golt/config/driver/etcd"
 	_ "github.com/welllog/golt/config/driver/file"
 	"github.com/welllog/golt/config/meta"
@@ -15,46 +20,101 @@ import (
 
 var ErrNotFound = driver.ErrNotFound
 
+// Configure reads config from multiple sources.
+// a namespace can be served by multiple sources, the source declared later has higher priority,
+// when a key is not found in the higher layer, it falls through to the lower layers.
 type Configure struct {
-	ds     map[string]driver.Driver
-	logger contract.Logger
+	// ds is the layers of each namespace, ordered from low priority to high priority.
+	ds      map[string][]layer
+	drivers []driver.Driver
+	logger  contract.Logger
+	// interpolate indicates whether to expand the ${...} references in the values.
+	interpolate bool
+
+	// subs is the subscriptions of each namespace, guarded by subMu.
+	subMu  sync.Mutex
+	subs   map[string]map[*subscriber]struct{}
+	closed bool
+
+	// transactional indicates whether the validators veto the reload, see WithTransactionalReload.
+	transactional bool
+	// preparers and statuses are the prepare hooks and the reload status of each namespace, guarded by prepMu.
+	prepMu    sync.Mutex
+	preparers map[string]*preparer
+	statuses  map[string]ReloadStatus
+
+	// history is the change records of each key, nil if the history is not enabled.
+	history *history
 }
 
-func newConfigure(cfs []meta.Config, logger contract.Logger) (*Configure, error) {
+type layer struct {
+	source string
+	driver driver.Driver
+}
+
+// LayerInfo describes the layer that serves the effective value of a key.
+type LayerInfo struct {
+	// Index is the position of the layer in the namespace, 0 is the lowest priority.
+	Index int
+	// Source is the source of the meta config, LIKE: file://etc/, etcd://127.0.0.1:2379
+	Source string
+}
+
+func newConfigure(cfs []meta.Config, opts configOptions, fs factories) (*Configure, error) {
+	logger := opts.logger
 	cfg := Configure{
-		ds:     make(map[string]driver.Driver, len(cfs)*2),
-		logger: logger,
+		ds:            make(map[string][]layer, len(cfs)*2),
+		drivers:       make([]driver.Driver, 0, len(cfs)),
+		logger:        logger,
+		interpolate:   opts.interpolate,
+		transactional: opts.transactional,
 	}
 
 	for _, c := range cfs {
-		d, err := driver.New(c, logger)
+		d, err := fs.new(c, logger)
 		if err != nil {
 			logger.Errorf("new driver failed: %s %s", c.SourceSchema(), c.SourceAddr())
 			cfg.Close()
 			return nil, err
 		}
+		cfg.drivers = append(cfg.drivers, d)
 
 		for _, v := range d.Namespaces() {
-			_, ok := cfg.ds[v]
-			if ok {
-				d.Close()
-				cfg.Close()
-				logger.Errorf("duplicate namespace: %s on %s %s", v, c.SourceSchema(), c.SourceAddr())
-				return nil, errors.New("duplicate namespace:" + v)
+			if len(cfg.ds[v]) > 0 {
+				logger.Debugf("namespace %s layered on %s", v, c.Source)
 			}
-			cfg.ds[v] = d
+			cfg.ds[v] = append(cfg.ds[v], layer{source: c.Source, driver: d})
+		}
+	}
+
+	if opts.historySize > 0 || len(opts.historySinks) > 0 {
+		size := opts.historySize
+		if size <= 0 {
+			size = defaultHistorySize
+		}
+
+		if err := cfg.watchHistory(size, opts.historySinks, opts.historyHashKey); err != nil {
+			cfg.Close()
+			return nil, err
 		}
 	}
 
 	return &cfg, nil
 }
 
+// OnKeyChange registers a hook that is called when the effective value of the key changes.
+// for a layered namespace, the change of a lower layer is ignored while the key exists in a higher layer,
+// and the key deleted in a higher layer falls back to the value of the lower layer,
+// so false is returned if a layer above the lowest one can change but can not report the deleted keys.
+// the key can be a path into the nested value, LIKE: db.master.host, servers[0].port,
+// the hook is only called when the nested value changes.
 func (c *Configure) OnKeyChange(namespace, key string, hook func([]byte) error) bool {
-	d, ok := c.ds[namespace]
-	if ok {
-		ok = d.OnKeyChange(namespace, key, hook)
+	if c.interpolate {
+		hook = c.interpolateHook(namespace, key, hook)
 	}
+	hook = decryptHook(hook)
 
+	ok := c.watchKey(namespace, key, hook)
 	if !ok {
 		c.logger.Warnf("OnKeyChange register failed: namespace=%s key=%s", namespace, key)
 	}
@@ -62,6 +122,87 @@ func (c *Configure) OnKeyChange(namespace, key string, hook func([]byte) error)
 	return ok
 }
 
+// watchKey registers the hook on the key or the key path.
+func (c *Configure) watchKey(namespace, key string, hook func([]byte) error) bool {
+	if isKeyPath(key) && !c.hasKey(namespace, key) {
+		root, segs, ok := c.resolveKeyPath(namespace, key)
+		if ok {
+			ph := pathHook{segs: segs, hook: hook}
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			if b, err := c.getRawNoPath(ctx, namespace, root); err == nil {
+				if b, err = driver.Decrypt(b); err == nil {
+					ph.last, ph.exists, _ = extractPath(b, segs)
+				}
+			}
+			cancel()
+
+			key, hook = root, ph.handle
+		}
+	}
+
+	return c.onKeyChange(namespace, key, hook)
+}
+
+func (c *Configure) onKeyChange(namespace, key string, hook func([]byte) error) bool {
+	layers := c.ds[namespace]
+	if len(layers) == 1 {
+		return layers[0].driver.OnKeyChange(namespace, key, hook)
+	}
+
+	if !c.layerEventsWatchable(namespace) {
+		return false
+	}
+
+	var ok bool
+	lh := layeredHook{hook: hook}
+	for i, l := range layers {
+		idx := i
+		// the key events are watched, so that the key deleted in a higher layer falls back to the lower layer
+		if driver.OnKeyEvent(l.driver, namespace, key, func(ev KeyEvent) error {
+			return lh.handle(c, ev, idx)
+		}) {
+			ok = true
+		}
+	}
+
+	return ok
+}
+
+// hasKey reports whether the key exists as a literal key, not a key path.
+func (c *Configure) hasKey(namespace, key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := c.getRawNoPath(ctx, namespace, key)
+	return err == nil
+}
+
+// Layer returns the layer which serves the effective value of the key.
+func (c *Configure) Layer(ctx context.Context, namespace, key string) (LayerInfo, error) {
+	layers := c.ds[namespace]
+	for i := len(layers) - 1; i >= 0; i-- {
+		_, err := layers[i].driver.Get(ctx, namespace, key)
+		if err == nil {
+			return LayerInfo{Index: i, Source: layers[i].source}, nil
+		}
+
+		if !errors.Is(err, ErrNotFound) {
+			return LayerInfo{}, err
+		}
+	}
+
+	if isKeyPath(key) {
+		if root, _, ok := c.resolveKeyPath(namespace, key); ok && root != key {
+			if _, err := c.getPath(ctx, namespace, key); err != nil {
+				return LayerInfo{}, err
+			}
+			return c.Layer(ctx, namespace, root)
+		}
+	}
+
+	return LayerInfo{}, ErrNotFound
+}
+
 func (c *Configure) GetRaw(ctx context.Context, namespace, key string) ([]byte, error) {
 	b, err := c.UnsafeGetRaw(ctx, namespace, key)
 	if err != nil {
@@ -71,22 +212,93 @@ func (c *Configure) GetRaw(ctx context.Context, namespace, key string) ([]byte,
 	return append([]byte(nil), b...), nil
 }
 
+// UnsafeGetRaw gets the value of the key, the key can be a path into the nested value, LIKE: db.master.host.
+// the key path is resolved after the literal key not found,
+// and the nested value is decoded from the yaml/json/toml value of the root key.
+// if interpolation is enabled, the ${...} references in the value are expanded.
 func (c *Configure) UnsafeGetRaw(ctx context.Context, namespace, key string) ([]byte, error) {
-	d, ok := c.ds[namespace]
-	if !ok {
-		return nil, ErrNotFound
+	b, err := c.getRaw(ctx, namespace, key)
+	if err != nil || !c.interpolate {
+		return b, err
 	}
 
-	return d.Get(ctx, namespace, key)
+	return c.interpolateBytes(ctx, namespace, key, b)
 }
 
 func (c *Configure) GetRawString(ctx context.Context, namespace, key string) (string, error) {
-	d, ok := c.ds[namespace]
-	if !ok {
-		return "", ErrNotFound
+	s, err := c.getRawString(ctx, namespace, key)
+	if err != nil || !c.interpolate {
+		return s, err
 	}
 
-	return d.GetString(ctx, namespace, key)
+	return c.interpolateString(ctx, namespace, key, s)
+}
+
+// getRaw gets the decrypted value of the key without interpolation.
+func (c *Configure) getRaw(ctx context.Context, namespace, key string) ([]byte, error) {
+	b, err := c.getRawNoPath(ctx, namespace, key)
+	if err != nil && errors.Is(err, ErrNotFound) && isKeyPath(key) {
+		b, err = c.getPath(ctx, namespace, key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decrypt(namespace, key, b)
+}
+
+// getRawString gets the decrypted value of the key without interpolation.
+func (c *Configure) getRawString(ctx context.Context, namespace, key string) (string, error) {
+	s, err := c.getRawStringNoDecrypt(ctx, namespace, key)
+	if err != nil || !driver.IsEnvelope(strz.UnsafeBytes(s)) {
+		return s, err
+	}
+
+	b, err := decrypt(namespace, key, strz.UnsafeBytes(s))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// getRawStringNoDecrypt gets the raw value of the key.
+func (c *Configure) getRawStringNoDecrypt(ctx context.Context, namespace, key string) (string, error) {
+	if s, pinned, err := c.getPinned(ctx, namespace, key); !pinned {
+		layers := c.ds[namespace]
+		for i := len(layers) - 1; i >= 0; i-- {
+			s, err := layers[i].driver.GetString(ctx, namespace, key)
+			if err == nil || !errors.Is(err, ErrNotFound) {
+				return s, err
+			}
+		}
+	} else if err == nil || !errors.Is(err, ErrNotFound) {
+		return s, err
+	}
+
+	if isKeyPath(key) {
+		b, err := c.getPath(ctx, namespace, key)
+		return string(b), err
+	}
+
+	return "", ErrNotFound
+}
+
+// getRawNoPath gets the value of the literal key from the layers.
+func (c *Configure) getRawNoPath(ctx context.Context, namespace, key string) ([]byte, error) {
+	if s, pinned, err := c.getPinned(ctx, namespace, key); pinned {
+		return strz.UnsafeBytes(s), err
+	}
+
+	layers := c.ds[namespace]
+	for i := len(layers) - 1; i >= 0; i-- {
+		b, err := layers[i].driver.Get(ctx, namespace, key)
+		if err == nil || !errors.Is(err, ErrNotFound) {
+			return b, err
+		}
+	}
+
+	return nil, ErrNotFound
 }
 
 func (c *Configure) String(ctx context.Context, namespace, key string) (string, error) {
@@ -104,7 +316,11 @@ func (c *Configure) Int64(ctx context.Context, namespace, key string) (int64, er
 		return 0, err
 	}
 
-	return strconv.ParseInt(s, 10, 64)
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, valueError(namespace, key, s, "int64", err)
+	}
+	return v, nil
 }
 
 func (c *Configure) Int(ctx context.Context, namespace, key string) (int, error) {
@@ -113,7 +329,11 @@ func (c *Configure) Int(ctx context.Context, namespace, key string) (int, error)
 		return 0, err
 	}
 
-	return strconv.Atoi(s)
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, valueError(namespace, key, s, "int", err)
+	}
+	return v, nil
 }
 
 func (c *Configure) Float64(ctx context.Context, namespace, key string) (float64, error) {
@@ -122,7 +342,11 @@ func (c *Configure) Float64(ctx context.Context, namespace, key string) (float64
 		return 0, err
 	}
 
-	return strconv.ParseFloat(s, 64)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, valueError(namespace, key, s, "float64", err)
+	}
+	return v, nil
 }
 
 func (c *Configure) Bool(ctx context.Context, namespace, key string) (bool, error) {
@@ -131,7 +355,11 @@ func (c *Configure) Bool(ctx context.Context, namespace, key string) (bool, erro
 		return false, err
 	}
 
-	return strconv.ParseBool(s)
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, valueError(namespace, key, s, "bool", err)
+	}
+	return v, nil
 }
 
 func (c *Configure) YamlDecode(ctx context.Context, namespace, key string, value any) error {
@@ -146,24 +374,26 @@ func (c *Configure) TomlDecode(ctx context.Context, namespace, key string, value
 	return c.Decode(ctx, namespace, key, value, driver.MustGetDecoder("toml"))
 }
 
+// Decode decodes the value of the key by fn, the envelopes nested in the decoded value are also decrypted.
 func (c *Configure) Decode(ctx context.Context, namespace, key string, value any, fn driver.Decoder) error {
-	d, ok := c.ds[namespace]
-	if !ok {
-		return ErrNotFound
+	b, err := c.UnsafeGetRaw(ctx, namespace, key)
+	if err != nil {
+		return err
 	}
 
-	b, err := d.Get(ctx, namespace, key)
-	if err != nil {
+	if err := fn(b, value); err != nil {
 		return err
 	}
 
-	return fn(b, value)
+	return decryptNested(namespace, key, b, value)
 }
 
 func (c *Configure) Close() {
-	for _, v := range c.ds {
+	for _, v := range c.drivers {
 		v.Close()
 	}
+
+	c.closeSubscribers()
 }
 
 func unquote(s string) string {
@@ -186,3 +416,35 @@ func unquote(s string) string {
 
 	return s
 }
+
+// layeredHook wraps the hook registered on a layered namespace,
+// and only calls the hook when the effective value changes.
+type layeredHook struct {
+	mu   sync.Mutex
+	hook func([]byte) error
+	last []byte
+	// fired indicates whether the hook has been called, to distinguish the nil last value
+	fired bool
+}
+
+// handle is called when the key changes in the layer idx,
+// the key deleted in the layer falls back to the value of the lower layer.
+func (h *layeredHook) handle(c *Configure, ev KeyEvent, idx int) error {
+	ev, fire := c.effectiveEvent(ev, idx)
+	// the higher layer still has the key, or the key is deleted from all the layers
+	if !fire || ev.Type == EventDeleted {
+		return nil
+	}
+	b := ev.NewValue
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.fired && bytes.Equal(h.last, b) {
+		return nil
+	}
+
+	h.fired = true
+	h.last = append(h.last[:0], b...)
+	return h.hook(b)
+}
@@ -3,15 +3,25 @@ package config
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
+	"unsafe"
 
 	"github.com/welllog/golt/config/driver"
 	"github.com/welllog/golt/config/driver/etcd"
+	"github.com/welllog/golt/config/driver/file"
 	"github.com/welllog/golt/config/meta"
 	"github.com/welllog/golt/contract"
 	"go.etcd.io/etcd/api/v3/mvccpb"
@@ -54,6 +64,20 @@ func initConfigure(t *testing.T) *Configure {
 	return engine
 }
 
+// eventually waits until the cond is true, the test fails if the cond is still false in 5 seconds.
+// the file changes are reloaded after the 500ms debounce of the file driver.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestConfigure_String(t *testing.T) {
 	engine := initConfigure(t)
 
@@ -220,6 +244,1136 @@ func TestConfigureWatch(t *testing.T) {
 	testz.Equal(t, int32(2), num, "change event should be triggered twice")
 }
 
+func TestConfigure_FileFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.env":        "export APP_NAME=golt\nAPP_MODE=\"dev\" # comment\n",
+		"app.ini":        "name = golt\n; comment\n[db]\nhost = localhost\nport = 3306 ; comment\n[cache]\naddr = \"127.0.0.1:6379\"\n",
+		"app.properties": "! comment\napp.name=golt\napp.desc = a long \\\n    description\napp.unicode:\\u4e2d\napp.mode dev\n",
+		"app.conf":       `{"name": "golt", "retry": 3, "db": {"host": "localhost"}}`,
+	}
+	for name, content := range files {
+		testz.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0666))
+	}
+
+	// the format only has a decoder registered is decoded into map[string]any
+	driver.RegisterDecoder("conf", driver.MustGetDecoder("json"))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: "file://" + dir,
+			Configs: []meta.Rule{
+				{Namespace: "env", Path: "app.env", Watch: true},
+				{Namespace: "ini", Path: "app.ini", Watch: true},
+				{Namespace: "properties", Path: "app.properties", Watch: true},
+				{Namespace: "conf", Path: "app.conf"},
+			},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		namespace, key, value string
+	}{
+		{"env", "APP_NAME", "golt"},
+		{"env", "APP_MODE", "dev"},
+		{"ini", "name", "golt"},
+		{"ini", "db.host", "localhost"},
+		{"ini", "db.port", "3306"},
+		{"ini", "cache.addr", "127.0.0.1:6379"},
+		{"properties", "app.name", "golt"},
+		{"properties", "app.desc", "a long description"},
+		{"properties", "app.unicode", "\u4e2d"},
+		{"properties", "app.mode", "dev"},
+		{"conf", "name", "golt"},
+		{"conf", "retry", "3"},
+		{"conf", "db.host", "localhost"},
+	} {
+		value, err := engine.String(ctx, c.namespace, c.key)
+		testz.Nil(t, err)
+		testz.Equal(t, c.value, value, c.namespace+" "+c.key)
+	}
+
+	port, err := engine.Int(ctx, "ini", "db.port")
+	testz.Nil(t, err)
+	testz.Equal(t, 3306, port)
+
+	var (
+		mu      sync.Mutex
+		changed []string
+	)
+	hook := func(name string) func([]byte) error {
+		return func(b []byte) error {
+			mu.Lock()
+			changed = append(changed, name+"="+string(b))
+			mu.Unlock()
+			return nil
+		}
+	}
+	testz.Equal(t, true, engine.OnKeyChange("env", "APP_MODE", hook("env")))
+	testz.Equal(t, true, engine.OnKeyChange("ini", "db.port", hook("ini")))
+	testz.Equal(t, true, engine.OnKeyChange("properties", "app.mode", hook("properties")))
+
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.env"), []byte("APP_NAME=golt\nAPP_MODE=prod\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.ini"), []byte("name = golt\n[db]\nhost = localhost\nport = 3307\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.properties"), []byte("app.name=golt\napp.mode=prod\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(changed) >= 3
+	})
+
+	mu.Lock()
+	slices.Sort(changed)
+	testz.Equal(t, []string{"env=prod", "ini=3307", "properties=prod"}, changed)
+	mu.Unlock()
+
+	_, err = engine.String(ctx, "ini", "cache.addr")
+	testz.Equal(t, ErrNotFound, err)
+}
+
+func TestConfigure_FileDecoderOverride(t *testing.T) {
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yml"), []byte("name: golt\ndb:\n  host: localhost\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "work.json"), []byte(`{"name": "golt", "work": {"title": "engineer", "salary": 10000}}`), 0666))
+
+	// the decoder registered is used by the builtin field extractor of the format
+	var decoded int
+	yml, jsn := driver.MustGetDecoder("yml"), driver.MustGetDecoder("json")
+	driver.RegisterDecoder("yml", func(b []byte, v any) error {
+		decoded++
+		return yml(b, v)
+	})
+	defer driver.RegisterDecoder("yml", yml)
+	driver.RegisterDecoder("json", func(b []byte, v any) error {
+		decoded++
+		return jsn(b, v)
+	})
+	defer driver.RegisterDecoder("json", jsn)
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: "file://" + dir,
+			Configs: []meta.Rule{
+				{Namespace: "app", Path: "app.yml"},
+				{Namespace: "work", Path: "work.json"},
+			},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+	testz.Equal(t, 2, decoded)
+
+	ctx := context.Background()
+	name, err := engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "golt", name)
+
+	host, err := engine.String(ctx, "app", "db.host")
+	testz.Nil(t, err)
+	testz.Equal(t, "localhost", host)
+
+	// the nested object is kept as json
+	var w work
+	testz.Nil(t, engine.JsonDecode(ctx, "work", "work", &w))
+	testz.Equal(t, work{Title: "engineer", Salary: 10000}, w)
+
+	name, err = engine.String(ctx, "work", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "golt", name)
+}
+
+func TestConfigure_FileGlob(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	testz.Nil(t, os.Mkdir(confDir, 0777))
+	testz.Nil(t, os.WriteFile(filepath.Join(confDir, "10-base.yaml"), []byte("name: base\nretry: 3\ntimeout: 1s\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(confDir, "20-team.yaml"), []byte("retry: 5\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(confDir, "README.md"), []byte("# fragments\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(confDir, "10-base.yaml.bak"), []byte("name: [backup\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: "file://" + dir,
+			Configs: []meta.Rule{
+				{Namespace: "glob", Path: "conf.d/*.yaml", Watch: true},
+				{Namespace: "dir", Path: "conf.d"},
+				// the files of the unsupported formats are skipped, LIKE: README.md and 10-base.yaml.bak
+				{Namespace: "all", Path: "conf.d/*"},
+			},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	for _, ns := range []string{"glob", "dir", "all"} {
+		retry, err := engine.Int(ctx, ns, "retry")
+		testz.Nil(t, err)
+		testz.Equal(t, 5, retry, ns)
+		name, err := engine.String(ctx, ns, "name")
+		testz.Nil(t, err)
+		testz.Equal(t, "base", name, ns)
+	}
+
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	for _, key := range []string{"name", "retry", "timeout", "extra"} {
+		engine.OnKeyEvent("glob", key, func(ev KeyEvent) error {
+			mu.Lock()
+			events = append(events, ev.Type.String()+" "+ev.Key+"="+string(ev.NewValue))
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	// a new fragment is merged after the existing ones
+	testz.Nil(t, os.WriteFile(filepath.Join(confDir, "30-new.yaml"), []byte("timeout: 2s\nextra: true\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 2
+	})
+
+	mu.Lock()
+	slices.Sort(events)
+	testz.Equal(t, []string{"created extra=true", "updated timeout=2s"}, events)
+	events = nil
+	mu.Unlock()
+
+	// the removed fragment is unmerged, the key not changed in the merged value has no event
+	testz.Nil(t, os.Remove(filepath.Join(confDir, "20-team.yaml")))
+	testz.Nil(t, os.Rename(filepath.Join(confDir, "30-new.yaml"), filepath.Join(confDir, "05-new.yaml")))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 2
+	})
+
+	mu.Lock()
+	slices.Sort(events)
+	testz.Equal(t, []string{"updated retry=3", "updated timeout=1s"}, events)
+	mu.Unlock()
+
+	extra, err := engine.Bool(ctx, "glob", "extra")
+	testz.Nil(t, err)
+	testz.Equal(t, true, extra)
+
+	_, err = NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "dir", Path: "conf.d", Merge: meta.MergeError}},
+		},
+	})
+	testz.Equal(t, true, err != nil)
+	testz.Equal(t, true, strings.Contains(err.Error(), "key timeout is defined in both"))
+
+	// the glob in the missing directory is an error instead of the empty config
+	_, err = NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "typo", Path: "conf.dd/*.yaml"}},
+		},
+	})
+	testz.Equal(t, true, err != nil)
+}
+
+func TestConfigure_FileReplaced(t *testing.T) {
+	write := func(t *testing.T, path, content string) {
+		testz.Nil(t, os.WriteFile(path, []byte(content), 0666))
+	}
+
+	cases := []struct {
+		name string
+		// setup creates the config file app.yaml in the dir with the content "name: v1"
+		setup func(t *testing.T, dir string)
+		// unchanged touches the file without changing the content before update, it must not call the hooks
+		unchanged func(t *testing.T, dir string)
+		// update replaces the content with "name: v2"
+		update func(t *testing.T, dir string)
+	}{
+		{
+			name:  "write and rename",
+			setup: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v1\n") },
+			update: func(t *testing.T, dir string) {
+				write(t, filepath.Join(dir, ".app.yaml.tmp"), "name: v2\n")
+				testz.Nil(t, os.Rename(filepath.Join(dir, ".app.yaml.tmp"), filepath.Join(dir, "app.yaml")))
+			},
+		},
+		{
+			name:  "backup and write",
+			setup: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v1\n") },
+			update: func(t *testing.T, dir string) {
+				testz.Nil(t, os.Rename(filepath.Join(dir, "app.yaml"), filepath.Join(dir, "app.yaml~")))
+				time.Sleep(50 * time.Millisecond)
+				write(t, filepath.Join(dir, "app.yaml"), "name: v2\n")
+				testz.Nil(t, os.Remove(filepath.Join(dir, "app.yaml~")))
+			},
+		},
+		{
+			// the layout of the kubernetes ConfigMap volume
+			name: "configmap symlink swap",
+			setup: func(t *testing.T, dir string) {
+				testz.Nil(t, os.Mkdir(filepath.Join(dir, "..v1"), 0777))
+				write(t, filepath.Join(dir, "..v1", "app.yaml"), "name: v1\n")
+				testz.Nil(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+				testz.Nil(t, os.Symlink(filepath.Join("..data", "app.yaml"), filepath.Join(dir, "app.yaml")))
+			},
+			update: func(t *testing.T, dir string) {
+				testz.Nil(t, os.Mkdir(filepath.Join(dir, "..v2"), 0777))
+				write(t, filepath.Join(dir, "..v2", "app.yaml"), "name: v2\n")
+				testz.Nil(t, os.Symlink("..v2", filepath.Join(dir, "..data_tmp")))
+				testz.Nil(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+				testz.Nil(t, os.RemoveAll(filepath.Join(dir, "..v1")))
+			},
+		},
+		{
+			name: "symlink target written",
+			// the target is outside of the directory of the rule
+			setup: func(t *testing.T, dir string) {
+				target := filepath.Join(filepath.Dir(dir), "target")
+				testz.Nil(t, os.Mkdir(target, 0777))
+				write(t, filepath.Join(target, "app.yaml"), "name: v1\n")
+				testz.Nil(t, os.Symlink(filepath.Join(target, "app.yaml"), filepath.Join(dir, "app.yaml")))
+			},
+			update: func(t *testing.T, dir string) {
+				write(t, filepath.Join(filepath.Dir(dir), "target", "app.yaml"), "name: v2\n")
+			},
+		},
+		{
+			name:  "chmod only",
+			setup: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v1\n") },
+			unchanged: func(t *testing.T, dir string) {
+				testz.Nil(t, os.Chmod(filepath.Join(dir, "app.yaml"), 0600))
+			},
+			update: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v2\n") },
+		},
+		{
+			name:  "touch",
+			setup: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v1\n") },
+			unchanged: func(t *testing.T, dir string) {
+				now := time.Now()
+				testz.Nil(t, os.Chtimes(filepath.Join(dir, "app.yaml"), now, now))
+			},
+			update: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v2\n") },
+		},
+		{
+			name:  "same content written",
+			setup: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v1\n") },
+			unchanged: func(t *testing.T, dir string) {
+				write(t, filepath.Join(dir, "app.yaml"), "name: v1\n")
+				write(t, filepath.Join(dir, ".app.yaml.tmp"), "name: v1\n")
+				testz.Nil(t, os.Rename(filepath.Join(dir, ".app.yaml.tmp"), filepath.Join(dir, "app.yaml")))
+			},
+			update: func(t *testing.T, dir string) { write(t, filepath.Join(dir, "app.yaml"), "name: v2\n") },
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "conf")
+			testz.Nil(t, os.Mkdir(dir, 0777))
+			c.setup(t, dir)
+
+			engine, err := NewConfigure([]meta.Config{
+				{
+					Source:  "file://" + dir,
+					Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+				},
+			})
+			testz.Nil(t, err)
+			defer engine.Close()
+
+			var (
+				mu      sync.Mutex
+				changes []string
+			)
+			testz.Equal(t, true, engine.OnKeyChange("app", "name", func(b []byte) error {
+				mu.Lock()
+				changes = append(changes, string(b))
+				mu.Unlock()
+				return nil
+			}))
+
+			if c.unchanged != nil {
+				c.unchanged(t, dir)
+				// wait for the reload after the debounce, it is skipped by the unchanged checksum
+				time.Sleep(time.Second)
+			}
+
+			c.update(t, dir)
+			eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(changes) >= 1
+			})
+
+			name, err := engine.String(context.Background(), "app", "name")
+			testz.Nil(t, err)
+			testz.Equal(t, "v2", name)
+
+			mu.Lock()
+			defer mu.Unlock()
+			testz.Equal(t, []string{"v2"}, changes)
+		})
+	}
+}
+
+func TestConfigure_FileTruncated(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("name: v1\nport: 8080\n"), 0666))
+	polled := filepath.Join(dir, "poll.yaml")
+	testz.Nil(t, os.WriteFile(polled, []byte("name: v0\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: "file://" + dir,
+			Configs: []meta.Rule{
+				{Namespace: "app", Path: "app.yaml", Watch: true},
+				{Namespace: "poll", Path: "poll.yaml", Poll: true},
+			},
+		},
+	}, WithFilePollInterval(100*time.Millisecond))
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	for _, key := range []string{"name", "port"} {
+		testz.Equal(t, true, engine.OnKeyEvent("app", key, func(ev KeyEvent) error {
+			mu.Lock()
+			events = append(events, ev.Type.String()+" "+ev.Key)
+			mu.Unlock()
+			return nil
+		}))
+	}
+
+	// the empty content read between the truncate and the write is not applied
+	testz.Nil(t, os.Truncate(file, 0))
+	time.Sleep(700 * time.Millisecond)
+	testz.Nil(t, os.WriteFile(file, []byte("name: v2\nport: 8080\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 1
+	})
+
+	mu.Lock()
+	testz.Equal(t, []string{"updated name"}, events)
+	events = nil
+	mu.Unlock()
+
+	// the file left empty is applied by the deferred reload, without waiting for another change
+	start := time.Now()
+	testz.Nil(t, os.Truncate(file, 0))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 2
+	})
+	testz.Equal(t, true, time.Since(start) < 2*time.Second)
+
+	mu.Lock()
+	slices.Sort(events)
+	testz.Equal(t, []string{"deleted name", "deleted port"}, events)
+	events = nil
+	mu.Unlock()
+
+	_, err = engine.String(context.Background(), "app", "name")
+	testz.Equal(t, ErrNotFound, err)
+
+	// the polled file left empty is also applied
+	testz.Nil(t, os.WriteFile(polled, []byte("name: v1\n"), 0666))
+	eventually(t, func() bool {
+		name, err := engine.String(context.Background(), "poll", "name")
+		return err == nil && name == "v1"
+	})
+	testz.Nil(t, os.Truncate(polled, 0))
+	eventually(t, func() bool {
+		_, err := engine.String(context.Background(), "poll", "name")
+		return err == ErrNotFound
+	})
+}
+
+func TestConfigure_FileDirReplaced(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "conf")
+	testz.Nil(t, os.Mkdir(dir, 0777))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: v1\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + root,
+			Configs: []meta.Rule{{Namespace: "app", Path: "conf/app.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the directory entry is replaced, the watch of the old directory is lost
+	testz.Nil(t, os.Rename(dir, filepath.Join(root, "conf.old")))
+	time.Sleep(200 * time.Millisecond)
+	testz.Nil(t, os.Mkdir(dir, 0777))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: v2\n"), 0666))
+
+	ctx := context.Background()
+	eventually(t, func() bool {
+		name, err := engine.String(ctx, "app", "name")
+		return err == nil && name == "v2"
+	})
+
+	// the new directory is watched
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: v3\n"), 0666))
+	eventually(t, func() bool {
+		name, err := engine.String(ctx, "app", "name")
+		return err == nil && name == "v3"
+	})
+}
+
+func TestConfigure_FilePoll(t *testing.T) {
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "poll.yaml"), []byte("name: v1\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "notify.yaml"), []byte("name: v1\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "static.yaml"), []byte("name: v1\n"), 0666))
+
+	source := "file://" + dir
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: source,
+			Configs: []meta.Rule{
+				{Namespace: "poll", Path: "poll.yaml", Poll: true},
+				{Namespace: "notify", Path: "notify.yaml", Watch: true},
+				{Namespace: "static", Path: "static.yaml"},
+			},
+		},
+	}, WithFilePollInterval(100*time.Millisecond))
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	testz.Equal(t, map[string]WatchMode{source: WatchPoll}, engine.WatchMode("poll"))
+	testz.Equal(t, map[string]WatchMode{source: WatchNotify}, engine.WatchMode("notify"))
+	testz.Equal(t, map[string]WatchMode{source: WatchNone}, engine.WatchMode("static"))
+
+	var (
+		mu      sync.Mutex
+		changes []string
+	)
+	testz.Equal(t, true, engine.OnKeyChange("poll", "name", func(b []byte) error {
+		mu.Lock()
+		changes = append(changes, string(b))
+		mu.Unlock()
+		return nil
+	}))
+
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "poll.yaml"), []byte("name: v2\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(changes) >= 1
+	})
+
+	// the first poll finds the content unchanged since loaded, so only the written content is changed
+	mu.Lock()
+	testz.Equal(t, []string{"v2"}, changes)
+	mu.Unlock()
+
+	name, err := engine.String(context.Background(), "poll", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "v2", name)
+}
+
+func TestConfigure_FileEmbed(t *testing.T) {
+	file.RegisterFS("test-defaults", fstest.MapFS{
+		"app.yaml":        {Data: []byte("name: default\nport: 8080\n")},
+		"conf.d/db.yaml":  {Data: []byte("host: localhost\n")},
+		"conf.d/log.toml": {Data: []byte("level = \"info\"\n")},
+		"conf.d/.swp":     {Data: []byte("{")},
+	})
+
+	dir := t.TempDir()
+	highFile := filepath.Join(dir, "app.yaml")
+	testz.Nil(t, os.WriteFile(highFile, []byte("port: 9090\n"), 0666))
+
+	embedSource, fileSource := "embed://test-defaults", "file://"+dir
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: embedSource,
+			Configs: []meta.Rule{
+				// the watch of the embedded files is ignored
+				{Namespace: "app", Path: "app.yaml", Watch: true},
+				{Namespace: "conf", Path: "conf.d"},
+			},
+		},
+		{
+			Source:  fileSource,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	name, err := engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "default", name)
+
+	port, err := engine.Int(ctx, "app", "port")
+	testz.Nil(t, err)
+	testz.Equal(t, 9090, port)
+
+	host, err := engine.String(ctx, "conf", "host")
+	testz.Nil(t, err)
+	testz.Equal(t, "localhost", host)
+
+	level, err := engine.String(ctx, "conf", "level")
+	testz.Nil(t, err)
+	testz.Equal(t, "info", level)
+
+	testz.Equal(t, map[string]WatchMode{embedSource: WatchNone, fileSource: WatchNotify}, engine.WatchMode("app"))
+	testz.Equal(t, false, engine.OnKeyChange("conf", "host", func([]byte) error { return nil }))
+
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	testz.Equal(t, true, engine.OnKeyChange("app", "name", func(b []byte) error {
+		mu.Lock()
+		names = append(names, string(b))
+		mu.Unlock()
+		return nil
+	}))
+
+	testz.Nil(t, os.WriteFile(highFile, []byte("port: 9090\nname: override\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(names) >= 1
+	})
+
+	mu.Lock()
+	testz.Equal(t, []string{"override"}, names)
+	mu.Unlock()
+
+	_, err = NewConfigure([]meta.Config{
+		{Source: "embed://none", Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml"}}},
+	})
+	testz.Equal(t, true, err != nil)
+}
+
+func TestConfigure_HTTP(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		doc         = "name: v1\nport: 8080\n"
+		version     = 1
+		unavailable = 1
+		notModified = 0
+	)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path == "/db" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_, _ = w.Write([]byte(`{"host":"localhost"}`))
+			return
+		}
+
+		// the first request fails, it is retried
+		if unavailable > 0 {
+			unavailable--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		etag := fmt.Sprintf(`"v%d"`, version)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	rules := []meta.Config{
+		{
+			Source: srv.URL + "/v1/",
+			Configs: []meta.Rule{
+				{Namespace: "app", Path: "app.yaml", Watch: true},
+				{Namespace: "db", Path: srv.URL + "/db"},
+			},
+		},
+	}
+	engine, err := NewConfigure(rules,
+		WithHTTPTLSConfig(&tls.Config{RootCAs: pool}),
+		WithHTTPHeader("Authorization", "Bearer token"),
+		WithHTTPRetry(2, 10*time.Millisecond),
+		WithHTTPPollInterval(50*time.Millisecond),
+	)
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	name, err := engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "v1", name)
+
+	host, err := engine.String(ctx, "db", "host")
+	testz.Nil(t, err)
+	testz.Equal(t, "localhost", host)
+
+	testz.Equal(t, map[string]WatchMode{srv.URL + "/v1/": WatchPoll}, engine.WatchMode("app"))
+	testz.Equal(t, false, engine.OnKeyChange("db", "host", func([]byte) error { return nil }))
+
+	var names []string
+	testz.Equal(t, true, engine.OnKeyChange("app", "name", func(b []byte) error {
+		mu.Lock()
+		names = append(names, string(b))
+		mu.Unlock()
+		return nil
+	}))
+
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return notModified > 0
+	})
+	mu.Lock()
+	testz.Equal(t, 0, len(names))
+	doc, version = "name: v2\nport: 8080\n", 2
+	mu.Unlock()
+
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(names) >= 1
+	})
+	mu.Lock()
+	testz.Equal(t, []string{"v2"}, names)
+	mu.Unlock()
+
+	name, err = engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "v2", name)
+
+	// the unauthorized request is not retried
+	_, err = NewConfigure(rules, WithHTTPTLSConfig(&tls.Config{RootCAs: pool}))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "401"))
+
+	// the options are only used by the Configure created with them, the server is not trusted without them
+	_, err = NewConfigure(rules)
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "certificate"))
+}
+
+func TestConfigure_Env(t *testing.T) {
+	t.Setenv("GOLT_TEST_DB_HOST", "127.0.0.1")
+	t.Setenv("GOLT_TEST_DB_PORT", "3306")
+	t.Setenv("GOLT_TEST_APP_NAME", "golt")
+
+	dotEnv := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(dotEnv, []byte("# fallback\nGOLT_TEST_DB_HOST=localhost\nexport GOLT_TEST_DB_USER=\"root\" # user\n"), 0666)
+	testz.Nil(t, err)
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: "env://GOLT_TEST_",
+			Configs: []meta.Rule{
+				{Namespace: "db", Path: "DB_"},
+				{Namespace: "app", Path: ""},
+			},
+		},
+	}, WithEnvDotFiles(dotEnv))
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	host, err := engine.String(ctx, "db", "host")
+	testz.Nil(t, err)
+	testz.Equal(t, "127.0.0.1", host)
+
+	port, err := engine.Int(ctx, "db", "port")
+	testz.Nil(t, err)
+	testz.Equal(t, 3306, port)
+
+	user, err := engine.String(ctx, "db", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "root", user)
+
+	name, err := engine.String(ctx, "app", "app.name")
+	testz.Nil(t, err)
+	testz.Equal(t, "golt", name)
+
+	_, err = engine.String(ctx, "db", "password")
+	testz.Equal(t, ErrNotFound, err)
+
+	testz.Equal(t, false, engine.OnKeyChange("db", "host", func([]byte) error { return nil }))
+
+	// the snapshot keys are resolved by Get
+	s, err := engine.Snapshot(ctx)
+	testz.Nil(t, err)
+	testz.Equal(t, "127.0.0.1", s.Namespaces["db"]["host"].Value)
+	testz.Equal(t, "root", s.Namespaces["db"]["user"].Value)
+	testz.Equal(t, "golt", s.Namespaces["app"]["app_name"].Value)
+	for key, v := range s.Namespaces["app"] {
+		value, err := engine.String(ctx, "app", key)
+		testz.Nil(t, err)
+		testz.Equal(t, v.Value, value)
+	}
+
+	var c struct {
+		host string `config:"namespace:db;key:host"`
+		port *int   `config:"namespace:db;key:port;lazy:true"`
+	}
+	funcs, err := engine.InitAndPreload(&c, time.Second)
+	testz.Nil(t, err)
+	testz.Equal(t, "127.0.0.1", c.host)
+
+	_, err = engine.TryLoad(unsafe.Pointer(&c.port), funcs)
+	testz.Nil(t, err)
+	testz.Equal(t, 3306, *c.port)
+
+	// the dot files are only used by the Configure created with them
+	other, err := NewConfigure([]meta.Config{
+		{Source: "env://GOLT_TEST_", Configs: []meta.Rule{{Namespace: "db", Path: "DB_"}}},
+	})
+	testz.Nil(t, err)
+	defer other.Close()
+
+	_, err = other.String(ctx, "db", "user")
+	testz.Equal(t, ErrNotFound, err)
+}
+
+func TestConfigure_Layered(t *testing.T) {
+	lowDir, highDir := t.TempDir(), t.TempDir()
+	err := os.WriteFile(filepath.Join(lowDir, "app.yaml"), []byte("name: default\nport: 8080\n"), 0666)
+	testz.Nil(t, err)
+	highFile := filepath.Join(highDir, "app.yaml")
+	err = os.WriteFile(highFile, []byte("port: 9090\n"), 0666)
+	testz.Nil(t, err)
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + lowDir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+		{
+			Source:  "file://" + highDir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	name, err := engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "default", name)
+
+	port, err := engine.Int(ctx, "app", "port")
+	testz.Nil(t, err)
+	testz.Equal(t, 9090, port)
+
+	l, err := engine.Layer(ctx, "app", "port")
+	testz.Nil(t, err)
+	testz.Equal(t, 1, l.Index)
+	testz.Equal(t, "file://"+highDir, l.Source)
+
+	l, err = engine.Layer(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, 0, l.Index)
+
+	_, err = engine.Layer(ctx, "app", "none")
+	testz.Equal(t, ErrNotFound, err)
+
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	ok := engine.OnKeyChange("app", "name", func(b []byte) error {
+		mu.Lock()
+		names = append(names, string(b))
+		mu.Unlock()
+		return nil
+	})
+	testz.Equal(t, true, ok)
+	namesLen := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(names)
+	}
+
+	err = os.WriteFile(highFile, []byte("port: 9090\nname: override\n"), 0666)
+	testz.Nil(t, err)
+	eventually(t, func() bool { return namesLen() >= 1 })
+
+	name, err = engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "override", name)
+
+	// the lower layer change is shadowed by the higher layer,
+	// the version only defined in the lower layer tells the lower layer is reloaded
+	err = os.WriteFile(filepath.Join(lowDir, "app.yaml"), []byte("name: default2\nport: 8080\nversion: 2\n"), 0666)
+	testz.Nil(t, err)
+	eventually(t, func() bool {
+		version, err := engine.Int(ctx, "app", "version")
+		return err == nil && version == 2
+	})
+
+	mu.Lock()
+	testz.Equal(t, []string{"override"}, names)
+	mu.Unlock()
+
+	// the key deleted in the higher layer falls back to the lower layer
+	err = os.WriteFile(highFile, []byte("port: 9090\n"), 0666)
+	testz.Nil(t, err)
+	eventually(t, func() bool { return namesLen() >= 2 })
+
+	mu.Lock()
+	testz.Equal(t, []string{"override", "default2"}, names)
+	mu.Unlock()
+}
+
+func TestConfigure_LayeredWithoutKeyEvents(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("port: 8080\n"), 0666)
+	testz.Nil(t, err)
+
+	bd := newBaseDriver(map[string]string{"name": "demo"})
+	driver.RegisterDriver("base-layered", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return bd, nil
+	})
+	fileConfig := meta.Config{
+		Source:  "file://" + dir,
+		Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+	}
+	baseConfig := meta.Config{Source: "base-layered://", Configs: []meta.Rule{{Namespace: "app"}}}
+
+	// the key deleted in the higher layer can not be reported, so the fall through to the lower layer is missed
+	engine, err := NewConfigure([]meta.Config{fileConfig, baseConfig})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	testz.Equal(t, false, engine.OnKeyChange("app", "name", func([]byte) error { return nil }))
+	testz.Equal(t, false, engine.OnKeyEvent("app", "name", func(KeyEvent) error { return nil }))
+	// the refused key registers no hook on the layers
+	testz.Equal(t, 0, bd.hookCount("name"))
+
+	// the lowest layer has no lower value to fall back to, its changes are reported by OnKeyChange
+	engine2, err := NewConfigure([]meta.Config{baseConfig, fileConfig})
+	testz.Nil(t, err)
+	defer engine2.Close()
+
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	ok := engine2.OnKeyChange("app", "name", func(b []byte) error {
+		mu.Lock()
+		names = append(names, string(b))
+		mu.Unlock()
+		return nil
+	})
+	testz.Equal(t, true, ok)
+
+	bd.set("name", "demo2")
+	mu.Lock()
+	testz.Equal(t, []string{"demo2"}, names)
+	mu.Unlock()
+}
+
+func TestConfigure_OnKeyEvent(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	err := os.WriteFile(file, []byte("name: demo\n"), 0666)
+	testz.Nil(t, err)
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	var (
+		mu     sync.Mutex
+		events []KeyEvent
+	)
+	hook := func(ev KeyEvent) error {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+		return nil
+	}
+	testz.Equal(t, true, engine.OnKeyEvent("app", "name", hook))
+	testz.Equal(t, true, engine.OnKeyEvent("app", "port", hook))
+
+	eventsLen := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events)
+	}
+
+	err = os.WriteFile(file, []byte("name: demo2\nport: 80\n"), 0666)
+	testz.Nil(t, err)
+	eventually(t, func() bool { return eventsLen() >= 2 })
+
+	err = os.WriteFile(file, []byte("port: 80\n"), 0666)
+	testz.Nil(t, err)
+	eventually(t, func() bool { return eventsLen() >= 3 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	testz.Equal(t, 3, len(events))
+	for _, ev := range events {
+		testz.Equal(t, "app", ev.Namespace)
+		switch ev.Key {
+		case "port":
+			testz.Equal(t, EventCreated, ev.Type)
+			testz.Equal(t, "80", string(ev.NewValue))
+		case "name":
+			if ev.Type == EventUpdated {
+				testz.Equal(t, "demo", string(ev.OldValue))
+				testz.Equal(t, "demo2", string(ev.NewValue))
+			} else {
+				testz.Equal(t, EventDeleted, ev.Type)
+				testz.Equal(t, "demo2", string(ev.OldValue))
+			}
+		}
+	}
+}
+
+// baseDriver implements the required driver interface only, like the drivers implemented outside this module.
+type baseDriver struct {
+	mu     sync.Mutex
+	values map[string]string
+	hooks  map[string][]func([]byte) error
+	// onGet is called after the key is read by GetString.
+	onGet func(key string)
+}
+
+func newBaseDriver(values map[string]string) *baseDriver {
+	return &baseDriver{values: values, hooks: make(map[string][]func([]byte) error)}
+}
+
+func (b *baseDriver) set(key, value string) {
+	for _, hook := range b.put(key, value) {
+		_ = hook([]byte(value))
+	}
+}
+
+// put changes the value of the key, and returns the hooks registered at the time of the change.
+func (b *baseDriver) put(key, value string) []func([]byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.values[key] = value
+	return b.hooks[key]
+}
+
+func (b *baseDriver) hookCount(key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.hooks[key])
+}
+
+func (b *baseDriver) Namespaces() []string { return []string{"app"} }
+
+func (b *baseDriver) OnKeyChange(namespace, key string, hook func([]byte) error) bool {
+	b.mu.Lock()
+	b.hooks[key] = append(b.hooks[key], hook)
+	b.mu.Unlock()
+	return true
+}
+
+func (b *baseDriver) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	value, err := b.GetString(ctx, namespace, key)
+	return []byte(value), err
+}
+
+func (b *baseDriver) GetString(ctx context.Context, namespace, key string) (string, error) {
+	b.mu.Lock()
+	value, ok := b.values[key]
+	onGet := b.onGet
+	b.mu.Unlock()
+
+	if onGet != nil {
+		onGet(key)
+	}
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+	return value, nil
+}
+
+func (b *baseDriver) Close() {}
+
+func TestConfigure_BaseDriver(t *testing.T) {
+	bd := newBaseDriver(map[string]string{"name": "demo"})
+	driver.RegisterDriver("base", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return bd, nil
+	})
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "base://",
+			Configs: []meta.Rule{{Namespace: "app", Path: "/app/", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	name, err := engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo", name)
+
+	var (
+		values []string
+		events []KeyEvent
+	)
+	testz.Equal(t, true, engine.OnKeyChange("app", "name", func(b []byte) error {
+		values = append(values, string(b))
+		return nil
+	}))
+	// the key events fall back to OnKeyChange
+	testz.Equal(t, true, engine.OnKeyEvent("app", "name", func(ev KeyEvent) error {
+		events = append(events, ev)
+		return nil
+	}))
+	testz.Equal(t, false, engine.OnNamespaceReload("app", func(map[string][]byte) error { return nil }))
+	testz.Equal(t, false, engine.OnKeyPrepare("app", "name", func([]byte) error { return nil }))
+
+	bd.set("name", "demo2")
+	testz.Equal(t, []string{"demo2"}, values)
+	testz.Equal(t, 1, len(events))
+	testz.Equal(t, "app", events[0].Namespace)
+	testz.Equal(t, EventUpdated, events[0].Type)
+	testz.Equal(t, "demo2", string(events[0].NewValue))
+
+	s, err := engine.Snapshot(ctx)
+	testz.Nil(t, err)
+	testz.Equal(t, map[string][]string{"app": {"base://"}}, s.Unsupported)
+	testz.Equal(t, 0, len(s.Namespaces["app"]))
+}
+
 type testKV struct {
 	kvs []*kv
 	fn  func(string)
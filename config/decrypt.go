@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/welllog/golib/strz"
+	"github.com/welllog/golt/config/driver"
+)
+
+// decrypt decrypts the value if it is an encrypted envelope, LIKE: enc:aesgcm:<key id>:<base64 ciphertext>
+// the decryptors are registered by driver.RegisterDecryptor.
+func decrypt(namespace, key string, b []byte) ([]byte, error) {
+	plaintext, err := driver.Decrypt(b)
+	if err != nil {
+		return nil, fmt.Errorf("namespace %s key %s: %w", namespace, key, err)
+	}
+	return plaintext, nil
+}
+
+// decryptHook wraps the hook to receive the decrypted value.
+func decryptHook(hook func([]byte) error) func([]byte) error {
+	return func(b []byte) error {
+		plaintext, err := driver.Decrypt(b)
+		if err != nil {
+			return err
+		}
+		return hook(plaintext)
+	}
+}
+
+// decryptNested decrypts the envelopes nested in the value decoded from b,
+// LIKE: the password field of a struct decoded from a yaml document.
+func decryptNested(namespace, key string, b []byte, value any) error {
+	if !bytes.Contains(b, strz.UnsafeBytes(driver.EnvelopePrefix)) {
+		return nil
+	}
+
+	if err := decryptValue(reflect.ValueOf(value)); err != nil {
+		return fmt.Errorf("namespace %s key %s: %w", namespace, key, err)
+	}
+	return nil
+}
+
+// decryptValue walks the value and replaces the envelope strings with the plaintext,
+// the strings can not be set, LIKE: the string in an unaddressable array, are skipped.
+func decryptValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() || !driver.IsEnvelope(strz.UnsafeBytes(v.String())) {
+			return nil
+		}
+
+		plaintext, err := driver.Decrypt(strz.UnsafeBytes(v.String()))
+		if err != nil {
+			return err
+		}
+		v.SetString(string(plaintext))
+
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return decryptValue(v.Elem())
+		}
+
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return nil
+		}
+
+		// the value in the interface can not be set, so it is decrypted on a copy
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := decryptValue(elem); err != nil {
+			return err
+		}
+		v.Set(elem)
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !t.Field(i).IsExported() {
+				if !field.CanAddr() {
+					continue
+				}
+				// the unexported field is set by unsafe like initStruct
+				field = reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+			}
+
+			if err := decryptValue(field); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if err := decryptValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// the map value can not be set, so it is decrypted on a copy
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := decryptValue(elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+
+	default:
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/config/secret"
+)
+
+func TestConfigure_Decrypt(t *testing.T) {
+	k1, err := secret.GenerateKey()
+	testz.Nil(t, err)
+	k2, err := secret.GenerateKey()
+	testz.Nil(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "k1.key")
+	testz.Nil(t, os.WriteFile(keyFile, []byte(k1+"\n"), 0600))
+	key1, err := secret.ReadKeyFile(keyFile)
+	testz.Nil(t, err)
+
+	t.Setenv("GOLT_TEST_CONFIG_KEY", k2)
+	key2, err := secret.ReadKeyEnv("GOLT_TEST_CONFIG_KEY")
+	testz.Nil(t, err)
+
+	old, err := secret.NewAESGCM("k1", map[string][]byte{"k1": key1})
+	testz.Nil(t, err)
+	env1, err := old.Encrypt([]byte("p@ss1"))
+	testz.Nil(t, err)
+	testz.Equal(t, true, strings.HasPrefix(env1, "enc:aesgcm:k1:"))
+
+	// rotate the primary key to k2, and the values encrypted by k1 still can be decrypted
+	aes, err := secret.NewAESGCM("k2", map[string][]byte{"k1": key1, "k2": key2})
+	testz.Nil(t, err)
+	aes.Register()
+	env2, err := aes.Encrypt([]byte("p@ss2"))
+	testz.Nil(t, err)
+	testz.Equal(t, true, strings.HasPrefix(env2, "enc:aesgcm:k2:"))
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	content := "password: " + env1 + "\nmaster:\n  password: \"" + env2 + "\"\nbad: enc:unknown:k1:" +
+		base64.StdEncoding.EncodeToString([]byte("x")) + "\n"
+	testz.Nil(t, os.WriteFile(file, []byte(content), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	pass, err := engine.String(ctx, "db", "password")
+	testz.Nil(t, err)
+	testz.Equal(t, "p@ss1", pass)
+
+	pass, err = engine.String(ctx, "db", "master.password")
+	testz.Nil(t, err)
+	testz.Equal(t, "p@ss2", pass)
+
+	_, err = engine.String(ctx, "db", "bad")
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "unknown decryptor"))
+
+	var c struct {
+		password string `config:"namespace:db;key:password"`
+	}
+	_, err = engine.InitAndPreload(&c, time.Second)
+	testz.Nil(t, err)
+	testz.Equal(t, "p@ss1", c.password)
+
+	changed := make(chan string, 1)
+	engine.OnKeyChange("db", "password", func(b []byte) error {
+		changed <- string(b)
+		return nil
+	})
+
+	env3, err := aes.Encrypt([]byte("p@ss3"))
+	testz.Nil(t, err)
+	testz.Nil(t, os.WriteFile(file, []byte(strings.Replace(content, env1, env3, 1)), 0666))
+	select {
+	case b := <-changed:
+		testz.Equal(t, "p@ss3", b)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change event not triggered")
+	}
+}
+
+func TestConfigure_DecryptNested(t *testing.T) {
+	k, err := secret.GenerateKey()
+	testz.Nil(t, err)
+	key, err := base64.StdEncoding.DecodeString(k)
+	testz.Nil(t, err)
+
+	aes, err := secret.NewAESGCM("nested", map[string][]byte{"nested": key})
+	testz.Nil(t, err)
+	aes.Register()
+	env, err := aes.Encrypt([]byte("p@ss"))
+	testz.Nil(t, err)
+
+	dir := t.TempDir()
+	content := "master:\n  user: root\n  password: " + env + "\n  hosts: [\"" + env + "\"]\n" +
+		"bad:\n  password: enc:unknown:k1:" + base64.StdEncoding.EncodeToString([]byte("x")) + "\n"
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "db.yaml"), []byte(content), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml"}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	var master struct {
+		User     string   `yaml:"user"`
+		Password string   `yaml:"password"`
+		Hosts    []string `yaml:"hosts"`
+	}
+	testz.Nil(t, engine.YamlDecode(ctx, "db", "master", &master))
+	testz.Equal(t, "root", master.User)
+	testz.Equal(t, "p@ss", master.Password)
+	testz.Equal(t, []string{"p@ss"}, master.Hosts)
+
+	var m map[string]any
+	testz.Nil(t, engine.YamlDecode(ctx, "db", "master", &m))
+	testz.Equal(t, "p@ss", m["password"])
+	testz.Equal(t, []any{"p@ss"}, m["hosts"])
+
+	var bad map[string]string
+	err = engine.YamlDecode(ctx, "db", "bad", &bad)
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "unknown decryptor"))
+}
+
+func TestConfigure_DecryptPath(t *testing.T) {
+	k, err := secret.GenerateKey()
+	testz.Nil(t, err)
+	key, err := base64.StdEncoding.DecodeString(k)
+	testz.Nil(t, err)
+
+	aes, err := secret.NewAESGCM("path", map[string][]byte{"path": key})
+	testz.Nil(t, err)
+	aes.Register()
+
+	// the whole document of the root key is encrypted
+	master, err := aes.Encrypt([]byte("host: localhost\nport: 3306\n"))
+	testz.Nil(t, err)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("master: "+master+"\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	host, err := engine.String(ctx, "db", "master.host")
+	testz.Nil(t, err)
+	testz.Equal(t, "localhost", host)
+
+	port, err := engine.Int(ctx, "db", "master.port")
+	testz.Nil(t, err)
+	testz.Equal(t, 3306, port)
+
+	changed := make(chan string, 2)
+	testz.Equal(t, true, engine.OnKeyChange("db", "master.host", func(b []byte) error {
+		changed <- string(b)
+		return nil
+	}))
+
+	// the port changed and the host re-encrypted with a new nonce does not change the host
+	master, err = aes.Encrypt([]byte("host: localhost\nport: 3307\n"))
+	testz.Nil(t, err)
+	testz.Nil(t, os.WriteFile(file, []byte("master: "+master+"\n"), 0666))
+	eventually(t, func() bool {
+		port, err := engine.Int(ctx, "db", "master.port")
+		return err == nil && port == 3307
+	})
+
+	master, err = aes.Encrypt([]byte("host: 127.0.0.1\nport: 3307\n"))
+	testz.Nil(t, err)
+	testz.Nil(t, os.WriteFile(file, []byte("master: "+master+"\n"), 0666))
+	select {
+	case b := <-changed:
+		testz.Equal(t, "127.0.0.1", b)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change event not triggered")
+	}
+	testz.Equal(t, 0, len(changed))
+}
@@ -0,0 +1,104 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+// kvPair is a key of the Consul KV HTTP API, the value is base64 encoded in the json.
+type kvPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+// client is a minimal client of the Consul KV HTTP API.
+type client struct {
+	// addr is the address of the agent with scheme, LIKE: http://127.0.0.1:8500
+	addr       string
+	token      string
+	datacenter string
+	http       *http.Client
+}
+
+// get reads the key, errNotFound is returned if the key not exists.
+func (c *client) get(ctx context.Context, key string) (kvPair, error) {
+	pairs, _, err := c.do(ctx, key, nil)
+	if err != nil {
+		return kvPair{}, err
+	}
+
+	if len(pairs) == 0 {
+		return kvPair{}, errNotFound
+	}
+	return pairs[0], nil
+}
+
+// list reads all keys with the prefix ordered by key, and returns the X-Consul-Index of the prefix.
+// if index is greater than 0, it is a blocking query which returns when the index changes or the wait time elapses.
+func (c *client) list(ctx context.Context, prefix string, index uint64, wait time.Duration) ([]kvPair, uint64, error) {
+	query := url.Values{"recurse": {"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", strconv.FormatInt(max(int64(wait/time.Second), 1), 10)+"s")
+	}
+
+	return c.do(ctx, prefix, query)
+}
+
+func (c *client) do(ctx context.Context, key string, query url.Values) ([]kvPair, uint64, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+
+	u := c.addr + "/v1/kv/" + strings.TrimPrefix(key, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	rsp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rsp.Body.Close()
+
+	index, _ := strconv.ParseUint(rsp.Header.Get("X-Consul-Index"), 10, 64)
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// the key or the prefix not exists
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		return nil, index, nil
+	default:
+		b, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return nil, 0, fmt.Errorf("consul responds %s: %s", rsp.Status, strings.TrimSpace(string(b)))
+	}
+
+	var pairs []kvPair
+	if err := json.NewDecoder(rsp.Body).Decode(&pairs); err != nil {
+		return nil, 0, fmt.Errorf("decode consul response failed: %w", err)
+	}
+	return pairs, index, nil
+}
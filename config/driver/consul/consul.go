@@ -0,0 +1,244 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+)
+
+func init() {
+	driver.RegisterDriver("consul", New)
+}
+
+var (
+	_ driver.Driver            = (*consul)(nil)
+	_ driver.KeyEventWatcher   = (*consul)(nil)
+	_ driver.BatchEventWatcher = (*consul)(nil)
+	_ driver.BatchPreparer     = (*consul)(nil)
+	_ driver.EntryLister       = (*consul)(nil)
+	_ driver.WatchModeReporter = (*consul)(nil)
+)
+
+// consul serves the keys of the Consul KV, each rule path is a key prefix, LIKE:
+//
+//	source: consul://127.0.0.1:8500
+//	configs:
+//	  - namespace: app
+//	    path: config/app/
+//	    watch: true
+//
+// the watched prefix is updated by the blocking queries on X-Consul-Index.
+type consul struct {
+	client         *client
+	closeClient    bool
+	closed         bool
+	cancel         context.CancelFunc
+	namespace2node map[string]*kv
+	logger         contract.Logger
+}
+
+func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
+	return NewAdvanced(c, logger)
+}
+
+func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driver.Driver, error) {
+	opts := consulDriverOption{
+		token: os.Getenv("CONSUL_HTTP_TOKEN"),
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if opts.waitTime <= 0 {
+		opts.waitTime = 5 * time.Minute
+	}
+
+	if opts.loadTimeout <= 0 {
+		opts.loadTimeout = time.Minute
+	}
+
+	cli := client{
+		addr:       "http://" + c.SourceAddr(),
+		token:      opts.token,
+		datacenter: opts.datacenter,
+		http:       opts.httpClient,
+	}
+
+	if opts.tlsConfig != nil {
+		cli.addr = "https://" + c.SourceAddr()
+	}
+
+	closeClient := false
+	if cli.http == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = opts.tlsConfig
+		cli.http = &http.Client{Transport: transport}
+		closeClient = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cd := consul{
+		client:         &cli,
+		closeClient:    closeClient,
+		cancel:         cancel,
+		namespace2node: make(map[string]*kv, len(c.Configs)),
+		logger:         logger,
+	}
+
+	path2node := make(map[string]*kv, len(c.Configs))
+	for _, cfg := range c.Configs {
+		nps := cfg.Namespaces()
+
+		node, ok := path2node[cfg.Path]
+		if !ok {
+			node = newKv(cfg.Path, &cli, logger)
+			path2node[cfg.Path] = node
+
+			if opts.preload {
+				opCtx, opCancel := context.WithTimeout(ctx, opts.loadTimeout)
+				err := node.Preload(opCtx)
+				opCancel()
+				if err != nil {
+					cd.Close()
+					return nil, fmt.Errorf("preload failed: %w", err)
+				}
+			}
+		}
+
+		if cfg.Watch {
+			node.watch = true
+		}
+
+		for _, np := range nps {
+			cd.namespace2node[np] = node
+		}
+	}
+
+	if len(cd.namespace2node) == 0 {
+		cd.Close()
+		return nil, errors.New("config rules is empty")
+	}
+
+	for _, node := range path2node {
+		if node.watch {
+			go node.Watch(ctx, opts.waitTime)
+		}
+	}
+
+	return &cd, nil
+}
+
+// WatchMode returns how the changes of the namespace are detected, the watched prefix is notified by the blocking queries.
+func (c *consul) WatchMode(namespace string) driver.WatchMode {
+	node, ok := c.namespace2node[namespace]
+	if !ok || !node.watch {
+		return driver.WatchNone
+	}
+	return driver.WatchNotify
+}
+
+func (c *consul) Namespaces() []string {
+	nps := make([]string, 0, len(c.namespace2node))
+	for np := range c.namespace2node {
+		nps = append(nps, np)
+	}
+	return nps
+}
+
+func (c *consul) OnKeyChange(namespace, key string, hook func([]byte) error) bool {
+	node, ok := c.namespace2node[namespace]
+	if !ok || !node.watch {
+		return false
+	}
+
+	node.OnKeyChange(key, hook)
+	return true
+}
+
+func (c *consul) OnKeyEvent(namespace, key string, hook func(driver.KeyEvent) error) bool {
+	node, ok := c.namespace2node[namespace]
+	if !ok || !node.watch {
+		return false
+	}
+
+	node.OnKeyEvent(key, func(ev driver.KeyEvent) error {
+		ev.Namespace = namespace
+		return hook(ev)
+	})
+	return true
+}
+
+func (c *consul) OnBatchEvent(namespace string, hook func([]driver.KeyEvent) error) bool {
+	node, ok := c.namespace2node[namespace]
+	if !ok || !node.watch {
+		return false
+	}
+
+	node.OnBatchEvent(driver.WithNamespace(namespace, hook))
+	return true
+}
+
+func (c *consul) OnBatchPrepare(namespace string, hook func([]driver.KeyEvent) error) bool {
+	node, ok := c.namespace2node[namespace]
+	if !ok || !node.watch {
+		return false
+	}
+
+	node.OnBatchPrepare(driver.WithNamespace(namespace, hook))
+	return true
+}
+
+func (c *consul) Entries(ctx context.Context, namespace string) ([]driver.Entry, error) {
+	node, ok := c.namespace2node[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	return node.Entries(ctx)
+}
+
+func (c *consul) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	value, err := c.GetString(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(value), nil
+}
+
+func (c *consul) GetString(ctx context.Context, namespace, key string) (string, error) {
+	node, ok := c.namespace2node[namespace]
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	value, err := node.GetString(ctx, key)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return "", driver.ErrNotFound
+		}
+
+		return "", err
+	}
+
+	return value, nil
+}
+
+func (c *consul) Close() {
+	if c.closed {
+		return
+	}
+
+	c.cancel()
+	if c.closeClient {
+		c.client.http.CloseIdleConnections()
+	}
+	c.closed = true
+}
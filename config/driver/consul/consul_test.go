@@ -0,0 +1,267 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/olog"
+)
+
+// fakeConsul serves the get, recurse and blocking queries of the Consul KV HTTP API.
+type fakeConsul struct {
+	mu    sync.Mutex
+	kvs   map[string]kvPair
+	index uint64
+	// changed is closed and replaced on every change, it wakes up the blocking queries.
+	changed chan struct{}
+	token   string
+}
+
+func newFakeConsul(token string) *fakeConsul {
+	return &fakeConsul{kvs: make(map[string]kvPair), index: 1, changed: make(chan struct{}), token: token}
+}
+
+func (f *fakeConsul) put(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.index++
+	f.kvs[key] = kvPair{Key: key, Value: []byte(value), ModifyIndex: f.index}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) delete(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.index++
+	delete(f.kvs, key)
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("ACL not found"))
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+	if index, _ := strconv.ParseUint(query.Get("index"), 10, 64); index > 0 {
+		wait, _ := time.ParseDuration(query.Get("wait"))
+		f.mu.Lock()
+		changed := f.changed
+		blocked := index >= f.index
+		f.mu.Unlock()
+
+		if blocked {
+			select {
+			case <-changed:
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	f.mu.Lock()
+	var pairs []kvPair
+	for k, p := range f.kvs {
+		if k == key || (query.Has("recurse") && strings.HasPrefix(k, key)) {
+			pairs = append(pairs, p)
+		}
+	}
+	index := f.index
+	f.mu.Unlock()
+
+	slices.SortFunc(pairs, func(a, b kvPair) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(pairs)
+}
+
+func TestConsul(t *testing.T) {
+	fc := newFakeConsul("secret")
+	fc.put("config/app/name", "demo")
+	fc.put("config/app/port", "8080")
+	fc.put("config/app/", "")
+	fc.put("config/db/host", "localhost")
+
+	srv := httptest.NewServer(fc)
+	defer srv.Close()
+
+	c := meta.Config{
+		Source: "consul://" + strings.TrimPrefix(srv.URL, "http://"),
+		Configs: []meta.Rule{
+			{Namespace: "app", Path: "config/app/", Watch: true},
+			{Namespace: "db", Path: "/config/db/"},
+		},
+	}
+	d, err := NewAdvanced(c, olog.DynamicLogger{}, WithToken("secret"), WithPreload())
+	testz.Nil(t, err)
+	defer d.Close()
+
+	ctx := context.Background()
+	name, err := d.GetString(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo", name)
+
+	host, err := d.GetString(ctx, "db", "host")
+	testz.Nil(t, err)
+	testz.Equal(t, "localhost", host)
+
+	_, err = d.GetString(ctx, "db", "none")
+	testz.Equal(t, driver.ErrNotFound, err)
+
+	// the folder key is skipped
+	entries, err := driver.Entries(ctx, d, "app")
+	testz.Nil(t, err)
+	testz.Equal(t, 2, len(entries))
+	testz.Equal(t, "name", entries[0].Key)
+	testz.Equal(t, true, entries[1].Revision > 0)
+
+	wm := d.(driver.WatchModeReporter)
+	testz.Equal(t, driver.WatchNotify, wm.WatchMode("app"))
+	testz.Equal(t, driver.WatchNone, wm.WatchMode("db"))
+	testz.Equal(t, false, d.OnKeyChange("db", "host", func([]byte) error { return nil }))
+
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	events := make(chan driver.KeyEvent, 1)
+	testz.Equal(t, true, d.OnKeyChange("app", "name", func(b []byte) error {
+		mu.Lock()
+		names = append(names, string(b))
+		mu.Unlock()
+		return nil
+	}))
+	testz.Equal(t, true, driver.OnKeyEvent(d, "app", "port", func(ev driver.KeyEvent) error {
+		events <- ev
+		return nil
+	}))
+
+	fc.put("config/app/name", "demo2")
+	fc.put("config/db/host", "127.0.0.1")
+	fc.delete("config/app/port")
+
+	// the hooks of a blocking query are called in key order, so the name is changed before the port is deleted
+	select {
+	case ev := <-events:
+		testz.Equal(t, "app", ev.Namespace)
+		testz.Equal(t, driver.EventDeleted, ev.Type)
+		// the revision of the deletion is the index of the blocking query which observes it
+		testz.Equal(t, int64(8), ev.Revision)
+	case <-time.After(time.Second):
+		t.Fatal("the deleted key is not notified")
+	}
+
+	mu.Lock()
+	testz.Equal(t, "demo2", names[len(names)-1])
+	mu.Unlock()
+
+	name, err = d.GetString(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo2", name)
+
+	// the prefix not watched keeps the cached value
+	host, err = d.GetString(ctx, "db", "host")
+	testz.Nil(t, err)
+	testz.Equal(t, "localhost", host)
+
+	// the entries are served from the cache like GetString
+	entries, err = driver.Entries(ctx, d, "db")
+	testz.Nil(t, err)
+	testz.Equal(t, 1, len(entries))
+	testz.Equal(t, "localhost", string(entries[0].Value))
+
+	_, err = NewAdvanced(c, olog.DynamicLogger{}, WithToken("wrong"), WithPreload())
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "ACL not found"))
+}
+
+func TestKv_WatchIndexZero(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// the blocking query waits like consul, but the response has no X-Consul-Index
+		if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	k := newKv("config/app/", &client{addr: srv.URL, http: srv.Client()}, olog.DynamicLogger{})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	k.Watch(ctx, time.Minute)
+
+	// the missing index is clamped to 1, so the next query blocks instead of a hot loop
+	testz.Equal(t, int32(2), requests.Load())
+	testz.Equal(t, uint64(1), k.index)
+}
+
+func TestKv_OnBatchPrepare_CacheChanged(t *testing.T) {
+	fc := newFakeConsul("")
+	fc.put("config/app/bar", "demo2")
+
+	srv := httptest.NewServer(fc)
+	defer srv.Close()
+
+	ctx := context.Background()
+	k := newKv("config/app/", &client{addr: srv.URL, http: srv.Client()}, olog.DynamicLogger{})
+
+	var prepared [][]driver.KeyEvent
+	k.OnBatchPrepare(func(events []driver.KeyEvent) error {
+		prepared = append(prepared, events)
+		if len(prepared) == 1 {
+			// the key is cached by GetString while the changes are validated
+			_, err := k.GetString(ctx, "bar")
+			testz.Nil(t, err)
+		}
+		return nil
+	})
+
+	var batches [][]driver.KeyEvent
+	k.OnBatchEvent(func(events []driver.KeyEvent) error {
+		batches = append(batches, events)
+		return nil
+	})
+
+	k.apply([]kvPair{{Key: "config/app/bar", Value: []byte("demo10"), ModifyIndex: 3}}, 3)
+
+	// the changes are validated again on the cache changed by GetString
+	testz.Equal(t, 2, len(prepared))
+	testz.Equal(t, driver.EventCreated, prepared[0][0].Type)
+	testz.Equal(t, driver.EventUpdated, prepared[1][0].Type)
+
+	testz.Equal(t, 1, len(batches))
+	testz.Equal(t, driver.EventUpdated, batches[0][0].Type)
+	testz.Equal(t, "demo2", string(batches[0][0].OldValue))
+
+	val, err := k.GetString(ctx, "bar")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo10", val)
+}
@@ -0,0 +1,312 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/welllog/golib/strz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/contract"
+	"github.com/welllog/golt/internal/keyhook"
+)
+
+type entry struct {
+	// value is the value of the key.
+	value string
+	// exists is to distinguish the key content is empty or not exists.
+	exists bool
+	// revision is the ModifyIndex of the value.
+	revision int64
+}
+
+// kv is the cache of the keys with a prefix, the keys are cached on the first read or by preload,
+// and updated by the blocking queries of the prefix if it is watched.
+type kv struct {
+	prefix  string
+	entries map[string]*entry
+	// hooks is the hooks of the keys, the prepare hooks validate the changed keys of a blocking query before they are cached.
+	hooks *keyhook.Hooks[driver.KeyEvent]
+	// index is the X-Consul-Index of the last list, the next blocking query waits for the changes after it.
+	index uint64
+	watch bool
+	// preloaded indicates all the keys of the prefix are cached by Preload, guarded by mu.
+	preloaded bool
+
+	mu     sync.RWMutex
+	client *client
+	logger contract.Logger
+}
+
+func newKv(prefix string, client *client, logger contract.Logger) *kv {
+	prefix = strings.TrimPrefix(prefix, "/")
+	return &kv{
+		prefix:  prefix,
+		entries: make(map[string]*entry, 5),
+		hooks:   keyhook.New("prefix "+prefix, driver.KeyEvents),
+		client:  client,
+		logger:  logger,
+	}
+}
+
+// Preload loads all keys with the prefix into the cache.
+func (k *kv) Preload(ctx context.Context) error {
+	pairs, index, err := k.client.list(ctx, k.prefix, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	for _, p := range pairs {
+		key, ok := k.cacheKey(p.Key)
+		if !ok {
+			continue
+		}
+		k.entries[key] = &entry{value: string(p.Value), exists: true, revision: int64(p.ModifyIndex)}
+	}
+	k.preloaded = true
+	k.mu.Unlock()
+
+	k.index = index
+	return nil
+}
+
+// Watch runs the blocking queries of the prefix until the ctx is done, the changed keys are applied to the cache.
+func (k *kv) Watch(ctx context.Context, wait time.Duration) {
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+
+	for {
+		// the request is canceled if the agent does not respond in the wait time and its jitter
+		opCtx, cancel := context.WithTimeout(ctx, wait+wait/16+10*time.Second)
+		pairs, index, err := k.client.list(opCtx, k.prefix, k.index, wait)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			k.logger.Warnf("watch consul prefix %s failed, retry in %s: %s", k.prefix, backoff, err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		// the index 0 or missing is reset to 1, the query on the index 0 returns immediately, which would be a hot loop
+		index = max(index, 1)
+		if index == k.index {
+			// the wait time elapsed without changes
+			continue
+		}
+
+		// the index going backwards means the raft state is restored, the next query starts over
+		if index < k.index {
+			index = 1
+		}
+		k.index = index
+
+		k.apply(pairs, index)
+	}
+}
+
+// apply applies the keys of the prefix to the cache and calls the hooks of the changed keys,
+// the key not cached is ignored unless the key has hooks or the kv has batch hooks.
+// if the kv has prepare hooks, the changes are cached only if none of them returns an error.
+// index is the X-Consul-Index of the blocking query which lists the pairs.
+func (k *kv) apply(pairs []kvPair, index uint64) {
+	_ = k.hooks.Commit(&k.mu, k.logger, func() ([]driver.KeyEvent, func()) {
+		changes, changed := k.diff(pairs, index, k.hooks.Batched())
+		return changed, func() {
+			for key, e := range changes {
+				k.entries[key] = e
+			}
+		}
+	})
+}
+
+// diff compares the keys of the prefix with the cache, and returns the new entries and the changed keys ordered by key,
+// the new entries should be put into the cache to commit the changes. it should be called with lock.
+// the key not cached is compared only if it has hooks or force is true,
+// and the revision of the deleted key is the index which observes the deletion.
+func (k *kv) diff(pairs []kvPair, index uint64, force bool) (map[string]*entry, []driver.KeyEvent) {
+	var (
+		changes map[string]*entry
+		changed []driver.KeyEvent
+	)
+
+	listed := make(map[string]struct{}, len(pairs))
+	for _, p := range pairs {
+		key, ok := k.cacheKey(p.Key)
+		if !ok {
+			continue
+		}
+		listed[key] = struct{}{}
+
+		e, ok := k.entries[key]
+		if !ok && !force && !k.hooks.Watched(key) {
+			continue
+		}
+
+		ev := driver.KeyEvent{Key: key, NewValue: p.Value, Revision: int64(p.ModifyIndex)}
+		switch {
+		case e == nil || !e.exists:
+			ev.Type = driver.EventCreated
+		case e.value != strz.UnsafeString(p.Value):
+			ev.Type = driver.EventUpdated
+			ev.OldValue = []byte(e.value)
+		default:
+			continue
+		}
+
+		if changes == nil {
+			changes = make(map[string]*entry)
+		}
+		changes[key] = &entry{value: string(p.Value), exists: true, revision: int64(p.ModifyIndex)}
+		changed = append(changed, ev)
+	}
+
+	for key, e := range k.entries {
+		if _, ok := listed[key]; ok || !e.exists {
+			continue
+		}
+
+		if changes == nil {
+			changes = make(map[string]*entry)
+		}
+		changes[key] = &entry{}
+		changed = append(changed, driver.KeyEvent{
+			Key: key, Type: driver.EventDeleted, OldValue: []byte(e.value), Revision: int64(index),
+		})
+	}
+
+	slices.SortFunc(changed, func(a, b driver.KeyEvent) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return changes, changed
+}
+
+// OnKeyChange registers a hook function to be called when the key changes.
+// the key removed from consul will not trigger the hook.
+func (k *kv) OnKeyChange(key string, hook func([]byte) error) {
+	k.mu.Lock()
+	k.hooks.OnKeyChange(key, hook)
+	k.mu.Unlock()
+}
+
+// OnKeyEvent registers a hook function to be called when the key is created, updated or deleted.
+func (k *kv) OnKeyEvent(key string, hook func(driver.KeyEvent) error) {
+	k.mu.Lock()
+	k.hooks.OnKeyEvent(key, hook)
+	k.mu.Unlock()
+}
+
+// OnBatchEvent registers a hook function to be called once with all the changed keys of a blocking query.
+func (k *kv) OnBatchEvent(hook func([]driver.KeyEvent) error) {
+	k.mu.Lock()
+	k.hooks.OnBatchEvent(hook)
+	k.mu.Unlock()
+}
+
+// OnBatchPrepare registers a hook function to validate all the changed keys of a blocking query before they are cached.
+func (k *kv) OnBatchPrepare(hook func([]driver.KeyEvent) error) {
+	k.mu.Lock()
+	k.hooks.OnBatchPrepare(hook)
+	k.mu.Unlock()
+}
+
+// GetString gets the value of the key, the key not cached is read from consul and cached.
+func (k *kv) GetString(ctx context.Context, key string) (string, error) {
+	k.mu.RLock()
+	e, ok := k.entries[key]
+	k.mu.RUnlock()
+	if ok {
+		if e.exists {
+			return e.value, nil
+		}
+		return "", errNotFound
+	}
+
+	p, err := k.client.get(ctx, k.prefix+key)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			// cache the key not exists, to avoid request consul
+			k.cacheWhenNotFound(key, &entry{})
+		}
+		return "", err
+	}
+
+	value := string(p.Value)
+	k.cacheWhenNotFound(key, &entry{value: value, exists: true, revision: int64(p.ModifyIndex)})
+	return value, nil
+}
+
+// cacheWhenNotFound caches the entry if the key is not cached, the cached key is updated by the blocking queries.
+func (k *kv) cacheWhenNotFound(key string, e *entry) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.entries[key]; !ok {
+		k.entries[key] = e
+	}
+}
+
+// Entries returns the values served by GetString ordered by key.
+// the keys are read from the cache after Preload, otherwise they are listed from consul,
+// and the cached values are returned as they are, the keys cached as not exists are skipped.
+func (k *kv) Entries(ctx context.Context) ([]driver.Entry, error) {
+	k.mu.RLock()
+	preloaded := k.preloaded
+	k.mu.RUnlock()
+
+	var pairs []kvPair
+	if !preloaded {
+		var err error
+		if pairs, _, err = k.client.list(ctx, k.prefix, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	entries := make([]driver.Entry, 0, max(len(pairs), len(k.entries)))
+	for _, p := range pairs {
+		key, ok := k.cacheKey(p.Key)
+		if !ok {
+			continue
+		}
+
+		// the cached keys are appended below
+		if _, ok := k.entries[key]; !ok {
+			entries = append(entries, driver.Entry{Key: key, Value: p.Value, Revision: int64(p.ModifyIndex)})
+		}
+	}
+
+	for key, e := range k.entries {
+		if e.exists {
+			entries = append(entries, driver.Entry{Key: key, Value: []byte(e.value), Revision: e.revision})
+		}
+	}
+	slices.SortFunc(entries, func(a, b driver.Entry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return entries, nil
+}
+
+// cacheKey returns the key without the prefix, the folder key ends with "/" is skipped.
+func (k *kv) cacheKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, k.prefix) || strings.HasSuffix(key, "/") {
+		return "", false
+	}
+	return key[len(k.prefix):], true
+}
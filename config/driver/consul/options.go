@@ -0,0 +1,70 @@
+package consul
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+type Option func(*consulDriverOption)
+
+type consulDriverOption struct {
+	// token is the ACL token, default is the env CONSUL_HTTP_TOKEN.
+	token      string
+	datacenter string
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+	preload    bool
+	// waitTime is the max wait time of a blocking query.
+	waitTime time.Duration
+	// loadTimeout is the timeout of loading all keys of a prefix.
+	loadTimeout time.Duration
+}
+
+// WithToken sets the ACL token sent by the X-Consul-Token header, default is the env CONSUL_HTTP_TOKEN.
+func WithToken(token string) Option {
+	return func(o *consulDriverOption) {
+		o.token = token
+	}
+}
+
+// WithDatacenter sets the datacenter of the keys, default is the datacenter of the agent.
+func WithDatacenter(dc string) Option {
+	return func(o *consulDriverOption) {
+		o.datacenter = dc
+	}
+}
+
+// WithTLSConfig connects the agent by https with the tls config.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *consulDriverOption) {
+		o.tlsConfig = config
+	}
+}
+
+// WithHTTPClient sets the http client, the client is not closed when the driver is closed.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *consulDriverOption) {
+		o.httpClient = client
+	}
+}
+
+func WithPreload() Option {
+	return func(o *consulDriverOption) {
+		o.preload = true
+	}
+}
+
+// WithWaitTime sets the max wait time of a blocking query, default is 5 minutes.
+func WithWaitTime(wait time.Duration) Option {
+	return func(o *consulDriverOption) {
+		o.waitTime = wait
+	}
+}
+
+// WithLoadTimeout sets the timeout of loading all keys of a prefix, default is 1 minute.
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(o *consulDriverOption) {
+		o.loadTimeout = timeout
+	}
+}
@@ -16,6 +16,9 @@ var decoderMap = map[string]Decoder{
 	"toml": toml.Unmarshal,
 }
 
+// RegisterDecoder registers the decoder of the format. the builtin field extractors of json, yaml and toml
+// decode the file by the decoder registered, so the decoder of these formats must support the unmarshaler
+// interfaces of the format, LIKE: json.Unmarshaler, so that the nested values are kept in the source format.
 func RegisterDecoder(format string, fn Decoder) {
 	decoderMap[format] = fn
 }
@@ -36,3 +39,20 @@ func GetDecoderOrDefault(format string) Decoder {
 	}
 	return yaml.Unmarshal
 }
+
+// FieldExtractor splits the content of a config file into the top-level keys and their raw values,
+// LIKE: the nested value is kept as the yaml or json text. it is used by the file driver.
+type FieldExtractor func([]byte) (map[string][]byte, error)
+
+var extractorMap = map[string]FieldExtractor{}
+
+// RegisterFieldExtractor registers the extractor of the config file format, the format is the file extension without dot.
+// the file of a format which only has a decoder registered is decoded into map[string]any by the decoder.
+func RegisterFieldExtractor(format string, fn FieldExtractor) {
+	extractorMap[format] = fn
+}
+
+func GetFieldExtractor(format string) (FieldExtractor, bool) {
+	fn, ok := extractorMap[format]
+	return fn, ok
+}
@@ -0,0 +1,103 @@
+package driver
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/welllog/golib/strz"
+)
+
+// EnvelopePrefix is the prefix of the encrypted value,
+// the envelope format is enc:<decryptor>:<key id>:<base64 ciphertext>
+const EnvelopePrefix = "enc:"
+
+// Decryptor decrypts the ciphertext of the envelope with the key of keyID.
+type Decryptor interface {
+	Decrypt(keyID string, ciphertext []byte) ([]byte, error)
+}
+
+var (
+	// decryptorMu guards decryptorMap, the decryptor can be registered again to rotate the keys
+	// while the watchers decrypt the reloaded values.
+	decryptorMu  sync.RWMutex
+	decryptorMap = map[string]Decryptor{}
+)
+
+func RegisterDecryptor(name string, d Decryptor) {
+	decryptorMu.Lock()
+	decryptorMap[name] = d
+	decryptorMu.Unlock()
+}
+
+func GetDecryptor(name string) (Decryptor, bool) {
+	decryptorMu.RLock()
+	d, ok := decryptorMap[name]
+	decryptorMu.RUnlock()
+	return d, ok
+}
+
+// IsEnvelope reports whether the value is an encrypted envelope, the quoted value is also supported.
+func IsEnvelope(b []byte) bool {
+	return strings.HasPrefix(trimQuote(strz.UnsafeString(b)), EnvelopePrefix)
+}
+
+// Envelope returns the envelope of the ciphertext.
+func Envelope(name, keyID string, ciphertext []byte) string {
+	return EnvelopePrefix + name + ":" + keyID + ":" + base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+// ParseEnvelope parses the envelope into decryptor name, key id and ciphertext.
+func ParseEnvelope(s string) (name, keyID string, ciphertext []byte, err error) {
+	s = trimQuote(s)
+	if !strings.HasPrefix(s, EnvelopePrefix) {
+		return "", "", nil, errors.New("not an encrypted envelope")
+	}
+
+	parts := strings.SplitN(s[len(EnvelopePrefix):], ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return "", "", nil, errors.New("invalid encrypted envelope, expect enc:<decryptor>:<key id>:<ciphertext>")
+	}
+
+	ciphertext, err = base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid encrypted envelope ciphertext: %w", err)
+	}
+
+	return parts[0], parts[1], ciphertext, nil
+}
+
+// Decrypt decrypts the value if it is an envelope, otherwise returns the value as is.
+// the envelope without a registered decryptor returns an error, so that the ciphertext is never used as the value.
+func Decrypt(b []byte) ([]byte, error) {
+	if !IsEnvelope(b) {
+		return b, nil
+	}
+
+	name, keyID, ciphertext, err := ParseEnvelope(strz.UnsafeString(b))
+	if err != nil {
+		return nil, err
+	}
+
+	d, ok := GetDecryptor(name)
+	if !ok {
+		return nil, errors.New("unknown decryptor: " + name + ", you can register it by driver.RegisterDecryptor")
+	}
+
+	plaintext, err := d.Decrypt(keyID, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt by %s key %s failed: %w", name, keyID, err)
+	}
+	return plaintext, nil
+}
+
+func trimQuote(s string) string {
+	s = strings.TrimSpace(s)
+	n := len(s)
+	if n >= 2 && (s[0] == '"' && s[n-1] == '"' || s[0] == '\'' && s[n-1] == '\'') {
+		return s[1 : n-1]
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/welllog/golib/testz"
+)
+
+type reverseDecryptor struct{}
+
+func (reverseDecryptor) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	if keyID != "k1" {
+		return nil, errors.New("key " + keyID + " not found")
+	}
+
+	plaintext := bytes.Clone(ciphertext)
+	for i, j := 0, len(plaintext)-1; i < j; i, j = i+1, j-1 {
+		plaintext[i], plaintext[j] = plaintext[j], plaintext[i]
+	}
+	return plaintext, nil
+}
+
+func TestDecrypt(t *testing.T) {
+	defer func() {
+		decryptorMu.Lock()
+		delete(decryptorMap, "reverse")
+		decryptorMu.Unlock()
+	}()
+
+	// the envelope is never returned as the value before its decryptor is registered
+	_, err := Decrypt([]byte(Envelope("reverse", "k1", []byte("ssap"))))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "unknown decryptor"))
+
+	RegisterDecryptor("reverse", reverseDecryptor{})
+
+	b, err := Decrypt([]byte(`"` + Envelope("reverse", "k1", []byte("ssap")) + `"`))
+	testz.Nil(t, err)
+	testz.Equal(t, "pass", string(b))
+
+	b, err = Decrypt([]byte("plain"))
+	testz.Nil(t, err)
+	testz.Equal(t, "plain", string(b))
+
+	_, err = Decrypt([]byte("enc:plain"))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "invalid encrypted envelope"))
+
+	_, err = Decrypt([]byte(Envelope("unknown", "k1", []byte("ssap"))))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "unknown decryptor"))
+
+	_, err = Decrypt([]byte(Envelope("reverse", "k2", []byte("ssap"))))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "key k2 not found"))
+}
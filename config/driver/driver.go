@@ -5,8 +5,15 @@ import (
 	"errors"
 )
 
-var ErrNotFound = errors.New("not found")
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrNotSupported is returned when the driver does not implement the optional interface of the operation.
+	ErrNotSupported = errors.New("not supported")
+)
 
+// Driver is the required interface of a config source.
+// the optional features are implemented by the optional interfaces, LIKE: KeyEventWatcher, EntryLister,
+// they are checked by type assertion, so that the drivers implemented outside this module keep compiling.
 type Driver interface {
 	Namespaces() []string
 	OnKeyChange(namespace, key string, hook func([]byte) error) bool
@@ -14,3 +21,27 @@ type Driver interface {
 	GetString(ctx context.Context, namespace, key string) (string, error)
 	Close()
 }
+
+// Entry is a key and value of a namespace.
+type Entry struct {
+	Key   string
+	Value []byte
+	// Revision is the etcd mod revision, or the modify time in unix nano of the file.
+	Revision int64
+}
+
+// EntryLister is implemented by the driver that can list the keys it serves.
+type EntryLister interface {
+	// Entries returns all the keys and values of the namespace served by the driver, ordered by key.
+	// the keys are the same as the keys resolved by Get.
+	Entries(ctx context.Context, namespace string) ([]Entry, error)
+}
+
+// Entries returns the entries of the namespace by the EntryLister of the driver,
+// ErrNotSupported is returned if the driver does not implement it.
+func Entries(ctx context.Context, d Driver, namespace string) ([]Entry, error) {
+	if l, ok := d.(EntryLister); ok {
+		return l.Entries(ctx, namespace)
+	}
+	return nil, ErrNotSupported
+}
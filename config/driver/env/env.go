@@ -0,0 +1,220 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/welllog/golib/strz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/internal/dotenv"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+)
+
+var (
+	_ driver.Driver            = (*env)(nil)
+	_ driver.EntryLister       = (*env)(nil)
+	_ driver.WatchModeReporter = (*env)(nil)
+)
+
+func init() {
+	driver.RegisterDriver("env", New)
+}
+
+// env loads config from environment variables.
+// the source address is the common variable prefix, and the rule path is the variable prefix of the namespace,
+// LIKE: source env://APP_ and rule path DB_ with key host resolves APP_DB_HOST.
+type env struct {
+	namespace2node map[string]*envNode
+	normalize      func(string) string
+}
+
+type envNode struct {
+	prefix string
+	// values is the variables with prefix, the key is the variable name without prefix.
+	values map[string]string
+}
+
+func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
+	return NewAdvanced(c, logger)
+}
+
+func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driver.Driver, error) {
+	opts := envDriverOption{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if opts.keyNormalizer == nil {
+		opts.keyNormalizer = NormalizeKey
+	}
+
+	vars, err := loadVars(opts.dotEnvFiles)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range opts.dotEnvFiles {
+		logger.Infof("env config %s loads the fallback variables from %s", c.SourceAddr(), file)
+	}
+
+	ed := env{
+		namespace2node: make(map[string]*envNode, len(c.Configs)),
+		normalize:      opts.keyNormalizer,
+	}
+
+	root := c.SourceAddr()
+	path2node := make(map[string]*envNode, len(c.Configs))
+	for _, cfg := range c.Configs {
+		prefix := root + cfg.Path
+
+		node, ok := path2node[prefix]
+		if !ok {
+			node = &envNode{prefix: prefix, values: make(map[string]string)}
+			for k, v := range vars {
+				if strings.HasPrefix(k, prefix) {
+					node.values[k[len(prefix):]] = v
+				}
+			}
+			path2node[prefix] = node
+		}
+
+		if cfg.Watch {
+			logger.Warnf("env config %s not support watch", prefix)
+		}
+
+		for _, np := range cfg.Namespaces() {
+			ed.namespace2node[np] = node
+		}
+	}
+
+	if len(ed.namespace2node) == 0 {
+		return nil, errors.New("config rules is empty")
+	}
+
+	return &ed, nil
+}
+
+func (e *env) Namespaces() []string {
+	nps := make([]string, 0, len(e.namespace2node))
+	for np := range e.namespace2node {
+		nps = append(nps, np)
+	}
+	return nps
+}
+
+// OnKeyChange always returns false, because the environment variables will not change after the process starts.
+func (e *env) OnKeyChange(namespace, key string, hook func([]byte) error) bool {
+	return false
+}
+
+// WatchMode returns WatchNone, the environment variables are not watched.
+func (e *env) WatchMode(namespace string) driver.WatchMode {
+	return driver.WatchNone
+}
+
+// Entries returns the variables of the namespace by the keys resolved by Get, LIKE: APP_DB_HOST -> db_host.
+// the variable that no key resolves by the key normalizer is skipped.
+func (e *env) Entries(ctx context.Context, namespace string) ([]driver.Entry, error) {
+	node, ok := e.namespace2node[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	entries := make([]driver.Entry, 0, len(node.values))
+	for name, v := range node.values {
+		if key, ok := e.entryKey(name); ok {
+			entries = append(entries, driver.Entry{Key: key, Value: []byte(v)})
+		}
+	}
+	slices.SortFunc(entries, func(a, b driver.Entry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return entries, nil
+}
+
+// entryKey returns the key which the normalizer converts to the variable name without prefix,
+// the lower case name is preferred, so that the default normalizer resolves it.
+func (e *env) entryKey(name string) (string, bool) {
+	for _, key := range [2]string{strings.ToLower(name), name} {
+		if e.normalize(key) == name {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (e *env) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	value, err := e.GetString(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return strz.UnsafeBytes(value), nil
+}
+
+func (e *env) GetString(ctx context.Context, namespace, key string) (string, error) {
+	node, ok := e.namespace2node[namespace]
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	value, ok := node.values[e.normalize(key)]
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (e *env) Close() {}
+
+// NormalizeKey converts the config key to the environment variable name style,
+// LIKE: db.host -> DB_HOST, read-timeout -> READ_TIMEOUT.
+func NormalizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+// loadVars loads the process environment variables, the variables in .env files are used as fallback.
+func loadVars(dotEnvFiles []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		i := strings.IndexByte(kv, '=')
+		if i > 0 {
+			vars[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	for _, file := range dotEnvFiles {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read env file %s failed: %w", file, err)
+		}
+
+		m, err := dotenv.Parse(b)
+		if err != nil {
+			return nil, fmt.Errorf("parse env file %s failed: %w", file, err)
+		}
+
+		for k, v := range m {
+			if _, ok := vars[k]; !ok {
+				vars[k] = v
+			}
+		}
+	}
+
+	return vars, nil
+}
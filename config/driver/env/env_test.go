@@ -0,0 +1,129 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/olog"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	for key, name := range map[string]string{
+		"host":         "HOST",
+		"db.host":      "DB_HOST",
+		"read-timeout": "READ_TIMEOUT",
+		"Max_Conns2":   "MAX_CONNS2",
+	} {
+		testz.Equal(t, name, NormalizeKey(key))
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("GOLT_ENV_DB_HOST", "127.0.0.1")
+	t.Setenv("GOLT_ENV_DB_READ_TIMEOUT", "3s")
+	t.Setenv("GOLT_ENV_NAME", "golt")
+
+	c := meta.Config{
+		Source: "env://GOLT_ENV_",
+		Configs: []meta.Rule{
+			{Namespace: "db", Path: "DB_"},
+			{Namespace: "app", Path: ""},
+		},
+	}
+	d, err := New(c, olog.DynamicLogger{})
+	testz.Nil(t, err)
+	defer d.Close()
+
+	ctx := context.Background()
+	// the prefix of the source and the rule is stripped, and the key is mapped to the variable name
+	host, err := d.GetString(ctx, "db", "host")
+	testz.Nil(t, err)
+	testz.Equal(t, "127.0.0.1", host)
+
+	timeout, err := d.GetString(ctx, "db", "read-timeout")
+	testz.Nil(t, err)
+	testz.Equal(t, "3s", timeout)
+
+	name, err := d.GetString(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "golt", name)
+
+	// the namespace only sees the variables with its prefix
+	_, err = d.GetString(ctx, "db", "name")
+	testz.Equal(t, driver.ErrNotFound, err)
+	_, err = d.GetString(ctx, "none", "host")
+	testz.Equal(t, driver.ErrNotFound, err)
+
+	entries, err := driver.Entries(ctx, d, "db")
+	testz.Nil(t, err)
+	testz.Equal(t, []driver.Entry{
+		{Key: "host", Value: []byte("127.0.0.1")},
+		{Key: "read_timeout", Value: []byte("3s")},
+	}, entries)
+
+	testz.Equal(t, false, d.OnKeyChange("db", "host", func([]byte) error { return nil }))
+	testz.Equal(t, driver.WatchNone, d.(driver.WatchModeReporter).WatchMode("db"))
+}
+
+func TestEnv_DotEnvFiles(t *testing.T) {
+	t.Setenv("GOLT_DOTENV_HOST", "127.0.0.1")
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.env"), filepath.Join(dir, "second.env")
+	testz.Nil(t, os.WriteFile(first, []byte("GOLT_DOTENV_HOST=localhost\nGOLT_DOTENV_USER=root\n"), 0666))
+	testz.Nil(t, os.WriteFile(second, []byte("GOLT_DOTENV_USER=admin\nGOLT_DOTENV_PORT=3306\n"), 0666))
+
+	c := meta.Config{Source: "env://GOLT_DOTENV_", Configs: []meta.Rule{{Namespace: "db"}}}
+	d, err := NewAdvanced(c, olog.DynamicLogger{}, WithDotEnvFiles(first, second))
+	testz.Nil(t, err)
+	defer d.Close()
+
+	// the process environment has the highest priority, then the earlier file
+	ctx := context.Background()
+	for key, want := range map[string]string{"host": "127.0.0.1", "user": "root", "port": "3306"} {
+		value, err := d.GetString(ctx, "db", key)
+		testz.Nil(t, err)
+		testz.Equal(t, want, value)
+	}
+
+	// the files set by the option must exist
+	_, err = NewAdvanced(c, olog.DynamicLogger{}, WithDotEnvFiles(filepath.Join(dir, "none.env")))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "none.env"))
+}
+
+func TestEnv_NoDefaultDotEnv(t *testing.T) {
+	// the .env file in the working directory is not loaded without WithDotEnvFiles
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("GOLT_NODOTENV_HOST=localhost\n"), 0666))
+	wd, err := os.Getwd()
+	testz.Nil(t, err)
+	testz.Nil(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	c := meta.Config{Source: "env://GOLT_NODOTENV_", Configs: []meta.Rule{{Namespace: "db"}}}
+	d, err := New(c, olog.DynamicLogger{})
+	testz.Nil(t, err)
+	defer d.Close()
+
+	_, err = d.GetString(context.Background(), "db", "host")
+	testz.Equal(t, driver.ErrNotFound, err)
+}
+
+func TestEnv_KeyNormalizer(t *testing.T) {
+	t.Setenv("GOLT_NORM_db.host", "127.0.0.1")
+
+	c := meta.Config{Source: "env://GOLT_NORM_", Configs: []meta.Rule{{Namespace: "db"}}}
+	d, err := NewAdvanced(c, olog.DynamicLogger{}, WithKeyNormalizer(func(key string) string { return key }))
+	testz.Nil(t, err)
+	defer d.Close()
+
+	host, err := d.GetString(context.Background(), "db", "db.host")
+	testz.Nil(t, err)
+	testz.Equal(t, "127.0.0.1", host)
+}
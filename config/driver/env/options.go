@@ -0,0 +1,25 @@
+package env
+
+type Option func(*envDriverOption)
+
+type envDriverOption struct {
+	// dotEnvFiles are the .env files used as fallback when a variable is not set in the process environment,
+	// no .env file is loaded by default
+	dotEnvFiles   []string
+	keyNormalizer func(string) string
+}
+
+// WithDotEnvFiles sets the .env files used as fallback, the earlier file has higher priority.
+// the files set by this option must exist.
+func WithDotEnvFiles(files ...string) Option {
+	return func(o *envDriverOption) {
+		o.dotEnvFiles = files
+	}
+}
+
+// WithKeyNormalizer sets the function that converts a config key to the environment variable name suffix.
+func WithKeyNormalizer(fn func(string) string) Option {
+	return func(o *envDriverOption) {
+		o.keyNormalizer = fn
+	}
+}
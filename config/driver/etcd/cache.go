@@ -0,0 +1,86 @@
+package etcd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/welllog/golt/etcdutil"
+)
+
+// cacheFile is the last-known-good values of a prefix persisted in the cache dir.
+type cacheFile struct {
+	Source  string            `json:"source"`
+	Prefix  string            `json:"prefix"`
+	SavedAt time.Time         `json:"saved_at"`
+	Values  map[string]string `json:"values"`
+}
+
+// cacheStore persists the last-known-good values of the prefixes of an etcd cluster in the dir.
+type cacheStore struct {
+	dir string
+	// source identifies the etcd cluster, so that the same prefix of different clusters is cached in different files.
+	source string
+}
+
+// path returns the cache file path of the prefix, LIKE: %2Fv1%2Fapp%2F.<hash of source and prefix>.json
+func (s cacheStore) path(prefix string) string {
+	sum := sha256.Sum256([]byte(s.source + "\n" + prefix))
+	return filepath.Join(s.dir, url.PathEscape(prefix)+"."+hex.EncodeToString(sum[:8])+".json")
+}
+
+// save persists the cached values of the node, the file is replaced atomically by rename.
+func (s cacheStore) save(node *etcdutil.Kv) error {
+	b, err := json.Marshal(cacheFile{
+		Source:  s.source,
+		Prefix:  node.Prefix(),
+		SavedAt: time.Now(),
+		Values:  node.Values(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	path := s.path(node.Prefix())
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// load loads the persisted values of the node.
+func (s cacheStore) load(node *etcdutil.Kv) error {
+	b, err := os.ReadFile(s.path(node.Prefix()))
+	if err != nil {
+		return err
+	}
+
+	var cf cacheFile
+	if err := json.Unmarshal(b, &cf); err != nil {
+		return err
+	}
+
+	node.LoadValues(cf.Values)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/welllog/golib/setz"
@@ -21,6 +22,16 @@ func init() {
 
 var _ driver.Driver = (*etcd)(nil)
 
+var (
+	_ driver.KeyEventWatcher   = (*etcd)(nil)
+	_ driver.BatchEventWatcher = (*etcd)(nil)
+	_ driver.BatchPreparer     = (*etcd)(nil)
+	_ driver.EntryLister       = (*etcd)(nil)
+	_ driver.HealthReporter    = (*etcd)(nil)
+	_ driver.HistoryReader     = (*etcd)(nil)
+	_ driver.WatchModeReporter = (*etcd)(nil)
+)
+
 type etcd struct {
 	client         *clientv3.Client
 	closeClient    bool
@@ -28,6 +39,10 @@ type etcd struct {
 	cancel         context.CancelFunc
 	namespace2node map[string]*etcdutil.Kv
 	watcher        *etcdutil.Watcher
+	logger         contract.Logger
+
+	healthMu sync.RWMutex
+	health   driver.Health
 }
 
 func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
@@ -70,17 +85,41 @@ func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driv
 		opts.commonPrefixMinLen = 4
 	}
 
+	if opts.loadTimeout <= 0 {
+		opts.loadTimeout = time.Minute
+		if opts.cacheDir != "" {
+			opts.loadTimeout = 10 * time.Second
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	ed := etcd{
 		client:         opts.etcdClient,
 		closeClient:    closeClient,
 		cancel:         cancel,
 		namespace2node: make(map[string]*etcdutil.Kv, len(c.Configs)),
+		logger:         logger,
+		health:         driver.Health{Since: time.Now()},
+	}
+
+	store := cacheStore{dir: opts.cacheDir, source: c.Source}
+	if len(opts.etcdConfig.Endpoints) > 0 {
+		store.source = strings.Join(opts.etcdConfig.Endpoints, ",")
 	}
 
 	watcher := etcdutil.NewWatcher(opts.etcdClient).SetCommonPrefixMinLen(opts.commonPrefixMinLen).SetLogger(logger)
 	path2node := make(map[string]*etcdutil.Kv, len(c.Configs))
 	watchPath := make(setz.Set[string], len(c.Configs))
+	// degraded is the nodes loaded from the cache, because etcd is unreachable
+	var degraded []*etcdutil.Kv
+	// the preload of all prefixes shares one deadline if it can fall back to the cache,
+	// so the startup from the cache does not wait the timeout for each prefix.
+	preloadCtx := ctx
+	if opts.cacheDir != "" {
+		var preloadCancel context.CancelFunc
+		preloadCtx, preloadCancel = context.WithTimeout(ctx, opts.loadTimeout)
+		defer preloadCancel()
+	}
 
 	for _, cfg := range c.Configs {
 		nps := cfg.Namespaces()
@@ -91,10 +130,24 @@ func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driv
 			path2node[cfg.Path] = node
 
 			if opts.preload {
-				opCtx, opCancel := context.WithTimeout(ctx, time.Minute)
+				opCtx, opCancel := context.WithTimeout(preloadCtx, opts.loadTimeout)
 				err := node.Preload(opCtx)
 				opCancel()
+				if err == nil && opts.cacheDir != "" {
+					if err := store.save(node); err != nil {
+						logger.Warnf("save etcd cache of %s failed: %s", cfg.Path, err.Error())
+					}
+				} else if err != nil && opts.cacheDir != "" {
+					if cerr := store.load(node); cerr == nil {
+						logger.Warnf("preload %s failed: %s, start from the cache in degraded mode", cfg.Path, err.Error())
+						ed.health = driver.Health{Degraded: true, Err: err, Since: time.Now()}
+						degraded = append(degraded, node)
+						err = nil
+					}
+				}
+
 				if err != nil {
+					cancel()
 					if closeClient {
 						_ = opts.etcdClient.Close()
 					}
@@ -106,6 +159,10 @@ func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driv
 		if cfg.Watch {
 			if watchPath.Add(cfg.Path) {
 				watcher.Attach(node)
+
+				if opts.cacheDir != "" {
+					ed.persistOnChange(store, node)
+				}
 			}
 		}
 
@@ -123,9 +180,98 @@ func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driv
 		watcher.Run(ctx)
 	}
 
+	if len(degraded) > 0 {
+		go ed.reconcile(ctx, store, opts.loadTimeout, degraded)
+	}
+
 	return &ed, nil
 }
 
+// persistOnChange persists the cache of the node after the watch updates,
+// the batch hooks are only called for the committed changes, not for the changes rejected by the prepare hooks.
+func (e *etcd) persistOnChange(store cacheStore, node *etcdutil.Kv) {
+	node.OnBatchEvent(func([]etcdutil.KeyEvent) error {
+		return store.save(node)
+	})
+}
+
+// reconcile retries to load the degraded nodes from etcd until all succeed,
+// the hooks are called for the keys changed while etcd is unreachable.
+// the node whose changes are rejected by the prepare hooks keeps serving the cache, and is retried.
+func (e *etcd) reconcile(ctx context.Context, store cacheStore, timeout time.Duration, nodes []*etcdutil.Kv) {
+	const maxInterval = 30 * time.Second
+	interval := time.Second
+
+	for len(nodes) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		remain := nodes[:0]
+		for _, node := range nodes {
+			opCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := node.Reconcile(opCtx)
+			cancel()
+			if err != nil {
+				e.logger.Debugf("reconcile %s failed: %s", node.Prefix(), err.Error())
+				remain = append(remain, node)
+				continue
+			}
+
+			if err := store.save(node); err != nil {
+				e.logger.Warnf("save etcd cache of %s failed: %s", node.Prefix(), err.Error())
+			}
+		}
+		nodes = remain
+
+		interval = min(interval*2, maxInterval)
+	}
+
+	e.healthMu.Lock()
+	e.health = driver.Health{Since: time.Now()}
+	e.healthMu.Unlock()
+
+	e.logger.Infof("etcd is reachable, leave degraded mode")
+}
+
+// History returns the changes of the key from the etcd revision history which has not been compacted.
+func (e *etcd) History(ctx context.Context, namespace, key string, limit int) ([]driver.KeyEvent, error) {
+	node, ok := e.namespace2node[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	events, err := node.History(ctx, key, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]driver.KeyEvent, len(events))
+	for i, ev := range events {
+		ret[i] = keyEvent(namespace, ev)
+	}
+	return ret, nil
+}
+
+// Health reports whether the driver serves the config from the local cache.
+func (e *etcd) Health() driver.Health {
+	e.healthMu.RLock()
+	defer e.healthMu.RUnlock()
+
+	return e.health
+}
+
+// WatchMode returns how the changes of the namespace are detected, the watched prefix is notified by etcd watch.
+func (e *etcd) WatchMode(namespace string) driver.WatchMode {
+	node, ok := e.namespace2node[namespace]
+	if !ok || e.watcher == nil || !e.watcher.HasObserver(node.Prefix()) {
+		return driver.WatchNone
+	}
+	return driver.WatchNotify
+}
+
 func (e *etcd) Namespaces() []string {
 	nps := make([]string, 0, len(e.namespace2node))
 	for np := range e.namespace2node {
@@ -140,13 +286,100 @@ func (e *etcd) OnKeyChange(namespace, key string, hook func([]byte) error) bool
 		return false
 	}
 
-	if !e.watcher.HasObserver(node.Prefix()) {
+	if e.watcher == nil || !e.watcher.HasObserver(node.Prefix()) {
 		return false
 	}
 
 	return node.OnKeyChange(key, hook)
 }
 
+func (e *etcd) OnKeyEvent(namespace, key string, hook func(driver.KeyEvent) error) bool {
+	node, ok := e.namespace2node[namespace]
+	if !ok {
+		return false
+	}
+
+	if e.watcher == nil || !e.watcher.HasObserver(node.Prefix()) {
+		return false
+	}
+
+	return node.OnKeyEvent(key, func(ev etcdutil.KeyEvent) error {
+		return hook(keyEvent(namespace, ev))
+	})
+}
+
+func (e *etcd) OnBatchEvent(namespace string, hook func([]driver.KeyEvent) error) bool {
+	node, ok := e.namespace2node[namespace]
+	if !ok {
+		return false
+	}
+
+	if e.watcher == nil || !e.watcher.HasObserver(node.Prefix()) {
+		return false
+	}
+
+	return node.OnBatchEvent(batchHook(namespace, hook))
+}
+
+func (e *etcd) OnBatchPrepare(namespace string, hook func([]driver.KeyEvent) error) bool {
+	node, ok := e.namespace2node[namespace]
+	if !ok {
+		return false
+	}
+
+	if e.watcher == nil || !e.watcher.HasObserver(node.Prefix()) {
+		return false
+	}
+
+	return node.OnBatchPrepare(batchHook(namespace, hook))
+}
+
+// batchHook converts the batch hook of etcdutil.KeyEvent to driver.KeyEvent.
+func batchHook(namespace string, hook func([]driver.KeyEvent) error) func([]etcdutil.KeyEvent) error {
+	return func(events []etcdutil.KeyEvent) error {
+		batch := make([]driver.KeyEvent, len(events))
+		for i, ev := range events {
+			batch[i] = keyEvent(namespace, ev)
+		}
+		return hook(batch)
+	}
+}
+
+func keyEvent(namespace string, ev etcdutil.KeyEvent) driver.KeyEvent {
+	return driver.KeyEvent{
+		Namespace: namespace,
+		Key:       ev.Key,
+		Type:      eventTypes[ev.Type],
+		OldValue:  ev.OldValue,
+		NewValue:  ev.NewValue,
+		Revision:  ev.Revision,
+	}
+}
+
+var eventTypes = map[etcdutil.KeyEventType]driver.EventType{
+	etcdutil.KeyCreated: driver.EventCreated,
+	etcdutil.KeyUpdated: driver.EventUpdated,
+	etcdutil.KeyDeleted: driver.EventDeleted,
+}
+
+func (e *etcd) Entries(ctx context.Context, namespace string) ([]driver.Entry, error) {
+	node, ok := e.namespace2node[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	kvs, err := node.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]driver.Entry, len(kvs))
+	for i, kv := range kvs {
+		entries[i] = driver.Entry{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision}
+	}
+	return entries, nil
+}
+
 func (e *etcd) Get(ctx context.Context, namespace, key string) ([]byte, error) {
 	node, ok := e.namespace2node[namespace]
 	if !ok {
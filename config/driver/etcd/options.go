@@ -1,6 +1,10 @@
 package etcd
 
-import clientv3 "go.etcd.io/etcd/client/v3"
+import (
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
 
 type Option func(*etcdDriverOption)
 
@@ -9,6 +13,10 @@ type etcdDriverOption struct {
 	etcdConfig         clientv3.Config
 	commonPrefixMinLen int
 	preload            bool
+	// cacheDir is the dir to persist the last-known-good values, empty means disabled.
+	cacheDir string
+	// loadTimeout is the timeout of loading all keys of a prefix, or of the whole preload if cacheDir is set.
+	loadTimeout time.Duration
 	// when custom etcd client is provided, closeCustomEtcdClient indicates whether to close it when etcd driver is closed
 	closeCustomEtcdClient bool
 }
@@ -31,6 +39,24 @@ func WithPreload() Option {
 	}
 }
 
+// WithCacheDir persists the values of each prefix to the dir after successful loads and watch updates, it implies WithPreload.
+// if etcd is unreachable at startup, the driver starts from the cache in degraded mode,
+// and reconciles with etcd in background, the hooks are called for the keys changed in the meantime.
+func WithCacheDir(dir string) Option {
+	return func(o *etcdDriverOption) {
+		o.cacheDir = dir
+		o.preload = true
+	}
+}
+
+// WithLoadTimeout sets the timeout of loading all keys of a prefix, default is 1 minute.
+// with WithCacheDir, the preload of all prefixes shares the timeout before falling back to the cache, default is 10 seconds.
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(o *etcdDriverOption) {
+		o.loadTimeout = timeout
+	}
+}
+
 func WithCustomEtcdClient(client *clientv3.Client) Option {
 	return func(o *etcdDriverOption) {
 		o.etcdClient = client
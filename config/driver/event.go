@@ -0,0 +1,137 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/welllog/golt/internal/keyhook"
+)
+
+// EventType is the type of the key lifecycle event.
+type EventType int
+
+const (
+	// EventCreated means the key is created, or appears again after deleted.
+	EventCreated EventType = iota + 1
+	// EventUpdated means the value of the key is changed.
+	EventUpdated
+	// EventDeleted means the key is deleted.
+	EventDeleted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventUpdated:
+		return "updated"
+	case EventDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *EventType) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "created":
+		*t = EventCreated
+	case "updated":
+		*t = EventUpdated
+	case "deleted":
+		*t = EventDeleted
+	default:
+		return errors.New("unknown event type: " + string(b))
+	}
+	return nil
+}
+
+// KeyEvent is the lifecycle event of a key.
+type KeyEvent struct {
+	Namespace string
+	Key       string
+	Type      EventType
+	// OldValue is nil when the key is created.
+	OldValue []byte
+	// NewValue is nil when the key is deleted.
+	NewValue []byte
+	// Revision is the source revision of the change,
+	// it is the mod revision of etcd, or the modification time in unix nanoseconds of file.
+	Revision int64
+}
+
+// KeyEvents reads the KeyEvent for the hooks of the drivers caching the keys of a remote source.
+var KeyEvents = keyhook.Events[KeyEvent]{
+	Key: func(ev KeyEvent) string { return ev.Key },
+	Value: func(ev KeyEvent) ([]byte, bool) {
+		return ev.NewValue, ev.Type != EventDeleted
+	},
+	Same: func(a, b KeyEvent) bool {
+		return a.Key == b.Key && a.Type == b.Type && bytes.Equal(a.OldValue, b.OldValue) && bytes.Equal(a.NewValue, b.NewValue)
+	},
+}
+
+// KeyEventWatcher is implemented by the driver that reports the key lifecycle events.
+type KeyEventWatcher interface {
+	// OnKeyEvent registers a hook that is called when the key is created, updated or deleted.
+	OnKeyEvent(namespace, key string, hook func(KeyEvent) error) bool
+}
+
+// BatchEventWatcher is implemented by the driver that reports the changed keys of a reload together.
+type BatchEventWatcher interface {
+	// OnBatchEvent registers a hook that is called once with all the changed keys of the namespace,
+	// for each file reload or etcd watch response.
+	OnBatchEvent(namespace string, hook func([]KeyEvent) error) bool
+}
+
+// BatchPreparer is implemented by the driver that supports the two-phase reload.
+type BatchPreparer interface {
+	// OnBatchPrepare registers a hook that validates all the changed keys of the namespace before they are cached,
+	// the reload is rejected and the previous values are kept if the hook returns an error.
+	OnBatchPrepare(namespace string, hook func([]KeyEvent) error) bool
+}
+
+// OnKeyEvent registers the hook by the KeyEventWatcher of the driver.
+// the driver without it falls back to OnKeyChange, the changes are reported as EventUpdated without the old value,
+// and the deleted keys are not reported.
+func OnKeyEvent(d Driver, namespace, key string, hook func(KeyEvent) error) bool {
+	if w, ok := d.(KeyEventWatcher); ok {
+		return w.OnKeyEvent(namespace, key, hook)
+	}
+
+	return d.OnKeyChange(namespace, key, func(b []byte) error {
+		return hook(KeyEvent{Namespace: namespace, Key: key, Type: EventUpdated, NewValue: b})
+	})
+}
+
+// OnBatchEvent registers the hook by the BatchEventWatcher of the driver, false is returned if the driver does not implement it.
+func OnBatchEvent(d Driver, namespace string, hook func([]KeyEvent) error) bool {
+	if w, ok := d.(BatchEventWatcher); ok {
+		return w.OnBatchEvent(namespace, hook)
+	}
+	return false
+}
+
+// OnBatchPrepare registers the hook by the BatchPreparer of the driver, false is returned if the driver does not implement it.
+func OnBatchPrepare(d Driver, namespace string, hook func([]KeyEvent) error) bool {
+	if p, ok := d.(BatchPreparer); ok {
+		return p.OnBatchPrepare(namespace, hook)
+	}
+	return false
+}
+
+// WithNamespace wraps the batch hook to receive the events with the namespace.
+func WithNamespace(namespace string, hook func([]KeyEvent) error) func([]KeyEvent) error {
+	return func(events []KeyEvent) error {
+		batch := make([]KeyEvent, len(events))
+		for i, ev := range events {
+			ev.Namespace = namespace
+			batch[i] = ev
+		}
+		return hook(batch)
+	}
+}
@@ -2,26 +2,36 @@ package file
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/fsnotify/fsnotify"
 	"github.com/welllog/golib/mapz"
 	"github.com/welllog/golib/setz"
 	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/internal/format"
 	"github.com/welllog/golt/config/meta"
 	"github.com/welllog/golt/contract"
-	"gopkg.in/yaml.v3"
 )
 
 var _ driver.Driver = (*file)(nil)
 
+var (
+	_ driver.KeyEventWatcher   = (*file)(nil)
+	_ driver.BatchEventWatcher = (*file)(nil)
+	_ driver.BatchPreparer     = (*file)(nil)
+	_ driver.EntryLister       = (*file)(nil)
+	_ driver.WatchModeReporter = (*file)(nil)
+)
+
 func init() {
 	driver.RegisterDriver("file", New)
 }
@@ -30,18 +40,36 @@ type file struct {
 	watcher        *fsnotify.Watcher
 	mu             sync.RWMutex
 	namespace2node map[string]*fileNode
-	filepath2node  map[string]*fileNode
-	buf            map[string]*field
-	ch             chan string
-	quit           chan struct{}
-	logger         contract.Logger
+	// filepath2node maps the path of the rule to the node, the path is a file, a glob or a directory.
+	filepath2node map[string]*fileNode
+	// dirs is the watched directories, guarded by mu.
+	dirs setz.Set[string]
+	// timers delays the reload of each node path, so that the changes in a short time are reloaded once.
+	timers       *mapz.SafeKV[string, *time.Timer]
+	pollInterval time.Duration
+	ch           chan string
+	quit         chan struct{}
+	logger       contract.Logger
 }
 
 func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
+	return NewAdvanced(c, logger)
+}
+
+func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driver.Driver, error) {
+	opts := fileDriverOption{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if opts.pollInterval <= 0 {
+		opts.pollInterval = 2 * time.Second
+	}
+
 	fd := file{
 		namespace2node: make(map[string]*fileNode, len(c.Configs)),
 		filepath2node:  make(map[string]*fileNode, len(c.Configs)),
-		buf:            make(map[string]*field),
+		pollInterval:   opts.pollInterval,
 		logger:         logger,
 		quit:           make(chan struct{}),
 	}
@@ -55,22 +83,30 @@ func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
 
 		node, ok := fd.filepath2node[path]
 		if !ok {
-			err := fd.loadToBuf(path)
+			files, err := newFileSet(path, cfg.Merge)
+			if err != nil {
+				return nil, err
+			}
+
+			l, err := files.load()
 			if err != nil {
 				return nil, fmt.Errorf("load file %s failed: %w", path, err)
 			}
 
-			node = &fileNode{}
-			node.CacheFrom(fd.buf)
-			clear(fd.buf)
+			node = &fileNode{files: files, real: l.real, sum: l.sum}
+			node.CacheFrom(l.fields, l.revision)
 			fd.filepath2node[path] = node
 		}
 
-		if cfg.Watch {
+		if cfg.Watch || cfg.Poll {
 			node.watch = true
 			watch = true
 		}
 
+		if cfg.Poll {
+			node.poll = true
+		}
+
 		for _, np := range nps {
 			fd.namespace2node[np] = node
 		}
@@ -81,10 +117,7 @@ func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
 	}
 
 	if watch {
-		if err := fd.watch(); err != nil {
-			fd.Close()
-			return nil, err
-		}
+		fd.watch()
 	}
 
 	return &fd, nil
@@ -110,6 +143,57 @@ func (f *file) OnKeyChange(namespace, key string, hook func([]byte) error) bool
 	return node.OnKeyChange(key, hook)
 }
 
+func (f *file) OnKeyEvent(namespace, key string, hook func(driver.KeyEvent) error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	node, ok := f.namespace2node[namespace]
+	if !ok {
+		return false
+	}
+
+	return node.OnKeyEvent(key, func(ev driver.KeyEvent) error {
+		ev.Namespace = namespace
+		return hook(ev)
+	})
+}
+
+func (f *file) OnBatchEvent(namespace string, hook func([]driver.KeyEvent) error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	node, ok := f.namespace2node[namespace]
+	if !ok {
+		return false
+	}
+
+	return node.OnBatchEvent(driver.WithNamespace(namespace, hook))
+}
+
+func (f *file) OnBatchPrepare(namespace string, hook func([]driver.KeyEvent) error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	node, ok := f.namespace2node[namespace]
+	if !ok {
+		return false
+	}
+
+	return node.OnBatchPrepare(driver.WithNamespace(namespace, hook))
+}
+
+func (f *file) Entries(ctx context.Context, namespace string) ([]driver.Entry, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	node, ok := f.namespace2node[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	return node.Entries(), nil
+}
+
 func (f *file) Get(ctx context.Context, namespace, key string) ([]byte, error) {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
@@ -157,70 +241,85 @@ func (f *file) Close() {
 	}
 }
 
-func (f *file) loadToBuf(path string) error {
-	var fn func([]byte, any) error
-
-	ext := filepath.Ext(path)
-	switch ext {
-	case ".json":
-		fn = json.Unmarshal
-	case ".yaml", ".yml":
-		fn = yaml.Unmarshal
-	case ".toml":
-		fn = toml.Unmarshal
-	default:
-		return errors.New("file format only support json/yaml/toml, but got " + ext)
-	}
-
-	b, err := os.ReadFile(path)
+// extract extracts the top-level keys of the file content by the field extractor of the file extension.
+func extract(path string, b []byte) (map[string][]byte, error) {
+	fn, err := format.Extractor(strings.TrimPrefix(filepath.Ext(path), "."))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return fn(b, &f.buf)
+	return fn(b)
 }
 
-func (f *file) watch() error {
+// watch watches the nodes by the file system notification, the nodes with poll are watched by polling.
+// the node falls back to polling when the notification is unavailable.
+func (f *file) watch() {
+	f.ch = make(chan string)
+	f.timers = mapz.NewSafeKV[string, *time.Timer](5)
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return fmt.Errorf("new watcher failed: %w", err)
+		f.logger.Warnf("new file watcher failed: %s, fall back to polling", err.Error())
+	} else {
+		f.watcher = watcher
+		f.dirs = make(setz.Set[string], len(f.filepath2node))
 	}
-	f.watcher = watcher
-	f.ch = make(chan string)
 
-	set := make(setz.Set[string], len(f.filepath2node))
+	polling := false
 	for path, node := range f.filepath2node {
-		if node.watch {
-			dir := filepath.Dir(path)
-			if set.Add(dir) {
-				f.logger.Debugf("watch path: %s", dir)
-				err = watcher.Add(dir)
-				if err != nil {
-					return fmt.Errorf("watcher add path failed: %s", err.Error())
+		if !node.watch {
+			continue
+		}
+
+		if !node.poll && f.watcher != nil {
+			for _, dir := range node.dirs() {
+				if err := f.watchDir(dir); err != nil {
+					f.logger.Warnf("watch file %s failed: %s, fall back to polling", path, err.Error())
+					node.poll = true
+					break
 				}
 			}
 		}
+
+		node.poll = node.poll || f.watcher == nil
+		polling = polling || node.poll
 	}
 
-	go f.dedup()
+	if f.watcher != nil {
+		go f.dedup()
+	}
+
+	if polling {
+		go f.poll()
+	}
 
 	go f.listenAndRefresh()
+}
 
-	return nil
+// dirs returns the directories to watch, the directory of the symlink target is also watched.
+func (n *fileNode) dirs() []string {
+	dir := n.files.dir()
+	if n.files.kind == singleFile && n.real != "" && filepath.Dir(n.real) != dir {
+		return []string{dir, filepath.Dir(n.real)}
+	}
+	return []string{dir}
 }
 
-func (f *file) dedup() {
-	// Wait 500ms for new events; each new event resets the timer.
-	const waitFor = 500 * time.Millisecond
-	path2timers := mapz.NewSafeKV[string, *time.Timer](5)
-	eventFunc := func(name string) {
-		path2timers.Delete(name)
-		select {
-		case <-f.quit:
-		case f.ch <- name:
-		}
+// watchDir adds the directory to the watcher if it is not watched, the caller must hold the lock after watch started.
+func (f *file) watchDir(dir string) error {
+	if _, ok := f.dirs[dir]; ok {
+		return nil
 	}
 
+	f.logger.Debugf("watch path: %s", dir)
+	if err := f.watcher.Add(dir); err != nil {
+		return fmt.Errorf("watcher add path failed: %s", err.Error())
+	}
+	f.dirs.Add(dir)
+	return nil
+}
+
+func (f *file) dedup() {
 	for {
 		select {
 		case <-f.quit:
@@ -236,34 +335,193 @@ func (f *file) dedup() {
 				return
 			}
 
-			if !e.Has(fsnotify.Create) && !e.Has(fsnotify.Write) {
+			// the watched directory is removed or replaced, the watch is lost with the old directory entry
+			if (e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename)) && f.unwatchDir(e.Name) {
+				go f.rewatch(e.Name)
 				continue
 			}
 
-			node, ok := f.filepath2node[e.Name]
-			if !ok {
+			for _, path := range f.affected(e) {
+				f.schedule(path)
+			}
+		}
+	}
+}
+
+// schedule reloads the node of the path later, the changes of the node in a short time are reloaded once.
+func (f *file) schedule(path string) {
+	// Wait 500ms for new events; each new event resets the timer.
+	const waitFor = 500 * time.Millisecond
+
+	t, ok := f.timers.Get(path)
+	// No timer yet, so create one.
+	if !ok {
+		t = time.AfterFunc(waitFor, func() {
+			f.timers.Delete(path)
+			select {
+			case <-f.quit:
+			case f.ch <- path:
+			}
+		})
+		f.timers.Set(path, t)
+	} else {
+		// Reset the timer for this path, so it will start from 500ms again.
+		t.Reset(waitFor)
+	}
+}
+
+// poll checks the fingerprints of the polled nodes at the interval,
+// the changed nodes are reloaded by the same pipeline as the notified ones.
+func (f *file) poll() {
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+
+	prints := make(map[string][sha256.Size]byte)
+	for {
+		select {
+		case <-f.quit:
+			return
+		case <-ticker.C:
+		}
+
+		for path, node := range f.filepath2node {
+			if !node.watch || !node.poll {
 				continue
 			}
 
-			if !node.watch {
+			fp, err := node.files.fingerprint()
+			if err != nil {
+				f.logger.Debugf("poll file %s failed: %v", path, err)
 				continue
 			}
 
-			t, ok := path2timers.Get(e.Name)
-			// No timer yet, so create one.
-			if !ok {
-				t = time.AfterFunc(waitFor, func() {
-					eventFunc(e.Name)
-				})
-				path2timers.Set(e.Name, t)
-			} else {
-				// Reset the timer for this path, so it will start from 500ms again.
-				t.Reset(waitFor)
+			// the first poll also reloads, the reload is skipped if the content is unchanged since loaded
+			if last, ok := prints[path]; ok && last == fp {
+				continue
+			}
+			prints[path] = fp
+			f.schedule(path)
+		}
+	}
+}
+
+// WatchMode returns how the changes of the namespace are detected.
+func (f *file) WatchMode(namespace string) driver.WatchMode {
+	node, ok := f.namespace2node[namespace]
+	switch {
+	case !ok || !node.watch:
+		return driver.WatchNone
+	case node.poll:
+		return driver.WatchPoll
+	default:
+		return driver.WatchNotify
+	}
+}
+
+// unwatchDir removes the lost directory from the watched directories,
+// it reports whether the directory is the directory of a rule, which should be watched again.
+// the directory of a symlink target is watched again by the next reload which resolves the new target.
+func (f *file) unwatchDir(dir string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.dirs[dir]; !ok {
+		return false
+	}
+	delete(f.dirs, dir)
+	_ = f.watcher.Remove(dir)
+
+	for _, node := range f.filepath2node {
+		if node.watch && node.files.dir() == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// rewatch watches the directory again once it is recreated, and reloads the nodes in it.
+func (f *file) rewatch(dir string) {
+	f.logger.Warnf("watch path %s is removed or replaced, wait for it to be recreated", dir)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.quit:
+			return
+		case <-ticker.C:
+		}
+
+		f.mu.Lock()
+		err := f.watchDir(dir)
+		var paths []string
+		if err == nil {
+			for path, node := range f.filepath2node {
+				if node.watch && slices.Contains(node.dirs(), dir) {
+					paths = append(paths, path)
+				}
+			}
+		}
+		f.mu.Unlock()
+
+		if err != nil {
+			continue
+		}
+
+		for _, path := range paths {
+			select {
+			case <-f.quit:
+				return
+			case f.ch <- path:
 			}
 		}
+		return
 	}
 }
 
+// affected returns the paths of the watched nodes which may be changed by the event.
+// all the operations are concerned, because the editors write a temp file and rename it to the path,
+// and the kubernetes ConfigMap swaps the ..data symlink without any event on the path.
+// the reload is skipped if the checksum of the content is unchanged.
+func (f *file) affected(e fsnotify.Event) []string {
+	dir := filepath.Dir(e.Name)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var paths []string
+	for path, node := range f.filepath2node {
+		if !node.watch {
+			continue
+		}
+
+		if node.files.match(e.Name) || e.Name == node.real {
+			paths = append(paths, path)
+			continue
+		}
+
+		switch node.files.kind {
+		case singleFile:
+			// the symlink of the file or its parent directory may be swapped
+			if dir == filepath.Dir(path) || dir == filepath.Dir(node.real) {
+				if real, err := filepath.EvalSymlinks(path); err != nil || real != node.real {
+					paths = append(paths, path)
+				}
+			}
+		default:
+			// the hidden entry LIKE ..data is swapped, the fragments are symlinks into it
+			if dir == node.files.dir() && hidden(e.Name) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// emptyWait is the delay of the reload which found the file empty, see file.listenAndRefresh.
+const emptyWait = 500 * time.Millisecond
+
 func (f *file) listenAndRefresh() {
 	for {
 		select {
@@ -275,24 +533,81 @@ func (f *file) listenAndRefresh() {
 				continue
 			}
 
-			f.logger.Debugf("file %s changed", path)
-
-			if err := f.loadToBuf(path); err != nil {
-				f.logger.Errorf("reload file %s failed: %v", path, err)
-				clear(f.buf)
+			l, err := node.files.load()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					// the file is removed or being replaced, keep the previous values until it is recreated
+					f.logger.Debugf("file %s not exists, wait for the next change", path)
+				} else {
+					f.logger.Errorf("reload file %s failed: %v", path, err)
+				}
 				continue
 			}
 
 			f.mu.Lock()
-			node.CacheFrom(f.buf)
+			node.real = l.real
+			// the polled node resolves the new target by the fingerprint
+			if !node.poll {
+				for _, dir := range node.dirs() {
+					if err := f.watchDir(dir); err != nil {
+						f.logger.Errorf("watch the target of file %s failed: %v", path, err)
+					}
+				}
+			}
+			unchanged := l.sum == node.sum
+			// the file is truncated before written, LIKE: os.WriteFile, the empty content read in between
+			// would delete and then recreate every key, so it is applied only if the file is still empty after emptyWait.
+			truncated := !unchanged && len(l.fields) == 0 && !node.truncated && !node.empty()
+			node.truncated = truncated
 			f.mu.Unlock()
 
-			// hookFlag update not need lock, because it only set true here and set false in ExecuteHook
+			if unchanged {
+				continue
+			}
+
+			if truncated {
+				f.logger.Debugf("file %s is empty, apply it in %s if it is still empty", path, emptyWait)
+				// the deferral is bounded by the timer, it is not postponed by the debounce of the later changes
+				time.AfterFunc(emptyWait, func() {
+					select {
+					case <-f.quit:
+					case f.ch <- path:
+					}
+				})
+				continue
+			}
+
+			f.logger.Debugf("file %s changed", path)
+
+			// the prepare hooks are executed without lock, the reload is serialized by this goroutine
 			f.mu.RLock()
-			node.ExecuteHook(f.buf, f.logger)
+			prepare := node.prepareHooks
+			var events []driver.KeyEvent
+			if len(prepare) > 0 {
+				events = node.Diff(l.fields, l.revision)
+			}
 			f.mu.RUnlock()
 
-			clear(f.buf)
+			if err := prepareReload(prepare, events); err != nil {
+				f.logger.Errorf("reload file %s rejected, keep the previous values: %v", path, err)
+				continue
+			}
+
+			f.mu.Lock()
+			node.sum = l.sum
+			r := node.CacheFrom(l.fields, l.revision)
+			f.mu.Unlock()
+
+			executeHooks(r, f.logger)
 		}
 	}
 }
+
+// modTime returns the modify time in unix nano of the file, it is used as the revision of the file.
+func modTime(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.ModTime().UnixNano()
+}
@@ -2,8 +2,12 @@ package file
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"slices"
+	"strings"
 
 	"github.com/welllog/golib/strz"
+	"github.com/welllog/golt/config/driver"
 	"github.com/welllog/golt/contract"
 )
 
@@ -12,61 +16,135 @@ type entry struct {
 	value string
 	// hooks is a slice of hook functions that will be executed when the value is updated.
 	hooks []func([]byte) error
+	// eventHooks is a slice of hook functions that will be executed when the key is created, updated or deleted.
+	eventHooks []func(driver.KeyEvent) error
 
 	// exists is used to distinguish whether the value is an empty string or key does not exist.
 	exists bool
-	// hookFlag is the flag that indicates whether the hook function needs to be executed.
-	hookFlag bool
+}
+
+// watched reports whether the entry has hooks, the entry with hooks is kept after the key removed.
+func (e *entry) watched() bool {
+	return len(e.hooks) > 0 || len(e.eventHooks) > 0
 }
 
 type fileNode struct {
-	watch   bool
+	files fileSet
+	// real and sum are the resolved path and the checksum of the last load, see loaded.
+	real  string
+	sum   [sha256.Size]byte
+	watch bool
+	// poll indicates the node is watched by polling, see meta.Rule.Poll.
+	poll    bool
 	entries map[string]*entry
+	// revision is the modify time in unix nano of the file at the last load.
+	revision int64
+	// truncated indicates the last reload found the file empty and deferred it, see file.listenAndRefresh.
+	truncated bool
+	// batchHooks is a slice of hook functions that will be executed once with all the changed keys of a reload.
+	batchHooks []func([]driver.KeyEvent) error
+	// prepareHooks is a slice of hook functions that validate the changed keys before a reload is cached,
+	// the reload is rejected if any of them returns an error.
+	prepareHooks []func([]driver.KeyEvent) error
+}
+
+// hookCall is the hooks to be executed for a key change.
+type hookCall struct {
+	event      driver.KeyEvent
+	hooks      []func([]byte) error
+	eventHooks []func(driver.KeyEvent) error
+}
+
+// reload is the hooks to be executed for a file reload.
+type reload struct {
+	calls []hookCall
+	// events is all the changed keys of the reload, it is collected only if the node has batch hooks.
+	events     []driver.KeyEvent
+	batchHooks []func([]driver.KeyEvent) error
 }
 
-// CacheFrom caches the fields into the node.
-func (n *fileNode) CacheFrom(fields map[string]*field) {
+// CacheFrom caches the fields into the node, and returns the hooks of the changed keys.
+// the hooks should be executed by executeHooks without holding the lock,
+// so that the hooks can read the config or register new hooks.
+func (n *fileNode) CacheFrom(fields map[string][]byte, revision int64) reload {
 	if n.entries == nil {
 		n.entries = make(map[string]*entry, len(fields))
 	}
+	n.revision = revision
 
-	for k, v := range fields {
-		var value []byte
-		if v != nil && len(v.value) > 0 {
-			value = v.value
-		}
+	events := n.Diff(fields, revision)
+	r := reload{batchHooks: n.batchHooks}
+	for _, ev := range events {
+		e, ok := n.entries[ev.Key]
+		if ev.Type == driver.EventDeleted {
+			if !e.watched() {
+				delete(n.entries, ev.Key)
+				continue
+			}
 
-		e, ok := n.entries[k]
-		if ok {
-			if !e.exists || !bytes.Equal(strz.UnsafeBytes(e.value), value) {
-				e.exists = true
-				e.value = string(value)
-
-				if len(e.hooks) > 0 {
-					e.hookFlag = true
-				}
+			e.value = ""
+			e.exists = false
+		} else {
+			if !ok {
+				e = &entry{}
+				n.entries[ev.Key] = e
 			}
 
-			continue
+			e.value = string(ev.NewValue)
+			e.exists = true
 		}
 
-		n.entries[k] = &entry{
-			value:  string(value),
-			exists: true,
+		if e.watched() {
+			call := hookCall{event: ev, eventHooks: e.eventHooks}
+			// the key removed only triggers the event hooks
+			if ev.Type != driver.EventDeleted {
+				call.hooks = e.hooks
+			}
+			r.calls = append(r.calls, call)
 		}
 	}
 
-	for k, v := range n.entries {
-		_, ok := fields[k]
-		if !ok {
-			if len(v.hooks) == 0 {
-				delete(n.entries, k)
-			} else {
-				v.value = ""
-				v.exists = false
+	if len(r.batchHooks) > 0 {
+		r.events = events
+	}
+
+	return r
+}
+
+// Diff returns the changes of the fields against the cache without modifying it, ordered by key.
+func (n *fileNode) Diff(fields map[string][]byte, revision int64) []driver.KeyEvent {
+	var events []driver.KeyEvent
+	for k, value := range fields {
+		if len(value) == 0 {
+			value = nil
+		}
+
+		e, ok := n.entries[k]
+		if ok && e.exists {
+			if !bytes.Equal(strz.UnsafeBytes(e.value), value) {
+				events = append(events, driver.KeyEvent{
+					Key: k, Type: driver.EventUpdated, OldValue: []byte(e.value), NewValue: value, Revision: revision,
+				})
 			}
+			continue
 		}
+
+		events = append(events, driver.KeyEvent{Key: k, Type: driver.EventCreated, NewValue: value, Revision: revision})
 	}
+
+	for k, e := range n.entries {
+		if _, ok := fields[k]; !ok && e.exists {
+			events = append(events, driver.KeyEvent{
+				Key: k, Type: driver.EventDeleted, OldValue: []byte(e.value), Revision: revision,
+			})
+		}
+	}
+
+	slices.SortFunc(events, func(a, b driver.KeyEvent) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return events
 }
 
 // OnKeyChange registers a hook function that will be executed when the value of the key is updated.
@@ -76,38 +154,119 @@ func (n *fileNode) OnKeyChange(key string, hook func([]byte) error) bool {
 		return false
 	}
 
+	e := n.entry(key)
+	e.hooks = append(e.hooks, hook)
+	return true
+}
+
+// OnKeyEvent registers a hook function that will be executed when the key is created, updated or deleted.
+func (n *fileNode) OnKeyEvent(key string, hook func(driver.KeyEvent) error) bool {
+	if !n.watch {
+		return false
+	}
+
+	e := n.entry(key)
+	e.eventHooks = append(e.eventHooks, hook)
+	return true
+}
+
+// OnBatchEvent registers a hook function that will be executed once with all the changed keys of a reload.
+func (n *fileNode) OnBatchEvent(hook func([]driver.KeyEvent) error) bool {
+	if !n.watch {
+		return false
+	}
+
+	n.batchHooks = append(n.batchHooks, hook)
+	return true
+}
+
+// OnBatchPrepare registers a hook function that validates all the changed keys of a reload before they are cached.
+func (n *fileNode) OnBatchPrepare(hook func([]driver.KeyEvent) error) bool {
+	if !n.watch {
+		return false
+	}
+
+	n.prepareHooks = append(n.prepareHooks, hook)
+	return true
+}
+
+// entry returns the entry of the key, an empty entry is created if the key not exists.
+func (n *fileNode) entry(key string) *entry {
 	e, ok := n.entries[key]
 	if !ok {
 		e = &entry{}
 		n.entries[key] = e
 	}
+	return e
+}
 
-	e.hooks = append(e.hooks, hook)
+// executeHooks executes the hooks of the reload, the batch hooks are executed after the key hooks.
+func executeHooks(r reload, logger contract.Logger) {
+	for _, call := range r.calls {
+		ev := call.event
+		logger.Debugf("key %s %s", ev.Key, ev.Type)
+
+		for _, hook := range call.hooks {
+			if err := hook(ev.NewValue); err != nil {
+				logger.Warnf("key %s hook failed: %s", ev.Key, err.Error())
+			}
+		}
+
+		for _, hook := range call.eventHooks {
+			if err := hook(ev); err != nil {
+				logger.Warnf("key %s event hook failed: %s", ev.Key, err.Error())
+			}
+		}
+	}
+
+	if len(r.events) == 0 {
+		return
+	}
+
+	for _, hook := range r.batchHooks {
+		if err := hook(r.events); err != nil {
+			logger.Warnf("batch hook failed: %s", err.Error())
+		}
+	}
+}
+
+// Entries returns the existing keys and values, ordered by key.
+func (n *fileNode) Entries() []driver.Entry {
+	entries := make([]driver.Entry, 0, len(n.entries))
+	for k, e := range n.entries {
+		if e.exists {
+			entries = append(entries, driver.Entry{Key: k, Value: []byte(e.value), Revision: n.revision})
+		}
+	}
+	slices.SortFunc(entries, func(a, b driver.Entry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return entries
+}
+
+// empty reports whether the node has no existing keys.
+func (n *fileNode) empty() bool {
+	for _, e := range n.entries {
+		if e.exists {
+			return false
+		}
+	}
 	return true
 }
 
-// ExecuteHook executes the hook functions of the keys.
-func (n *fileNode) ExecuteHook(fields map[string]*field, logger contract.Logger) {
-	for k, v := range fields {
-		e, ok := n.entries[k]
-		if ok {
-			if e.hookFlag && len(e.hooks) > 0 {
-				var value []byte
-				if v != nil {
-					value = v.value
-				}
-
-				logger.Debugf("key %s changed", k)
-				for _, hook := range e.hooks {
-					if err := hook(value); err != nil {
-						logger.Warnf("key %s hook failed: %s", k, err.Error())
-					}
-				}
-			}
+// prepareReload executes the prepare hooks, and returns the first error that vetoes the reload.
+func prepareReload(hooks []func([]driver.KeyEvent) error, events []driver.KeyEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
 
-			e.hookFlag = false
+	for _, hook := range hooks {
+		if err := hook(events); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 // UnsafeGet returns the value of the key.
@@ -0,0 +1,273 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/welllog/golt/config/internal/format"
+	"github.com/welllog/golt/config/meta"
+)
+
+type fileSetKind int
+
+const (
+	singleFile fileSetKind = iota
+	globFiles
+	dirFiles
+)
+
+// fileSet is the files of a rule path: a single file, the files matched by a glob in the file name,
+// LIKE: conf.d/*.yaml, or the files of a directory. the files of a glob or directory are merged in lexical order.
+type fileSet struct {
+	path  string
+	kind  fileSetKind
+	merge string
+}
+
+func newFileSet(path, merge string) (fileSet, error) {
+	merge, err := mergePolicy(path, merge)
+	if err != nil {
+		return fileSet{}, err
+	}
+
+	s := fileSet{path: path, merge: merge}
+	if hasMeta(path) {
+		if hasMeta(filepath.Dir(path)) {
+			return fileSet{}, fmt.Errorf("glob is only supported in the file name, but got %s", path)
+		}
+
+		if _, err := filepath.Match(path, ""); err != nil {
+			return fileSet{}, fmt.Errorf("invalid glob %s: %w", path, err)
+		}
+
+		s.kind = globFiles
+		return s, nil
+	}
+
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		s.kind = dirFiles
+	}
+	return s, nil
+}
+
+// mergePolicy checks the merge policy of the rule path, the empty policy is MergeOverride.
+func mergePolicy(path, merge string) (string, error) {
+	switch merge {
+	case "":
+		return meta.MergeOverride, nil
+	case meta.MergeOverride, meta.MergeError:
+		return merge, nil
+	default:
+		return "", fmt.Errorf("unknown merge policy %s of path %s", merge, path)
+	}
+}
+
+// dir returns the directory to watch.
+func (s fileSet) dir() string {
+	if s.kind == dirFiles {
+		return s.path
+	}
+	return filepath.Dir(s.path)
+}
+
+// match reports whether the file belongs to the set, the file may have been removed.
+func (s fileSet) match(name string) bool {
+	switch s.kind {
+	case globFiles:
+		ok, _ := filepath.Match(s.path, name)
+		return ok && !hidden(name) && supported(name)
+	case dirFiles:
+		return filepath.Dir(name) == s.path && !hidden(name) && supported(name)
+	default:
+		return name == s.path
+	}
+}
+
+// files returns the existing files of the set in lexical order.
+func (s fileSet) files() ([]string, error) {
+	switch s.kind {
+	case globFiles:
+		// the glob matches nothing in the missing directory, LIKE: the typo in the path
+		if _, err := os.Stat(filepath.Dir(s.path)); err != nil {
+			return nil, err
+		}
+
+		matches, err := filepath.Glob(s.path)
+		if err != nil {
+			return nil, err
+		}
+
+		files := matches[:0]
+		for _, name := range matches {
+			if s.match(name) && isFile(name) {
+				files = append(files, name)
+			}
+		}
+		return files, nil
+	case dirFiles:
+		entries, err := os.ReadDir(s.path)
+		if err != nil {
+			return nil, err
+		}
+
+		var files []string
+		for _, e := range entries {
+			name := filepath.Join(s.path, e.Name())
+			if s.match(name) && isFile(name) {
+				files = append(files, name)
+			}
+		}
+		return files, nil
+	default:
+		return []string{s.path}, nil
+	}
+}
+
+// loaded is the merged fields of a file set.
+type loaded struct {
+	fields map[string][]byte
+	// revision is the latest modify time in unix nano of the files.
+	revision int64
+	// sum is the sha256 of the names and contents of the files, the reload is skipped if it is unchanged.
+	sum [sha256.Size]byte
+	// real is the resolved path of the single file, LIKE: the target of the kubernetes ConfigMap symlink.
+	real string
+}
+
+// load loads and merges the files. the symlink of the single file is resolved before reading,
+// so that the file is read from the same target even if the symlink is swapped during the load.
+func (s fileSet) load() (loaded, error) {
+	if s.kind == singleFile {
+		real, err := filepath.EvalSymlinks(s.path)
+		if err != nil {
+			return loaded{}, err
+		}
+
+		b, err := os.ReadFile(real)
+		if err != nil {
+			return loaded{}, err
+		}
+
+		fields, err := extract(s.path, b)
+		if err != nil {
+			return loaded{}, err
+		}
+		return loaded{fields: fields, revision: modTime(real), sum: sha256.Sum256(b), real: real}, nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return loaded{}, err
+	}
+
+	l := loaded{}
+	h := sha256.New()
+	l.fields, err = mergeFiles(files, s.merge, func(name string) ([]byte, error) {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		// the name and the content are length prefixed, so that the different splits are not the same sum
+		var size [8]byte
+		for _, part := range [2][]byte{[]byte(name), b} {
+			binary.BigEndian.PutUint64(size[:], uint64(len(part)))
+			h.Write(size[:])
+			h.Write(part)
+		}
+
+		l.revision = max(l.revision, modTime(name))
+		return b, nil
+	})
+	if err != nil {
+		return loaded{}, err
+	}
+	h.Sum(l.sum[:0])
+
+	return l, nil
+}
+
+// mergeFiles reads and extracts the files in order, and merges the fields by the merge policy.
+func mergeFiles(files []string, merge string, read func(name string) ([]byte, error)) (map[string][]byte, error) {
+	merged := make(map[string][]byte)
+	// owners is the file of each key, it is used to report the conflict
+	owners := make(map[string]string)
+	for _, name := range files {
+		b, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+
+		fields, err := extract(name, b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		for k, v := range fields {
+			if owner, ok := owners[k]; ok && merge == meta.MergeError {
+				return nil, fmt.Errorf("key %s is defined in both %s and %s", k, owner, name)
+			}
+			merged[k] = v
+			owners[k] = name
+		}
+	}
+	return merged, nil
+}
+
+// fingerprint returns the sha256 of the resolved names, modify times, sizes and contents of the files,
+// it is compared by the polling watcher to detect the changes.
+func (s fileSet) fingerprint() ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	files, err := s.files()
+	if err != nil {
+		return sum, err
+	}
+
+	h := sha256.New()
+	for _, name := range files {
+		real, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			return sum, err
+		}
+
+		fi, err := os.Stat(real)
+		if err != nil {
+			return sum, err
+		}
+
+		b, err := os.ReadFile(real)
+		if err != nil {
+			return sum, err
+		}
+
+		fmt.Fprintf(h, "%s %d %d\n", real, fi.ModTime().UnixNano(), fi.Size())
+		h.Write(b)
+	}
+	h.Sum(sum[:0])
+
+	return sum, nil
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// hidden reports whether the file name starts with a dot, LIKE: the swap files of the editors.
+func hidden(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), ".")
+}
+
+// supported reports whether the format of the file can be extracted.
+func supported(name string) bool {
+	_, err := format.Extractor(strings.TrimPrefix(filepath.Ext(name), "."))
+	return err == nil
+}
+
+func isFile(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
@@ -0,0 +1,203 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sync"
+
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+)
+
+var (
+	_ driver.Driver            = (*fsDriver)(nil)
+	_ driver.EntryLister       = (*fsDriver)(nil)
+	_ driver.WatchModeReporter = (*fsDriver)(nil)
+)
+
+func init() {
+	driver.RegisterDriver("embed", NewFS)
+}
+
+var (
+	fsMu  sync.RWMutex
+	fsMap = make(map[string]fs.FS)
+)
+
+// RegisterFS registers the fs.FS under the name, so that the rules can be loaded from it by the source embed://name, LIKE:
+//
+//	//go:embed defaults
+//	var defaults embed.FS
+//
+//	file.RegisterFS("defaults", defaults)
+//
+// the rule path is the slash-separated path in the fs.FS, the glob and directory paths are supported like the file source.
+// the fs.FS can not notify the changes, so the namespaces are not watched.
+func RegisterFS(name string, fsys fs.FS) {
+	fsMu.Lock()
+	defer fsMu.Unlock()
+
+	fsMap[name] = fsys
+}
+
+// fsDriver serves the config files of a registered fs.FS, the values are loaded once.
+type fsDriver struct {
+	namespace2node map[string]*fileNode
+}
+
+func NewFS(c meta.Config, logger contract.Logger) (driver.Driver, error) {
+	fsMu.RLock()
+	fsys, ok := fsMap[c.SourceAddr()]
+	fsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("fs %s is not registered, register it by file.RegisterFS", c.SourceAddr())
+	}
+
+	fd := fsDriver{
+		namespace2node: make(map[string]*fileNode, len(c.Configs)),
+	}
+
+	path2node := make(map[string]*fileNode, len(c.Configs))
+	for _, cfg := range c.Configs {
+		name := path.Clean(cfg.Path)
+		if cfg.Watch || cfg.Poll {
+			logger.Warnf("%s can not notify the changes, watch of %s is ignored", c.Source, name)
+		}
+
+		node, ok := path2node[name]
+		if !ok {
+			fields, err := loadFS(fsys, name, cfg.Merge)
+			if err != nil {
+				return nil, fmt.Errorf("load file %s from %s failed: %w", name, c.Source, err)
+			}
+
+			node = &fileNode{}
+			node.CacheFrom(fields, modTimeFS(fsys, name))
+			path2node[name] = node
+		}
+
+		for _, np := range cfg.Namespaces() {
+			fd.namespace2node[np] = node
+		}
+	}
+
+	if len(fd.namespace2node) == 0 {
+		return nil, errors.New("config rules is empty")
+	}
+
+	return &fd, nil
+}
+
+// loadFS loads the file, or merges the files matched by the glob or in the directory in lexical order.
+func loadFS(fsys fs.FS, name, merge string) (map[string][]byte, error) {
+	merge, err := mergePolicy(name, merge)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	if hasMeta(name) {
+		if _, err := fs.Stat(fsys, path.Dir(name)); err != nil {
+			return nil, err
+		}
+
+		matches, err := fs.Glob(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			if fi, err := fs.Stat(fsys, m); err == nil && fi.Mode().IsRegular() && !hidden(m) && supported(m) {
+				files = append(files, m)
+			}
+		}
+	} else if fi, err := fs.Stat(fsys, name); err == nil && fi.IsDir() {
+		entries, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if e.Type().IsRegular() && !hidden(e.Name()) && supported(e.Name()) {
+				files = append(files, path.Join(name, e.Name()))
+			}
+		}
+	} else {
+		files = []string{name}
+	}
+	slices.Sort(files)
+
+	return mergeFiles(files, merge, func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	})
+}
+
+// modTimeFS returns the modify time in unix nano of the file in the fs.FS, it is 0 for the embed.FS.
+func modTimeFS(fsys fs.FS, name string) int64 {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil || fi.ModTime().IsZero() {
+		return 0
+	}
+	return fi.ModTime().UnixNano()
+}
+
+func (f *fsDriver) Namespaces() []string {
+	nps := make([]string, 0, len(f.namespace2node))
+	for np := range f.namespace2node {
+		nps = append(nps, np)
+	}
+	return nps
+}
+
+func (f *fsDriver) OnKeyChange(namespace, key string, hook func([]byte) error) bool {
+	return false
+}
+
+// WatchMode returns WatchNone, the fs.FS can not notify the changes.
+func (f *fsDriver) WatchMode(namespace string) driver.WatchMode {
+	return driver.WatchNone
+}
+
+func (f *fsDriver) Entries(ctx context.Context, namespace string) ([]driver.Entry, error) {
+	node, ok := f.namespace2node[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	return node.Entries(), nil
+}
+
+func (f *fsDriver) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	node, ok := f.namespace2node[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	b, ok := node.UnsafeGet(key)
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	return b, nil
+}
+
+func (f *fsDriver) GetString(ctx context.Context, namespace, key string) (string, error) {
+	node, ok := f.namespace2node[namespace]
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	value, ok := node.GetString(key)
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (f *fsDriver) Close() {}
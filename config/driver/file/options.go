@@ -0,0 +1,18 @@
+package file
+
+import "time"
+
+type Option func(*fileDriverOption)
+
+type fileDriverOption struct {
+	// pollInterval is the interval of the polling watcher.
+	pollInterval time.Duration
+}
+
+// WithPollInterval sets the interval of the polling watcher, default is 2 seconds.
+// the polling watcher is used by the rules with poll, or when the file system notification is unavailable.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *fileDriverOption) {
+		o.pollInterval = interval
+	}
+}
@@ -0,0 +1,35 @@
+package driver
+
+import "time"
+
+// Health is the health of a driver.
+type Health struct {
+	// Degraded indicates the driver serves the config from the local cache, because the source is unreachable.
+	Degraded bool
+	// Err is the reason of the degraded mode.
+	Err error
+	// Since is the time the driver entered the current state.
+	Since time.Time
+}
+
+// HealthReporter is implemented by the driver that can run in degraded mode.
+type HealthReporter interface {
+	Health() Health
+}
+
+// WatchMode is how a driver detects the changes of a namespace.
+type WatchMode string
+
+const (
+	// WatchNone means the namespace is not watched.
+	WatchNone WatchMode = "none"
+	// WatchNotify means the changes are notified by the source, LIKE: fsnotify, etcd watch.
+	WatchNotify WatchMode = "notify"
+	// WatchPoll means the changes are detected by polling the source at an interval.
+	WatchPoll WatchMode = "poll"
+)
+
+// WatchModeReporter is implemented by the driver that can report how the changes of a namespace are detected.
+type WatchModeReporter interface {
+	WatchMode(namespace string) WatchMode
+}
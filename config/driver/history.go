@@ -0,0 +1,10 @@
+package driver
+
+import "context"
+
+// HistoryReader is implemented by the driver that keeps the revision history of the keys, LIKE: etcd.
+type HistoryReader interface {
+	// History returns at most limit changes of the key, ordered from old to new.
+	// the history before the source compaction is not returned.
+	History(ctx context.Context, namespace, key string, limit int) ([]KeyEvent, error)
+}
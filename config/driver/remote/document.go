@@ -0,0 +1,144 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/welllog/golib/strz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/contract"
+	"github.com/welllog/golt/internal/keyhook"
+)
+
+// document is the cache of the top-level keys of a document, the watched document is updated by polling.
+type document struct {
+	url     string
+	entries map[string]string
+	// revision is the Last-Modified in unix nano of the last applied fetch, or the time of the fetch if it is absent.
+	revision int64
+	// hooks is the hooks of the keys, the prepare hooks validate the changed keys of a fetch before they are cached.
+	hooks *keyhook.Hooks[driver.KeyEvent]
+	watch bool
+
+	// etag, lastModified and sum are the validators and the checksum of the last applied fetch,
+	// they are only accessed by the poll goroutine after the driver is created.
+	etag         string
+	lastModified string
+	sum          [sha256.Size]byte
+
+	mu     sync.RWMutex
+	logger contract.Logger
+}
+
+func newDocument(url string, logger contract.Logger) *document {
+	return &document{
+		url:     url,
+		entries: make(map[string]string),
+		hooks:   keyhook.New("document "+url, driver.KeyEvents),
+		logger:  logger,
+	}
+}
+
+// apply caches the keys of the fetched document and calls the hooks of the changed keys,
+// false is returned if the changes are rejected by the prepare hooks, the previous values are kept.
+func (d *document) apply(res fetched) bool {
+	err := d.hooks.Commit(&d.mu, d.logger, func() ([]driver.KeyEvent, func()) {
+		return d.diff(res.fields, res.revision), func() {
+			entries := make(map[string]string, len(res.fields))
+			for k, v := range res.fields {
+				entries[k] = string(v)
+			}
+			d.entries = entries
+			d.revision = res.revision
+		}
+	})
+	return err == nil
+}
+
+// diff returns the changes of the fields against the cache, ordered by key. it should be called with lock.
+func (d *document) diff(fields map[string][]byte, revision int64) []driver.KeyEvent {
+	var changed []driver.KeyEvent
+	for k, value := range fields {
+		if len(value) == 0 {
+			value = nil
+		}
+
+		old, ok := d.entries[k]
+		switch {
+		case !ok:
+			changed = append(changed, driver.KeyEvent{Key: k, Type: driver.EventCreated, NewValue: value, Revision: revision})
+		case old != strz.UnsafeString(value):
+			changed = append(changed, driver.KeyEvent{
+				Key: k, Type: driver.EventUpdated, OldValue: []byte(old), NewValue: value, Revision: revision,
+			})
+		}
+	}
+
+	for k, old := range d.entries {
+		if _, ok := fields[k]; !ok {
+			changed = append(changed, driver.KeyEvent{Key: k, Type: driver.EventDeleted, OldValue: []byte(old), Revision: revision})
+		}
+	}
+
+	slices.SortFunc(changed, func(a, b driver.KeyEvent) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return changed
+}
+
+// OnKeyChange registers a hook function to be called when the key changes.
+// the key removed from the document will not trigger the hook.
+func (d *document) OnKeyChange(key string, hook func([]byte) error) {
+	d.mu.Lock()
+	d.hooks.OnKeyChange(key, hook)
+	d.mu.Unlock()
+}
+
+// OnKeyEvent registers a hook function to be called when the key is created, updated or deleted.
+func (d *document) OnKeyEvent(key string, hook func(driver.KeyEvent) error) {
+	d.mu.Lock()
+	d.hooks.OnKeyEvent(key, hook)
+	d.mu.Unlock()
+}
+
+// OnBatchEvent registers a hook function to be called once with all the changed keys of a fetch.
+func (d *document) OnBatchEvent(hook func([]driver.KeyEvent) error) {
+	d.mu.Lock()
+	d.hooks.OnBatchEvent(hook)
+	d.mu.Unlock()
+}
+
+// OnBatchPrepare registers a hook function to validate all the changed keys of a fetch before they are cached.
+func (d *document) OnBatchPrepare(hook func([]driver.KeyEvent) error) {
+	d.mu.Lock()
+	d.hooks.OnBatchPrepare(hook)
+	d.mu.Unlock()
+}
+
+// GetString returns the value of the key.
+func (d *document) GetString(key string) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	value, ok := d.entries[key]
+	return value, ok
+}
+
+// Entries returns the keys and values, ordered by key.
+func (d *document) Entries() []driver.Entry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entries := make([]driver.Entry, 0, len(d.entries))
+	for k, v := range d.entries {
+		entries = append(entries, driver.Entry{Key: k, Value: []byte(v), Revision: d.revision})
+	}
+	slices.SortFunc(entries, func(a, b driver.Entry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return entries
+}
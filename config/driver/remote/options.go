@@ -0,0 +1,71 @@
+package remote
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+type Option func(*remoteDriverOption)
+
+type remoteDriverOption struct {
+	// pollInterval is the interval of polling the watched documents.
+	pollInterval time.Duration
+	// httpClient is the client of the requests, it overrides tlsConfig.
+	httpClient *http.Client
+	// header is the headers of every request, LIKE: Authorization.
+	header    http.Header
+	tlsConfig *tls.Config
+	// timeout is the timeout of a request.
+	timeout time.Duration
+	// retries is the number of retries of a failed request, the backoff is doubled after each retry.
+	retries      int
+	retryBackoff time.Duration
+}
+
+// WithPollInterval sets the interval of polling the watched documents, default is 10 seconds.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *remoteDriverOption) {
+		o.pollInterval = interval
+	}
+}
+
+// WithHTTPClient sets the client of the requests, the client is not closed when the driver is closed.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *remoteDriverOption) {
+		o.httpClient = client
+	}
+}
+
+// WithHeader adds the header to every request, LIKE: Authorization: Bearer xxx.
+func WithHeader(key, value string) Option {
+	return func(o *remoteDriverOption) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Add(key, value)
+	}
+}
+
+// WithTLSConfig sets the tls config of the https requests, LIKE: the private CA or the client certificate.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *remoteDriverOption) {
+		o.tlsConfig = config
+	}
+}
+
+// WithTimeout sets the timeout of a request, default is 10 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *remoteDriverOption) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetry sets the number of retries of a failed request and the first backoff,
+// default is 2 retries from 500 milliseconds. the network errors, 429 and 5xx responses are retried.
+func WithRetry(retries int, backoff time.Duration) Option {
+	return func(o *remoteDriverOption) {
+		o.retries = retries
+		o.retryBackoff = backoff
+	}
+}
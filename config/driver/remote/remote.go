@@ -0,0 +1,430 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/welllog/golib/strz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/internal/format"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+)
+
+var (
+	_ driver.Driver            = (*remote)(nil)
+	_ driver.KeyEventWatcher   = (*remote)(nil)
+	_ driver.BatchEventWatcher = (*remote)(nil)
+	_ driver.BatchPreparer     = (*remote)(nil)
+	_ driver.EntryLister       = (*remote)(nil)
+	_ driver.WatchModeReporter = (*remote)(nil)
+)
+
+func init() {
+	driver.RegisterDriver("http", New)
+	driver.RegisterDriver("https", New)
+}
+
+// maxRetryBackoff is the max backoff between the retries of a request.
+const maxRetryBackoff = 30 * time.Second
+
+// fetched is the result of a request, notModified indicates the document is unchanged since the last applied fetch.
+type fetched struct {
+	fields       map[string][]byte
+	revision     int64
+	sum          [sha256.Size]byte
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+// remote serves the documents of the http(s) urls, the top-level keys of a document are the keys of the namespace, LIKE:
+//
+//	source: https://config.internal/v1/
+//	configs:
+//	  - namespace: app
+//	    path: app.yaml
+//	    watch: true
+//
+// the rule path is joined to the source, or it is an absolute url. the format of the document is decided by
+// the extension of the url path, or by the Content-Type of the response.
+// the watched documents are polled by the conditional requests with If-None-Match and If-Modified-Since.
+type remote struct {
+	client        *http.Client
+	closeClient   bool
+	header        http.Header
+	timeout       time.Duration
+	retries       int
+	retryBackoff  time.Duration
+	pollInterval  time.Duration
+	namespace2doc map[string]*document
+	url2doc       map[string]*document
+	// ctx is canceled when the driver is closed, it cancels the pending requests.
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger contract.Logger
+}
+
+func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
+	return NewAdvanced(c, logger)
+}
+
+func NewAdvanced(c meta.Config, logger contract.Logger, options ...Option) (driver.Driver, error) {
+	opts := remoteDriverOption{
+		retries:      2,
+		retryBackoff: 500 * time.Millisecond,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if opts.pollInterval <= 0 {
+		opts.pollInterval = 10 * time.Second
+	}
+
+	if opts.timeout <= 0 {
+		opts.timeout = 10 * time.Second
+	}
+
+	if opts.retryBackoff <= 0 {
+		opts.retryBackoff = 500 * time.Millisecond
+	}
+
+	r := remote{
+		client:        opts.httpClient,
+		header:        opts.header,
+		timeout:       opts.timeout,
+		retries:       opts.retries,
+		retryBackoff:  opts.retryBackoff,
+		pollInterval:  opts.pollInterval,
+		namespace2doc: make(map[string]*document, len(c.Configs)),
+		url2doc:       make(map[string]*document, len(c.Configs)),
+		logger:        logger,
+	}
+
+	if r.client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = opts.tlsConfig
+		r.client = &http.Client{Transport: transport}
+		r.closeClient = true
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	watch := false
+	for _, cfg := range c.Configs {
+		u := documentURL(c.Source, cfg.Path)
+
+		doc, ok := r.url2doc[u]
+		if !ok {
+			doc = newDocument(u, logger)
+			res, err := r.fetch(doc)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("load %s failed: %w", u, err)
+			}
+
+			doc.apply(res)
+			doc.etag, doc.lastModified, doc.sum = res.etag, res.lastModified, res.sum
+			r.url2doc[u] = doc
+		}
+
+		if cfg.Watch || cfg.Poll {
+			doc.watch = true
+			watch = true
+		}
+
+		for _, np := range cfg.Namespaces() {
+			r.namespace2doc[np] = doc
+		}
+	}
+
+	if len(r.namespace2doc) == 0 {
+		r.Close()
+		return nil, errors.New("config rules is empty")
+	}
+
+	if watch {
+		go r.poll()
+	}
+
+	return &r, nil
+}
+
+// documentURL joins the rule path to the source, the rule path of an absolute url is used as is.
+func documentURL(source, rulePath string) string {
+	if strings.HasPrefix(rulePath, "http://") || strings.HasPrefix(rulePath, "https://") {
+		return rulePath
+	}
+
+	if rulePath == "" {
+		return source
+	}
+	return strings.TrimSuffix(source, "/") + "/" + strings.TrimPrefix(rulePath, "/")
+}
+
+// fetch requests the document, the failed request is retried with backoff.
+func (r *remote) fetch(doc *document) (fetched, error) {
+	backoff := r.retryBackoff
+	for i := 0; ; i++ {
+		res, retry, err := r.fetchOnce(doc)
+		if err == nil || !retry || i >= r.retries {
+			return res, err
+		}
+
+		r.logger.Debugf("request %s failed, retry in %s: %v", doc.url, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return res, err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// fetchOnce requests the document with the validators of the last applied fetch, and reports whether the error can be retried.
+func (r *remote) fetchOnce(doc *document) (fetched, bool, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.url, nil)
+	if err != nil {
+		return fetched{}, false, err
+	}
+
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	if doc.etag != "" {
+		req.Header.Set("If-None-Match", doc.etag)
+	}
+	if doc.lastModified != "" {
+		req.Header.Set("If-Modified-Since", doc.lastModified)
+	}
+
+	rsp, err := r.client.Do(req)
+	if err != nil {
+		return fetched{}, r.ctx.Err() == nil, err
+	}
+	defer rsp.Body.Close()
+
+	switch {
+	case rsp.StatusCode == http.StatusNotModified:
+		return fetched{notModified: true}, false, nil
+	case rsp.StatusCode != http.StatusOK:
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		retry := rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= http.StatusInternalServerError
+		return fetched{}, retry, fmt.Errorf("unexpected status %s", rsp.Status)
+	}
+
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return fetched{}, true, err
+	}
+
+	fn, err := format.Extractor(documentFormat(doc.url, rsp.Header.Get("Content-Type")))
+	if err != nil {
+		return fetched{}, false, err
+	}
+
+	fields, err := fn(b)
+	if err != nil {
+		return fetched{}, false, err
+	}
+
+	res := fetched{
+		fields:       fields,
+		revision:     time.Now().UnixNano(),
+		sum:          sha256.Sum256(b),
+		etag:         rsp.Header.Get("ETag"),
+		lastModified: rsp.Header.Get("Last-Modified"),
+	}
+	if t, err := http.ParseTime(res.lastModified); err == nil {
+		res.revision = t.UnixNano()
+	}
+	return res, false, nil
+}
+
+// documentFormat returns the format of the document by the extension of the url path,
+// or by the Content-Type of the response, LIKE: application/json, application/yaml.
+func documentFormat(rawURL, contentType string) string {
+	var ext string
+	if u, err := url.Parse(rawURL); err == nil {
+		ext = strings.TrimPrefix(path.Ext(u.Path), ".")
+		if _, err := format.Extractor(ext); err == nil {
+			return ext
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		return "json"
+	case strings.HasSuffix(mediaType, "yaml"):
+		return "yaml"
+	case strings.HasSuffix(mediaType, "toml"):
+		return "toml"
+	case strings.HasSuffix(mediaType, "properties"):
+		return "properties"
+	}
+
+	if ext != "" {
+		return ext
+	}
+	return mediaType
+}
+
+// poll requests the watched documents at the interval, the changed documents are reloaded.
+func (r *remote) poll() {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, doc := range r.url2doc {
+			if doc.watch {
+				r.refresh(doc)
+			}
+		}
+	}
+}
+
+// refresh reloads the document if it is changed, the previous values are kept if the request fails.
+// the validators are advanced only after the changes are applied,
+// so that the version rejected by the prepare hooks is fetched and validated again by the next poll.
+func (r *remote) refresh(doc *document) {
+	res, err := r.fetch(doc)
+	if err != nil {
+		if r.ctx.Err() == nil {
+			r.logger.Errorf("poll %s failed, keep the previous values: %v", doc.url, err)
+		}
+		return
+	}
+
+	if res.notModified {
+		return
+	}
+
+	if res.sum != doc.sum {
+		r.logger.Debugf("%s changed", doc.url)
+		if !doc.apply(res) {
+			return
+		}
+		doc.sum = res.sum
+	}
+	doc.etag, doc.lastModified = res.etag, res.lastModified
+}
+
+func (r *remote) Namespaces() []string {
+	nps := make([]string, 0, len(r.namespace2doc))
+	for np := range r.namespace2doc {
+		nps = append(nps, np)
+	}
+	return nps
+}
+
+func (r *remote) OnKeyChange(namespace, key string, hook func([]byte) error) bool {
+	doc, ok := r.namespace2doc[namespace]
+	if !ok || !doc.watch {
+		return false
+	}
+
+	doc.OnKeyChange(key, hook)
+	return true
+}
+
+func (r *remote) OnKeyEvent(namespace, key string, hook func(driver.KeyEvent) error) bool {
+	doc, ok := r.namespace2doc[namespace]
+	if !ok || !doc.watch {
+		return false
+	}
+
+	doc.OnKeyEvent(key, func(ev driver.KeyEvent) error {
+		ev.Namespace = namespace
+		return hook(ev)
+	})
+	return true
+}
+
+func (r *remote) OnBatchEvent(namespace string, hook func([]driver.KeyEvent) error) bool {
+	doc, ok := r.namespace2doc[namespace]
+	if !ok || !doc.watch {
+		return false
+	}
+
+	doc.OnBatchEvent(driver.WithNamespace(namespace, hook))
+	return true
+}
+
+func (r *remote) OnBatchPrepare(namespace string, hook func([]driver.KeyEvent) error) bool {
+	doc, ok := r.namespace2doc[namespace]
+	if !ok || !doc.watch {
+		return false
+	}
+
+	doc.OnBatchPrepare(driver.WithNamespace(namespace, hook))
+	return true
+}
+
+// WatchMode returns WatchPoll for the watched namespace, the http source can not notify the changes.
+func (r *remote) WatchMode(namespace string) driver.WatchMode {
+	doc, ok := r.namespace2doc[namespace]
+	if !ok || !doc.watch {
+		return driver.WatchNone
+	}
+	return driver.WatchPoll
+}
+
+func (r *remote) Entries(ctx context.Context, namespace string) ([]driver.Entry, error) {
+	doc, ok := r.namespace2doc[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	return doc.Entries(), nil
+}
+
+func (r *remote) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	value, err := r.GetString(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return strz.UnsafeBytes(value), nil
+}
+
+func (r *remote) GetString(ctx context.Context, namespace, key string) (string, error) {
+	doc, ok := r.namespace2doc[namespace]
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	value, ok := doc.GetString(key)
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (r *remote) Close() {
+	r.cancel()
+	if r.closeClient {
+		r.client.CloseIdleConnections()
+	}
+}
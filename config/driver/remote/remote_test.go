@@ -0,0 +1,90 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/olog"
+)
+
+// eventually waits until the cond is true, the test fails if the cond is still false after a second.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRemote_RejectedRefetched(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		doc     = "name: v1\n"
+		etag    = `"v1"`
+		fetches = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fetches[etag]++
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+
+	d, err := NewAdvanced(meta.Config{
+		Source:  srv.URL,
+		Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+	}, olog.DynamicLogger{}, WithPollInterval(10*time.Millisecond))
+	testz.Nil(t, err)
+	defer d.Close()
+
+	var reject atomic.Bool
+	reject.Store(true)
+	testz.Equal(t, true, driver.OnBatchPrepare(d, "app", func([]driver.KeyEvent) error {
+		if reject.Load() {
+			return errors.New("rejected")
+		}
+		return nil
+	}))
+
+	mu.Lock()
+	doc, etag = "name: v2\n", `"v2"`
+	mu.Unlock()
+
+	// the rejected version is fetched again instead of being not modified
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches[`"v2"`] >= 2
+	})
+
+	ctx := context.Background()
+	name, err := d.GetString(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "v1", name)
+
+	reject.Store(false)
+	eventually(t, func() bool {
+		name, _ := d.GetString(ctx, "app", "name")
+		return name == "v2"
+	})
+}
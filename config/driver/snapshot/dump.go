@@ -0,0 +1,72 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// Snapshot is the effective config of all namespaces at a moment.
+type Snapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Namespaces maps the namespace to its keys and values.
+	Namespaces map[string]map[string]Value `json:"namespaces"`
+	// Unsupported maps the namespace to the sources of its layers which can not list the keys,
+	// the keys of these layers are missing from the snapshot.
+	Unsupported map[string][]string `json:"unsupported,omitempty"`
+}
+
+// Value is the effective value of a key in the snapshot.
+type Value struct {
+	Value string `json:"value"`
+	// Source is the source of the layer that serves the value, LIKE: file://etc/, etcd://127.0.0.1:2379
+	Source string `json:"source"`
+	// Revision is the etcd mod revision, or the modify time in unix nano of the file.
+	Revision int64 `json:"revision,omitempty"`
+	// Secret indicates the value is an encrypted envelope, it is kept encrypted or redacted.
+	Secret bool `json:"secret,omitempty"`
+	// Redacted indicates the value of the secret is removed from the snapshot.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Read reads the snapshot from the reader.
+func Read(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ReadFile reads the snapshot from the file.
+func ReadFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Write writes the snapshot as indented json.
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// WriteFile writes the snapshot to the file, the file is created with 0600 because it may contain secrets.
+func (s *Snapshot) WriteFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
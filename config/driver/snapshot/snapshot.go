@@ -0,0 +1,133 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/welllog/golib/strz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+)
+
+var (
+	_ driver.Driver            = (*snapshot)(nil)
+	_ driver.EntryLister       = (*snapshot)(nil)
+	_ driver.WatchModeReporter = (*snapshot)(nil)
+)
+
+func init() {
+	driver.RegisterDriver("snapshot", New)
+}
+
+// snapshot serves the config from a snapshot file.
+// the source address is the snapshot file, and the rule path is the namespace in the snapshot,
+// the namespace of the rule is used if the path is empty,
+// LIKE: source snapshot://var/dump.json and rule namespace test/demo1.
+// the redacted secrets are not served, so that the default value of the key can be used.
+type snapshot struct {
+	namespace2values map[string]map[string]Value
+}
+
+func New(c meta.Config, logger contract.Logger) (driver.Driver, error) {
+	path := c.SourceAddr()
+	s, err := ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot %s failed: %w", path, err)
+	}
+
+	sd := snapshot{
+		namespace2values: make(map[string]map[string]Value, len(c.Configs)),
+	}
+
+	for _, cfg := range c.Configs {
+		if cfg.Watch {
+			logger.Warnf("snapshot config %s not support watch", path)
+		}
+
+		for _, np := range cfg.Namespaces() {
+			name := np
+			if cfg.Path != "" {
+				name = cfg.Path
+			}
+
+			values, ok := s.Namespaces[name]
+			if !ok {
+				logger.Warnf("namespace %s not found in snapshot %s", name, path)
+				values = map[string]Value{}
+			}
+			sd.namespace2values[np] = values
+		}
+	}
+
+	if len(sd.namespace2values) == 0 {
+		return nil, errors.New("config rules is empty")
+	}
+
+	return &sd, nil
+}
+
+func (s *snapshot) Namespaces() []string {
+	nps := make([]string, 0, len(s.namespace2values))
+	for np := range s.namespace2values {
+		nps = append(nps, np)
+	}
+	return nps
+}
+
+// OnKeyChange always returns false, because the snapshot will not change.
+func (s *snapshot) OnKeyChange(namespace, key string, hook func([]byte) error) bool {
+	return false
+}
+
+// WatchMode returns WatchNone, the snapshot is not watched.
+func (s *snapshot) WatchMode(namespace string) driver.WatchMode {
+	return driver.WatchNone
+}
+
+func (s *snapshot) Entries(ctx context.Context, namespace string) ([]driver.Entry, error) {
+	values, ok := s.namespace2values[namespace]
+	if !ok {
+		return nil, driver.ErrNotFound
+	}
+
+	entries := make([]driver.Entry, 0, len(values))
+	for k, v := range values {
+		if !v.Redacted {
+			entries = append(entries, driver.Entry{Key: k, Value: []byte(v.Value), Revision: v.Revision})
+		}
+	}
+	slices.SortFunc(entries, func(a, b driver.Entry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return entries, nil
+}
+
+func (s *snapshot) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	value, err := s.GetString(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return strz.UnsafeBytes(value), nil
+}
+
+func (s *snapshot) GetString(ctx context.Context, namespace, key string) (string, error) {
+	values, ok := s.namespace2values[namespace]
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+
+	v, ok := values[key]
+	if !ok || v.Redacted {
+		return "", driver.ErrNotFound
+	}
+
+	return v.Value, nil
+}
+
+func (s *snapshot) Close() {}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+)
+
+type (
+	KeyEvent  = driver.KeyEvent
+	EventType = driver.EventType
+)
+
+const (
+	EventCreated = driver.EventCreated
+	EventUpdated = driver.EventUpdated
+	EventDeleted = driver.EventDeleted
+)
+
+// OnKeyEvent registers a hook that is called when the key is created, updated or deleted.
+// the values of the event are decrypted like OnKeyChange.
+// for a layered namespace, the event is converted to the change of the effective value:
+// the event of a lower layer is ignored while the key exists in a higher layer,
+// the key deleted in a higher layer is an update if a lower layer has the key, and vice versa.
+// false is returned if a layer above the lowest one can change but can not report the deleted keys.
+func (c *Configure) OnKeyEvent(namespace, key string, hook func(KeyEvent) error) bool {
+	hook = decryptEventHook(hook)
+
+	var ok bool
+	layers := c.ds[namespace]
+	if len(layers) == 1 {
+		ok = driver.OnKeyEvent(layers[0].driver, namespace, key, hook)
+	} else if c.layerEventsWatchable(namespace) {
+		var mu sync.Mutex
+		for i, l := range layers {
+			idx := i
+			if driver.OnKeyEvent(l.driver, namespace, key, func(ev KeyEvent) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				ev, fire := c.effectiveEvent(ev, idx)
+				if !fire {
+					return nil
+				}
+				return hook(ev)
+			}) {
+				ok = true
+			}
+		}
+	}
+
+	if !ok {
+		c.logger.Warnf("OnKeyEvent register failed: namespace=%s key=%s", namespace, key)
+	}
+	return ok
+}
+
+// layerEventsWatchable reports whether the key of the layered namespace can be watched.
+// a layer above the lowest one must implement driver.KeyEventWatcher if it can change,
+// otherwise the key deleted in it is never reported, and the value of the lower layer that applies is missed.
+// the layer can not change only if it reports WatchNone by driver.WatchModeReporter.
+func (c *Configure) layerEventsWatchable(namespace string) bool {
+	for i, l := range c.ds[namespace] {
+		if _, ok := l.driver.(driver.KeyEventWatcher); ok || i == 0 {
+			continue
+		}
+
+		if wr, ok := l.driver.(driver.WatchModeReporter); !ok || wr.WatchMode(namespace) != driver.WatchNone {
+			c.logger.Warnf("layer %s can not report the deleted keys: namespace=%s", l.source, namespace)
+			return false
+		}
+	}
+	return true
+}
+
+// onBatchEvent registers a hook that is called with the changed keys of the namespace,
+// once for each file reload or etcd watch response.
+// the events are converted to the changes of the effective values and decrypted like OnKeyEvent.
+func (c *Configure) onBatchEvent(namespace string, hook func([]KeyEvent) error) bool {
+	var (
+		ok bool
+		mu sync.Mutex
+	)
+
+	layers := c.ds[namespace]
+	for i, l := range layers {
+		idx := i
+		if driver.OnBatchEvent(l.driver, namespace, func(events []KeyEvent) error {
+			batch := make([]KeyEvent, 0, len(events))
+			if len(layers) > 1 {
+				mu.Lock()
+				defer mu.Unlock()
+			}
+
+			for _, ev := range events {
+				if len(layers) > 1 {
+					var fire bool
+					if ev, fire = c.effectiveEvent(ev, idx); !fire {
+						continue
+					}
+				}
+
+				ev, err := decryptEvent(ev)
+				if err != nil {
+					return err
+				}
+				batch = append(batch, ev)
+			}
+
+			if len(batch) == 0 {
+				return nil
+			}
+			return hook(batch)
+		}) {
+			ok = true
+		}
+	}
+
+	return ok
+}
+
+// effectiveEvent converts the event of the layer idx to the event of the effective value.
+func (c *Configure) effectiveEvent(ev KeyEvent, idx int) (KeyEvent, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	layers := c.ds[ev.Namespace]
+	for i := len(layers) - 1; i > idx; i-- {
+		// the higher layer has the key, so the effective value is not changed
+		if _, err := layers[i].driver.GetString(ctx, ev.Namespace, ev.Key); err == nil {
+			return ev, false
+		}
+	}
+
+	var lower []byte
+	var lowerExists bool
+	for i := idx - 1; i >= 0; i-- {
+		if s, err := layers[i].driver.GetString(ctx, ev.Namespace, ev.Key); err == nil {
+			lower, lowerExists = []byte(s), true
+			break
+		}
+	}
+
+	if !lowerExists {
+		return ev, true
+	}
+
+	switch ev.Type {
+	case driver.EventCreated:
+		ev.Type = driver.EventUpdated
+		ev.OldValue = lower
+	case driver.EventDeleted:
+		ev.Type = driver.EventUpdated
+		ev.NewValue = lower
+	default:
+	}
+	return ev, true
+}
+
+// decryptEventHook wraps the hook to receive the decrypted values.
+func decryptEventHook(hook func(KeyEvent) error) func(KeyEvent) error {
+	return func(ev KeyEvent) error {
+		ev, err := decryptEvent(ev)
+		if err != nil {
+			return err
+		}
+		return hook(ev)
+	}
+}
+
+// decryptEvent decrypts the old and new values of the event.
+func decryptEvent(ev KeyEvent) (KeyEvent, error) {
+	var err error
+	if ev.OldValue != nil {
+		if ev.OldValue, err = driver.Decrypt(ev.OldValue); err != nil {
+			return ev, err
+		}
+	}
+
+	if ev.NewValue != nil {
+		if ev.NewValue, err = driver.Decrypt(ev.NewValue); err != nil {
+			return ev, err
+		}
+	}
+	return ev, nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import "github.com/welllog/golt/config/driver"
+
+type Health = driver.Health
+
+// Health returns the health of the drivers that can run in degraded mode, keyed by the source of the meta config.
+// a degraded driver serves the config from its local cache, because the source is unreachable.
+func (c *Configure) Health() map[string]Health {
+	ret := make(map[string]Health)
+	for _, layers := range c.ds {
+		for _, l := range layers {
+			if hr, ok := l.driver.(driver.HealthReporter); ok {
+				ret[l.source] = hr.Health()
+			}
+		}
+	}
+	return ret
+}
+
+type WatchMode = driver.WatchMode
+
+const (
+	WatchNone   = driver.WatchNone
+	WatchNotify = driver.WatchNotify
+	WatchPoll   = driver.WatchPoll
+)
+
+// WatchMode returns how the changes of each layer of the namespace are detected, keyed by the source of the meta config.
+// the layer whose driver cannot report the watch mode is omitted.
+func (c *Configure) WatchMode(namespace string) map[string]WatchMode {
+	ret := make(map[string]WatchMode)
+	for _, l := range c.ds[namespace] {
+		if wr, ok := l.driver.(driver.WatchModeReporter); ok {
+			ret[l.source] = wr.WatchMode(namespace)
+		}
+	}
+	return ret
+}
+
+// Degraded reports whether any driver serves the config from its local cache.
+func (c *Configure) Degraded() bool {
+	for _, h := range c.Health() {
+		if h.Degraded {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/driver/etcd"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// unreachableKV fails all the Get while down, like etcd is unreachable.
+type unreachableKV struct {
+	*testKV
+	down atomic.Bool
+}
+
+func (u *unreachableKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	if u.down.Load() {
+		return nil, errors.New("etcd unreachable")
+	}
+	return u.testKV.Get(ctx, key, opts...)
+}
+
+func TestConfigure_Health(t *testing.T) {
+	tkv := &testKV{}
+	ctx := context.Background()
+	tkv.Put(ctx, "/v1/app/name", "demo")
+	kv := &unreachableKV{testKV: tkv}
+
+	cacheDir := t.TempDir()
+	driver.RegisterDriver("lkg_etcd", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return etcd.NewAdvanced(config, logger, etcd.WithCacheDir(cacheDir),
+			etcd.WithCustomEtcdClient(&clientv3.Client{KV: kv, Watcher: &testWatcher{}}))
+	})
+
+	cfs := []meta.Config{
+		{
+			Source:  "lkg_etcd://",
+			Configs: []meta.Rule{{Namespace: "app", Path: "/v1/app/", Watch: true}},
+		},
+	}
+
+	engine, err := NewConfigure(cfs)
+	testz.Nil(t, err)
+	testz.Equal(t, false, engine.Degraded())
+	engine.Close()
+
+	files, err := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+	testz.Nil(t, err)
+	testz.Equal(t, 1, len(files))
+
+	// the value changed while etcd is unreachable
+	kv.down.Store(true)
+	tkv.Put(ctx, "/v1/app/name", "demo2")
+
+	engine, err = NewConfigure(cfs)
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	testz.Equal(t, true, engine.Degraded())
+	h := engine.Health()["lkg_etcd://"]
+	testz.Equal(t, true, h.Degraded)
+	testz.Equal(t, true, h.Err != nil)
+
+	name, err := engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo", name)
+
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	engine.OnKeyChange("app", "name", func(b []byte) error {
+		mu.Lock()
+		names = append(names, string(b))
+		mu.Unlock()
+		return nil
+	})
+
+	// the driver retries to recover in a second
+	kv.down.Store(false)
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(names) >= 1 && !engine.Degraded()
+	})
+
+	name, err = engine.String(ctx, "app", "name")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo2", name)
+
+	mu.Lock()
+	testz.Equal(t, []string{"demo2"}, names)
+	mu.Unlock()
+
+	b, err := os.ReadFile(files[0])
+	testz.Nil(t, err)
+	testz.Equal(t, true, strings.Contains(string(b), "demo2"))
+}
+
+func TestConfigure_HealthCacheSource(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+	for _, source := range []string{"lkg_etcd_a", "lkg_etcd_b"} {
+		tkv := &testKV{}
+		tkv.Put(ctx, "/v1/app/name", source)
+		kv := &unreachableKV{testKV: tkv}
+		driver.RegisterDriver(source, func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+			return etcd.NewAdvanced(config, logger, etcd.WithCacheDir(cacheDir),
+				etcd.WithCustomEtcdClient(&clientv3.Client{KV: kv, Watcher: &testWatcher{}}))
+		})
+
+		cfs := []meta.Config{
+			{
+				Source:  source + "://",
+				Configs: []meta.Rule{{Namespace: "app", Path: "/v1/app/"}},
+			},
+		}
+		engine, err := NewConfigure(cfs)
+		testz.Nil(t, err)
+		engine.Close()
+
+		// the cache of the same prefix is not shared by the sources
+		kv.down.Store(true)
+		engine, err = NewConfigure(cfs)
+		testz.Nil(t, err)
+		name, err := engine.String(ctx, "app", "name")
+		testz.Nil(t, err)
+		testz.Equal(t, source, name)
+		engine.Close()
+	}
+
+	files, err := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+	testz.Nil(t, err)
+	testz.Equal(t, 2, len(files))
+}
+
+// blockingKV blocks all the Get until the context is done while blocked, like etcd never responds.
+type blockingKV struct {
+	*testKV
+	blocked atomic.Bool
+}
+
+func (b *blockingKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	if b.blocked.Load() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return b.testKV.Get(ctx, key, opts...)
+}
+
+func TestConfigure_HealthLoadTimeout(t *testing.T) {
+	tkv := &testKV{}
+	ctx := context.Background()
+	tkv.Put(ctx, "/v1/app/name", "demo")
+	tkv.Put(ctx, "/v1/db/host", "localhost")
+	tkv.Put(ctx, "/v1/cache/addr", "127.0.0.1:6379")
+	kv := &blockingKV{testKV: tkv}
+
+	cfs := []meta.Config{
+		{
+			Source: "custom_etcd://",
+			Configs: []meta.Rule{
+				{Namespace: "app", Path: "/v1/app/"},
+				{Namespace: "db", Path: "/v1/db/"},
+				{Namespace: "cache", Path: "/v1/cache/"},
+			},
+		},
+	}
+	timeout := 200 * time.Millisecond
+	options := []Option{
+		WithCustomEtcdClient(&clientv3.Client{KV: kv, Watcher: &testWatcher{}}),
+		WithEtcdCacheDir(t.TempDir()),
+		WithEtcdLoadTimeout(timeout),
+	}
+
+	engine, err := NewConfigure(cfs, options...)
+	testz.Nil(t, err)
+	engine.Close()
+
+	// the prefixes share the timeout, instead of waiting it for each prefix
+	kv.blocked.Store(true)
+	start := time.Now()
+	engine, err = NewConfigure(cfs, options...)
+	testz.Nil(t, err)
+	defer engine.Close()
+	testz.Equal(t, true, time.Since(start) < 2*timeout)
+	testz.Equal(t, true, engine.Degraded())
+
+	for _, c := range []struct{ namespace, key, value string }{
+		{"app", "name", "demo"},
+		{"db", "host", "localhost"},
+		{"cache", "addr", "127.0.0.1:6379"},
+	} {
+		value, err := engine.String(ctx, c.namespace, c.key)
+		testz.Nil(t, err)
+		testz.Equal(t, c.value, value)
+	}
+}
+
+func TestConfigure_HealthOptionsNotShared(t *testing.T) {
+	tkv := &testKV{}
+	tkv.Put(context.Background(), "/v1/app/name", "demo")
+
+	cfs := []meta.Config{
+		{
+			Source:  "custom_etcd://",
+			Configs: []meta.Rule{{Namespace: "app", Path: "/v1/app/"}},
+		},
+	}
+
+	engine, err := NewConfigure(cfs,
+		WithCustomEtcdClient(&clientv3.Client{KV: tkv, Watcher: &testWatcher{}}),
+		WithEtcdCacheDir(t.TempDir()),
+	)
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the etcd client and the cache dir are only used by the Configure created with them
+	_, err = NewConfigure(cfs)
+	testz.Equal(t, true, err != nil)
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+)
+
+// ChangeRecord is a change of the effective value of a key.
+// the values are recorded as hashes, so that the secrets are not kept in memory or sinks.
+type ChangeRecord struct {
+	Namespace string    `json:"namespace"`
+	Key       string    `json:"key"`
+	Type      EventType `json:"type"`
+	// OldHash and NewHash are the hmac-sha256 hex of the raw values, empty when the value not exists.
+	// the key of the hmac is set by WithHistoryHashKey, so that the short secrets can not be brute-forced from the sinks,
+	// without it, the key is random and the hashes can only be compared within the same Configure.
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	// Source is the source of the layer changed, LIKE: file://etc/, etcd://127.0.0.1:2379
+	Source string `json:"source"`
+	// Revision is the etcd mod revision, or the modify time in unix nano of the file.
+	Revision int64 `json:"revision"`
+	// Time is the time the change is observed, it is zero for the records backfilled from etcd.
+	Time time.Time `json:"time"`
+}
+
+// HistorySink receives every change record, LIKE: appending to a file.
+type HistorySink interface {
+	Write(r ChangeRecord) error
+}
+
+// JSONLinesSink appends the change records to a file as json lines.
+type JSONLinesSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewJSONLinesSink opens the file for appending, the file is created with mode 0600 if not exists.
+// the sink is not closed by Configure.Close.
+func NewJSONLinesSink(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONLinesSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *JSONLinesSink) Write(r ChangeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enc.Encode(r)
+}
+
+func (s *JSONLinesSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
+
+// defaultHistorySize is the size of the history enabled by WithHistorySink without WithHistory.
+const defaultHistorySize = 16
+
+// history keeps a bounded ring of change records per key.
+type history struct {
+	size  int
+	sinks []HistorySink
+	// key is the key of the hmac of the values
+	key []byte
+
+	mu    sync.RWMutex
+	rings map[string]*ring
+}
+
+type ring struct {
+	records []ChangeRecord
+	// next is the position of the next record when the ring is full
+	next int
+}
+
+func (r *ring) add(record ChangeRecord, size int) {
+	if len(r.records) < size {
+		r.records = append(r.records, record)
+		return
+	}
+
+	r.records[r.next] = record
+	r.next = (r.next + 1) % size
+}
+
+// list returns the records ordered from old to new.
+func (r *ring) list() []ChangeRecord {
+	ret := make([]ChangeRecord, 0, len(r.records))
+	ret = append(ret, r.records[r.next:]...)
+	return append(ret, r.records[:r.next]...)
+}
+
+// watchHistory records the changes of all the watched namespaces.
+// the values are hashed by the key, a random key is generated if the key is empty.
+func (c *Configure) watchHistory(size int, sinks []HistorySink, key []byte) error {
+	if len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("generate history hash key failed: %w", err)
+		}
+	}
+	c.history = &history{size: size, sinks: sinks, key: key, rings: make(map[string]*ring)}
+
+	for ns, layers := range c.ds {
+		for i, l := range layers {
+			idx, source := i, l.source
+			driver.OnBatchEvent(l.driver, ns, func(events []KeyEvent) error {
+				now := time.Now()
+				for _, ev := range events {
+					if len(layers) > 1 {
+						var fire bool
+						if ev, fire = c.effectiveEvent(ev, idx); !fire {
+							continue
+						}
+					}
+
+					c.record(ChangeRecord{
+						Namespace: ev.Namespace,
+						Key:       ev.Key,
+						Type:      ev.Type,
+						OldHash:   c.history.hash(ev.OldValue, ev.Type != EventCreated),
+						NewHash:   c.history.hash(ev.NewValue, ev.Type != EventDeleted),
+						Source:    source,
+						Revision:  ev.Revision,
+						Time:      now,
+					})
+				}
+				return nil
+			})
+		}
+	}
+
+	return nil
+}
+
+func (c *Configure) record(r ChangeRecord) {
+	h := c.history
+	id := refID(r.Namespace, r.Key)
+
+	h.mu.Lock()
+	rg, ok := h.rings[id]
+	if !ok {
+		rg = &ring{}
+		h.rings[id] = rg
+	}
+	rg.add(r, h.size)
+	h.mu.Unlock()
+
+	for _, sink := range h.sinks {
+		if err := sink.Write(r); err != nil {
+			c.logger.Warnf("history sink write failed: %s", err.Error())
+		}
+	}
+}
+
+// History returns the change records of the key ordered from old to new, nil if the history is not enabled.
+// the history keeps the latest records of each key, see WithHistory.
+func (c *Configure) History(namespace, key string) []ChangeRecord {
+	h := c.history
+	if h == nil {
+		return nil
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rg, ok := h.rings[refID(namespace, key)]
+	if !ok {
+		return nil
+	}
+	return rg.list()
+}
+
+// BackfillHistory fills the history of the key from the revision history of the source which has not been compacted,
+// LIKE: etcd. the backfilled records are older than the observed records, and they are not written to the sinks.
+func (c *Configure) BackfillHistory(ctx context.Context, namespace, key string) error {
+	h := c.history
+	if h == nil {
+		return errors.New("history is not enabled, see WithHistory")
+	}
+
+	var backfill []ChangeRecord
+	for _, l := range c.ds[namespace] {
+		hr, ok := l.driver.(driver.HistoryReader)
+		if !ok {
+			continue
+		}
+
+		events, err := hr.History(ctx, namespace, key, h.size)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range events {
+			backfill = append(backfill, ChangeRecord{
+				Namespace: namespace,
+				Key:       key,
+				Type:      ev.Type,
+				OldHash:   h.hash(ev.OldValue, ev.Type != EventCreated),
+				NewHash:   h.hash(ev.NewValue, ev.Type != EventDeleted),
+				Source:    l.source,
+				Revision:  ev.Revision,
+			})
+		}
+	}
+
+	if len(backfill) == 0 {
+		return nil
+	}
+
+	id := refID(namespace, key)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// the observed records of the same source and revision are kept instead of the backfilled
+	rg := &ring{}
+	var observed []ChangeRecord
+	if old, ok := h.rings[id]; ok {
+		observed = old.list()
+	}
+
+	seen := make(map[string]bool, len(observed))
+	for _, r := range observed {
+		seen[r.Source+"@"+strconv.FormatInt(r.Revision, 10)] = true
+	}
+
+	for _, r := range backfill {
+		if !seen[r.Source+"@"+strconv.FormatInt(r.Revision, 10)] {
+			rg.add(r, h.size)
+		}
+	}
+	for _, r := range observed {
+		rg.add(r, h.size)
+	}
+	h.rings[id] = rg
+
+	return nil
+}
+
+// hash returns the hmac-sha256 hex of the value, empty if the value not exists.
+func (h *history) hash(b []byte, exists bool) string {
+	if !exists {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/meta"
+)
+
+func TestConfigure_History(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("user: root\n"), 0666))
+
+	sinkPath := filepath.Join(dir, "history.jsonl")
+	sink, err := NewJSONLinesSink(sinkPath)
+	testz.Nil(t, err)
+	defer sink.Close()
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	}, WithHistory(2), WithHistorySink(sink))
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	testz.Equal(t, 0, len(engine.History("db", "user")))
+
+	for _, step := range []struct {
+		content string
+		// recorded reports whether the change of the content is recorded
+		recorded func(records []ChangeRecord) bool
+	}{
+		{"user: admin\npassword: pwd\n", func(records []ChangeRecord) bool { return len(records) == 1 }},
+		{"user: guest\npassword: pwd\n", func(records []ChangeRecord) bool { return len(records) == 2 }},
+		{"password: pwd\n", func(records []ChangeRecord) bool { return records[1].Type == EventDeleted }},
+	} {
+		testz.Nil(t, os.WriteFile(file, []byte(step.content), 0666))
+		eventually(t, func() bool { return step.recorded(engine.History("db", "user")) })
+	}
+
+	records := engine.History("db", "user")
+	testz.Equal(t, 2, len(records))
+	testz.Equal(t, EventUpdated, records[0].Type)
+	testz.Equal(t, engine.history.hash([]byte("admin"), true), records[0].OldHash)
+	testz.Equal(t, engine.history.hash([]byte("guest"), true), records[0].NewHash)
+	testz.Equal(t, "file://"+dir, records[0].Source)
+	testz.Equal(t, EventDeleted, records[1].Type)
+	testz.Equal(t, records[0].NewHash, records[1].OldHash)
+	testz.Equal(t, "", records[1].NewHash)
+
+	records = engine.History("db", "password")
+	testz.Equal(t, 1, len(records))
+	testz.Equal(t, EventCreated, records[0].Type)
+	testz.Equal(t, "", records[0].OldHash)
+
+	// the file is not a revision history source, nothing is backfilled
+	testz.Nil(t, engine.BackfillHistory(context.Background(), "db", "user"))
+	testz.Equal(t, 2, len(engine.History("db", "user")))
+
+	// the hash is keyed, it is not the plain sha256 of the value
+	sum := sha256.Sum256([]byte("pwd"))
+	testz.Equal(t, engine.history.hash([]byte("pwd"), true), records[0].NewHash)
+	testz.Equal(t, false, hex.EncodeToString(sum[:]) == records[0].NewHash)
+
+	fi, err := os.Stat(sinkPath)
+	testz.Nil(t, err)
+	testz.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	f, err := os.Open(sinkPath)
+	testz.Nil(t, err)
+	defer f.Close()
+
+	var lines []ChangeRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r ChangeRecord
+		testz.Nil(t, json.Unmarshal(scanner.Bytes(), &r))
+		lines = append(lines, r)
+	}
+	// password: created; user: updated, updated, deleted
+	testz.Equal(t, 4, len(lines))
+	testz.Equal(t, "db", lines[0].Namespace)
+	testz.Equal(t, "password", lines[0].Key)
+	testz.Equal(t, EventCreated, lines[0].Type)
+	testz.Equal(t, EventDeleted, lines[3].Type)
+}
+
+func TestConfigure_HistoryDisabled(t *testing.T) {
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "db.yaml"), []byte("user: root\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	testz.Equal(t, 0, len(engine.History("db", "user")))
+	err = engine.BackfillHistory(context.Background(), "db", "user")
+	testz.Equal(t, true, err != nil)
+}
+
+func TestConfigure_HistoryHashKey(t *testing.T) {
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "db.yaml"), []byte("user: root\n"), 0666))
+
+	c := []meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	}
+	key := []byte("history-secret")
+
+	// the sink enables the history without WithHistory
+	sink := &sliceSink{}
+	engine, err := NewConfigure(c, WithHistorySink(sink), WithHistoryHashKey(key))
+	testz.Nil(t, err)
+	defer engine.Close()
+	testz.Equal(t, defaultHistorySize, engine.history.size)
+
+	// the hashes of the same key are comparable across the configures
+	engine2, err := NewConfigure(c, WithHistory(2), WithHistoryHashKey(key))
+	testz.Nil(t, err)
+	defer engine2.Close()
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("pwd"))
+	testz.Equal(t, hex.EncodeToString(mac.Sum(nil)), engine.history.hash([]byte("pwd"), true))
+	testz.Equal(t, engine.history.hash([]byte("pwd"), true), engine2.history.hash([]byte("pwd"), true))
+
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "db.yaml"), []byte("user: admin\n"), 0666))
+	eventually(t, func() bool { return len(sink.list()) == 1 })
+	testz.Equal(t, engine.history.hash([]byte("admin"), true), sink.list()[0].NewHash)
+}
+
+// sliceSink keeps the change records in memory.
+type sliceSink struct {
+	mu      sync.Mutex
+	records []ChangeRecord
+}
+
+func (s *sliceSink) Write(r ChangeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *sliceSink) list() []ChangeRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]ChangeRecord(nil), s.records...)
+}
@@ -0,0 +1,89 @@
+package dotenv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse parses the content of a .env file into a map.
+// supported syntax:
+//
+//	# comment
+//	KEY=value
+//	export KEY=value
+//	KEY="value with \n escapes"
+//	KEY='literal value'
+//	KEY=value # inline comment
+func Parse(b []byte) (map[string]string, error) {
+	m := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid .env line %d: %s", lineNo, line)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value, err := parseDotEnvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid .env line %d: %w", lineNo, err)
+		}
+		m[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func parseDotEnvValue(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	switch s[0] {
+	case '"':
+		end := closingQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated double quoted value: %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quoted value: %s", s)
+		}
+		return s[1 : end+1], nil
+	}
+
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// closingQuote returns the index of the closing double quote, the escaped quote is skipped.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
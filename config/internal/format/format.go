@@ -0,0 +1,298 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/internal/dotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// the json, yaml and toml extractors keep the raw text of the nested values,
+// they decode by the decoder of the format registered by driver.RegisterDecoder.
+func init() {
+	driver.RegisterFieldExtractor("json", unmarshalFields("json"))
+	driver.RegisterFieldExtractor("yaml", unmarshalFields("yaml"))
+	driver.RegisterFieldExtractor("yml", unmarshalFields("yml"))
+	driver.RegisterFieldExtractor("toml", unmarshalFields("toml"))
+	driver.RegisterFieldExtractor("env", dotEnvFields)
+	driver.RegisterFieldExtractor("ini", iniFields)
+	driver.RegisterFieldExtractor("properties", propertiesFields)
+}
+
+// Extractor returns the field extractor of the file format,
+// the format only has a decoder registered is decoded by decoderFields.
+func Extractor(format string) (driver.FieldExtractor, error) {
+	if fn, ok := driver.GetFieldExtractor(format); ok {
+		return fn, nil
+	}
+
+	if fn, ok := driver.GetDecoder(format); ok {
+		return decoderFields(fn), nil
+	}
+
+	return nil, fmt.Errorf("unsupported file format: %s, "+
+		"you can register custom format by driver.RegisterFieldExtractor or driver.RegisterDecoder", format)
+}
+
+// unmarshalFields keeps the raw text of each value by the field, the decoder of the format is looked up on each call,
+// it must support the unmarshaler of the field.
+func unmarshalFields(format string) driver.FieldExtractor {
+	return func(b []byte) (map[string][]byte, error) {
+		var fields map[string]*field
+		if err := driver.MustGetDecoder(format)(b, &fields); err != nil {
+			return nil, err
+		}
+
+		m := make(map[string][]byte, len(fields))
+		for k, v := range fields {
+			if v != nil {
+				m[k] = v.value
+			} else {
+				m[k] = nil
+			}
+		}
+		return m, nil
+	}
+}
+
+// decoderFields decodes the content into map[string]any by the decoder,
+// the string value is kept as is, and other values are encoded as yaml.
+func decoderFields(fn driver.Decoder) driver.FieldExtractor {
+	return func(b []byte) (map[string][]byte, error) {
+		var values map[string]any
+		if err := fn(b, &values); err != nil {
+			return nil, err
+		}
+
+		m := make(map[string][]byte, len(values))
+		for k, v := range values {
+			switch val := v.(type) {
+			case nil:
+				m[k] = nil
+			case string:
+				m[k] = []byte(val)
+			case []byte:
+				m[k] = val
+			default:
+				out, err := yaml.Marshal(val)
+				if err != nil {
+					return nil, fmt.Errorf("encode value of key %s failed: %w", k, err)
+				}
+				m[k] = bytes.TrimRight(out, "\n")
+			}
+		}
+		return m, nil
+	}
+}
+
+// dotEnvFields parses the .env file like the .env fallback files of the env driver.
+func dotEnvFields(b []byte) (map[string][]byte, error) {
+	values, err := dotenv.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string][]byte, len(values))
+	for k, v := range values {
+		m[k] = []byte(v)
+	}
+	return m, nil
+}
+
+// iniFields parses the ini file, the keys before any section are top-level keys,
+// and each section is a key whose value is the yaml of the keys in the section, LIKE:
+//
+//	name = demo
+//	[db]
+//	host = localhost ; comment
+//	port = 3306
+//
+// is parsed into name: demo, db: "host: localhost\nport: \"3306\"", so that db.host can be read by the key path.
+func iniFields(b []byte) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	sections := make(map[string]map[string]string)
+
+	var section map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("invalid ini line %d: %s", lineNo, line)
+			}
+
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("invalid ini line %d: empty section", lineNo)
+			}
+
+			// the repeated section is merged
+			if section = sections[name]; section == nil {
+				section = make(map[string]string)
+				sections[name] = section
+			}
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid ini line %d: %s", lineNo, line)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value := iniValue(strings.TrimSpace(line[i+1:]))
+		if section == nil {
+			m[key] = []byte(value)
+		} else {
+			section[key] = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for name, keys := range sections {
+		out, err := yaml.Marshal(keys)
+		if err != nil {
+			return nil, fmt.Errorf("encode ini section %s failed: %w", name, err)
+		}
+		m[name] = bytes.TrimRight(out, "\n")
+	}
+
+	return m, nil
+}
+
+// iniValue removes the inline comment and the quotes of the value.
+func iniValue(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') {
+		if end := strings.IndexByte(s[1:], s[0]); end >= 0 {
+			return s[1 : end+1]
+		}
+	}
+
+	for _, sep := range []string{" ;", " #"} {
+		if i := strings.Index(s, sep); i >= 0 {
+			s = s[:i]
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// propertiesFields parses the java .properties file, the keys are kept flat, LIKE: db.host
+// supported syntax:
+//
+//	# comment or ! comment
+//	key=value
+//	key:value
+//	key value
+//	key=a long value \
+//	    continued on the next line
+//	key=escapes \t \n \u4e2d
+func propertiesFields(b []byte) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	lines := strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		// the line ends with an odd number of backslashes is continued
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		key, value := splitProperty(line)
+		k, err := unescapeProperty(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid properties line %d: %w", lineNo, err)
+		}
+		v, err := unescapeProperty(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid properties line %d: %w", lineNo, err)
+		}
+		m[k] = []byte(v)
+	}
+
+	return m, nil
+}
+
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits the line at the first unescaped '=', ':' or whitespace.
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeft(line[i+1:], " \t\f")
+		case ' ', '\t', '\f':
+			rest := strings.TrimLeft(line[i:], " \t\f")
+			if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+				rest = strings.TrimLeft(rest[1:], " \t\f")
+			}
+			return line[:i], rest
+		}
+	}
+	return line, ""
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("invalid unicode escape: %s", s[i-1:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape: %s", s[i-1:i+5])
+			}
+			sb.WriteRune(rune(r))
+			i += 4
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/welllog/golib/strz"
+)
+
+// ErrInterpolationCycle is returned when the ${namespace:key} references form a cycle.
+var ErrInterpolationCycle = errors.New("config interpolation cycle")
+
+// interpolateBytes expands the references in the value of namespace:key.
+// the value is returned as is when it has no reference.
+func (c *Configure) interpolateBytes(ctx context.Context, namespace, key string, b []byte) ([]byte, error) {
+	if !bytes.Contains(b, []byte("${")) {
+		return b, nil
+	}
+
+	s, err := c.interpolateString(ctx, namespace, key, strz.UnsafeString(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+// interpolateString expands the references in the value of namespace:key.
+func (c *Configure) interpolateString(ctx context.Context, namespace, key, s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	return c.expand(ctx, s, []string{refID(namespace, key)})
+}
+
+// expand expands the references in s, stack is the chain of the keys being expanded.
+func (c *Configure) expand(ctx context.Context, s string, stack []string) (string, error) {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+
+		// $${ is the escaped ${
+		if i > 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("interpolate %s: unclosed reference in %q", stack[0], s[i:])
+		}
+
+		sb.WriteString(s[:i])
+		v, err := c.resolveRef(ctx, s[i+2:i+2+end], stack)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(v)
+		s = s[i+2+end+1:]
+	}
+}
+
+// resolveRef resolves the reference expression, LIKE: ENV, ENV:-default, namespace:key, namespace:key:-default
+func (c *Configure) resolveRef(ctx context.Context, expr string, stack []string) (string, error) {
+	ref, def, hasDef := strings.Cut(expr, ":-")
+	namespace, key, isKey := strings.Cut(ref, ":")
+	if !isKey {
+		if v, ok := os.LookupEnv(ref); ok {
+			return v, nil
+		}
+
+		if hasDef {
+			return def, nil
+		}
+		return "", fmt.Errorf("interpolate %s: env %s: %w", stack[0], ref, ErrNotFound)
+	}
+
+	id := refID(namespace, key)
+	for i, v := range stack {
+		if v == id {
+			return "", fmt.Errorf("interpolate %s: %w: %s -> %s", stack[0], ErrInterpolationCycle,
+				strings.Join(stack[i:], " -> "), id)
+		}
+	}
+
+	raw, err := c.getRawString(ctx, namespace, key)
+	if err != nil {
+		if hasDef && errors.Is(err, ErrNotFound) {
+			return def, nil
+		}
+		return "", fmt.Errorf("interpolate %s: reference %s: %w", stack[0], id, err)
+	}
+
+	return c.expand(ctx, unquote(raw), append(stack, id))
+}
+
+// refs returns the namespace:key references in s, the references in the referenced values are not included.
+func refs(s string) []string {
+	var ids []string
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			return ids
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return ids
+		}
+
+		if i == 0 || s[i-1] != '$' {
+			ref, _, _ := strings.Cut(s[i+2:i+2+end], ":-")
+			if strings.Contains(ref, ":") {
+				ids = append(ids, ref)
+			}
+		}
+		s = s[i+2+end+1:]
+	}
+}
+
+func refID(namespace, key string) string {
+	return namespace + ":" + key
+}
+
+// interpolationHook wraps the hook registered when interpolation is enabled.
+// the hook is called with the expanded value, and it is also called when the referenced keys change.
+type interpolationHook struct {
+	mu        sync.Mutex
+	c         *Configure
+	namespace string
+	key       string
+	hook      func([]byte) error
+	last      string
+	// deps is the referenced keys which have been watched
+	deps map[string]struct{}
+}
+
+func (c *Configure) interpolateHook(namespace, key string, hook func([]byte) error) func([]byte) error {
+	h := &interpolationHook{
+		c:         c,
+		namespace: namespace,
+		key:       key,
+		hook:      hook,
+		deps:      make(map[string]struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if raw, err := c.getRawString(ctx, namespace, key); err == nil {
+		h.last, _ = c.interpolateString(ctx, namespace, key, raw)
+		h.watchDeps(ctx, raw)
+	}
+
+	return h.handle
+}
+
+// handle is called when the value of the key changes.
+func (h *interpolationHook) handle(b []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	raw := string(b)
+	v, err := h.c.interpolateString(ctx, h.namespace, h.key, raw)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.watchDeps(ctx, raw)
+	return h.fire(v)
+}
+
+// reevaluate is called when the referenced key changes.
+func (h *interpolationHook) reevaluate([]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	v, err := h.c.GetRawString(ctx, h.namespace, h.key)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.fire(v)
+}
+
+func (h *interpolationHook) fire(v string) error {
+	if v == h.last {
+		return nil
+	}
+
+	h.last = v
+	return h.hook([]byte(v))
+}
+
+// watchDeps registers hooks on the keys referenced by raw recursively.
+func (h *interpolationHook) watchDeps(ctx context.Context, raw string) {
+	for _, id := range refs(raw) {
+		if _, ok := h.deps[id]; ok {
+			continue
+		}
+
+		h.deps[id] = struct{}{}
+		namespace, key, _ := strings.Cut(id, ":")
+		if !h.c.watchKey(namespace, key, h.reevaluate) {
+			h.c.logger.Debugf("interpolation reference %s of %s not watchable", id, refID(h.namespace, h.key))
+		}
+
+		if depRaw, err := h.c.getRawString(ctx, namespace, key); err == nil {
+			h.watchDeps(ctx, depRaw)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/meta"
+)
+
+func TestConfigure_Interpolation(t *testing.T) {
+	t.Setenv("GOLT_TEST_REDIS_DB", "3")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	content := `redis_host: 10.0.0.1
+redis_addr: ${app:redis_host}:${GOLT_TEST_REDIS_PORT:-6379}
+redis:
+  addr: ${app:redis_addr}
+  db: ${GOLT_TEST_REDIS_DB}
+missing: ${app:none:-fallback}
+loop_a: ${app:loop_b}
+loop_b: ${app:loop_a}
+escaped: $${HOME}
+`
+	testz.Nil(t, os.WriteFile(file, []byte(content), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+	}, WithInterpolation())
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	addr, err := engine.String(ctx, "app", "redis_addr")
+	testz.Nil(t, err)
+	testz.Equal(t, "10.0.0.1:6379", addr)
+
+	var redis struct {
+		Addr string `yaml:"addr"`
+		DB   int    `yaml:"db"`
+	}
+	testz.Nil(t, engine.YamlDecode(ctx, "app", "redis", &redis))
+	testz.Equal(t, "10.0.0.1:6379", redis.Addr)
+	testz.Equal(t, 3, redis.DB)
+
+	s, err := engine.String(ctx, "app", "missing")
+	testz.Nil(t, err)
+	testz.Equal(t, "fallback", s)
+
+	s, err = engine.String(ctx, "app", "escaped")
+	testz.Nil(t, err)
+	testz.Equal(t, "${HOME}", s)
+
+	_, err = engine.String(ctx, "app", "loop_a")
+	testz.Equal(t, true, errors.Is(err, ErrInterpolationCycle))
+	testz.Equal(t, true, strings.Contains(err.Error(), "app:loop_a -> app:loop_b -> app:loop_a"))
+
+	addrs := make(chan string, 1)
+	engine.OnKeyChange("app", "redis_addr", func(b []byte) error {
+		addrs <- string(b)
+		return nil
+	})
+
+	testz.Nil(t, os.WriteFile(file, []byte(strings.Replace(content, "10.0.0.1", "10.0.0.2", 1)), 0666))
+	select {
+	case addr := <-addrs:
+		testz.Equal(t, "10.0.0.2:6379", addr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change event not triggered")
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -24,6 +25,14 @@ type FieldLazyLoadMap map[unsafe.Pointer]func() error
 // For unexported pointer fields, if the lazy option is not set, the configuration value is loaded and set to the field using unsafe.
 // If the lazy option is set for an unexported pointer field, a lazy load function is returned in the map.
 // If the watch option is set for an unexported pointer field, a callback function is registered to update the field when the configuration changes.
+// If the optional or default option is set, the missing key is not an error, the field uses the default value or keeps zero,
+// and a watched optional field is populated when the key appears later. the default value containing ';' is single quoted,
+// LIKE: `config:"namespace:app;key:dsn;default:'user:pass@/db?a=1;b=2'"`.
+// The values are validated by the validate tag and the Validate method before stored, see validateField.
+// If the reloaded value of a watched field is invalid, the old value is kept.
+// The nested structs, embedded structs, pointers to struct and slices of structs are loaded recursively
+// when the field has no config tag key, the namespace of the field tag is inherited by the nested fields without namespace.
+// LIKE: type Server struct { HTTP HTTPConfig `config:"namespace:http"` }
 func (c *Configure) InitAndPreload(dst any, fieldLoadTimeout time.Duration) (FieldLazyLoadMap, error) {
 	begin := time.Now()
 
@@ -33,43 +42,134 @@ func (c *Configure) InitAndPreload(dst any, fieldLoadTimeout time.Duration) (Fie
 	}
 
 	funcs := FieldLazyLoadMap{}
+	if err = c.initStruct(v, "", "", funcs, fieldLoadTimeout, make(map[reflect.Type]bool)); err != nil {
+		return nil, err
+	}
+
+	c.logger.Debugf("InitAndPreload took %d ms", time.Since(begin).Milliseconds())
+	return funcs, nil
+}
+
+// initStruct loads the fields of the struct v, prefix is the field path of v, namespace is inherited from the parent tag.
+// path is the struct types from the root to v, it stops the recursion of the self-referential types.
+func (c *Configure) initStruct(v reflect.Value, prefix, namespace string, funcs FieldLazyLoadMap, loadTimeout time.Duration,
+	path map[reflect.Type]bool) error {
+	t := v.Type()
+	path[t] = true
+	defer delete(path, t)
 
 	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		tag := field.Tag.Get("config")
-		if tag == "" {
-			continue
+		field := t.Field(i)
+		fieldValue := v.Field(i)
+		if !fieldValue.CanSet() {
+			// the field of unexported or embedded unexported struct, set it by unsafe
+			fieldValue = reflect.NewAt(field.Type, unsafe.Pointer(fieldValue.UnsafeAddr())).Elem()
 		}
+		field.Name = prefix + field.Name
 
+		tag, hasTag := field.Tag.Lookup("config")
 		ct, err := parseConfigTag(tag)
 		if err != nil {
-			return nil, fmt.Errorf("field %s tag parse: %w", field.Name, err)
+			return fmt.Errorf("field %s tag parse: %w", field.Name, err)
 		}
 
-		if field.IsExported() {
-			err = c.loadExportedField(field, v.Field(i), ct, fieldLoadTimeout)
-			if err != nil {
-				return nil, err
-			}
-			continue
+		if ct.Namespace == "" {
+			ct.Namespace = namespace
 		}
 
-		if field.Type.Kind() != reflect.Ptr {
-			err = c.loadUnexportedNotPtrField(field, v.Field(i), ct, fieldLoadTimeout)
+		if ct.Key == "" {
+			if !hasNestedConfig(field.Type, nil) {
+				if hasTag {
+					return fmt.Errorf("field %s config tag must have key", field.Name)
+				}
+				continue
+			}
+
+			err = c.initNested(fieldValue, field.Name, ct.Namespace, funcs, loadTimeout, path)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			continue
 		}
 
-		err = c.handleLazyOrWatchedField(field, v.Field(i), ct, funcs, fieldLoadTimeout)
+		if ct.Namespace == "" {
+			return fmt.Errorf("field %s config tag must have namespace, or inherit from parent", field.Name)
+		}
+
+		if field.IsExported() {
+			err = c.loadExportedField(field, fieldValue, ct, loadTimeout)
+		} else if field.Type.Kind() != reflect.Ptr {
+			err = c.loadUnexportedNotPtrField(field, fieldValue, ct, loadTimeout)
+		} else {
+			err = c.handleLazyOrWatchedField(field, fieldValue, ct, funcs, loadTimeout)
+		}
+
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	c.logger.Debugf("InitAndPreload took %d ms", time.Since(begin).Milliseconds())
-	return funcs, nil
+	return nil
+}
+
+// initNested loads the nested struct, pointer to struct, slice or array of structs.
+// the nil pointer is allocated, unless its type is already on the path, which would allocate forever.
+func (c *Configure) initNested(v reflect.Value, name, namespace string, funcs FieldLazyLoadMap, loadTimeout time.Duration,
+	path map[reflect.Type]bool) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		return c.initStruct(v, name+".", namespace, funcs, loadTimeout, path)
+	case reflect.Ptr:
+		if v.IsNil() {
+			if path[v.Type().Elem()] {
+				return fmt.Errorf("field %s: self-referential type %s can not be loaded recursively, "+
+					"set the config tag key on the field or allocate it before loading", name, v.Type().Elem())
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return c.initNested(v.Elem(), name, namespace, funcs, loadTimeout, path)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := c.initNested(v.Index(i), fmt.Sprintf("%s[%d]", name, i), namespace, funcs, loadTimeout, path); err != nil {
+				return err
+			}
+		}
+	default:
+	}
+
+	return nil
+}
+
+// hasNestedConfig reports whether the type is a struct, pointer to struct, slice or array of structs
+// which has config tags in the fields.
+func hasNestedConfig(t reflect.Type, seen map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return hasNestedConfig(t.Elem(), seen)
+	case reflect.Struct:
+	default:
+		return false
+	}
+
+	if seen == nil {
+		seen = make(map[reflect.Type]bool)
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("config"); ok {
+			return true
+		}
+
+		if hasNestedConfig(field.Type, seen) {
+			return true
+		}
+	}
+	return false
 }
 
 // TryLoad attempts to load the configuration value for the field pointed to by fieldPtr.
@@ -111,20 +211,40 @@ func (c *Configure) loadExportedField(field reflect.StructField, fieldValue refl
 	loadCtx, loadCancel := context.WithTimeout(context.Background(), loadTimeout)
 	if field.Type.Kind() == reflect.Ptr {
 		ptrValue := reflect.New(field.Type.Elem())
-		err := c.Decode(loadCtx, ct.Namespace, ct.Key, ptrValue.Interface(), driver.GetDecoderOrDefault(ct.Format))
+		found, err := c.decodeTag(loadCtx, ct, ptrValue)
 		loadCancel()
 		if err != nil {
 			return fmt.Errorf("field %s preload failed: %w", field.Name, err)
 		}
+
+		if !found {
+			return nil
+		}
+
+		if err = validateField(field.Name, field.Tag.Get("validate"), ptrValue); err != nil {
+			return fmt.Errorf("field %s preload failed: %w", field.Name, err)
+		}
 		fieldValue.Set(ptrValue)
 		return nil
 	}
 
-	err := c.Decode(loadCtx, ct.Namespace, ct.Key, fieldValue.Addr().Interface(), driver.GetDecoderOrDefault(ct.Format))
+	// decode into a copy, so that the field is not changed if the value is invalid
+	ptrValue := reflect.New(field.Type)
+	ptrValue.Elem().Set(fieldValue)
+	found, err := c.decodeTag(loadCtx, ct, ptrValue)
 	loadCancel()
 	if err != nil {
 		return fmt.Errorf("field %s preload failed: %w", field.Name, err)
 	}
+
+	if !found {
+		return nil
+	}
+
+	if err = validateField(field.Name, field.Tag.Get("validate"), ptrValue); err != nil {
+		return fmt.Errorf("field %s preload failed: %w", field.Name, err)
+	}
+	fieldValue.Set(ptrValue.Elem())
 	return nil
 }
 
@@ -133,25 +253,62 @@ func (c *Configure) loadUnexportedNotPtrField(field reflect.StructField, fieldVa
 		c.logger.Warnf("Field %s is not a pointer, lazy/watch options are ignored", field.Name)
 	}
 
-	dst := reflect.NewAt(field.Type, unsafe.Pointer(fieldValue.UnsafeAddr())).Interface()
+	// decode into a copy, so that the field is not changed if the value is invalid
+	dst := reflect.NewAt(field.Type, unsafe.Pointer(fieldValue.UnsafeAddr())).Elem()
+	ptrValue := reflect.New(field.Type)
+	ptrValue.Elem().Set(dst)
 	loadCtx, loadCancel := context.WithTimeout(context.Background(), loadTimeout)
-	err := c.Decode(loadCtx, ct.Namespace, ct.Key, dst, driver.GetDecoderOrDefault(ct.Format))
+	found, err := c.decodeTag(loadCtx, ct, ptrValue)
 	loadCancel()
 	if err != nil {
 		return fmt.Errorf("field %s preload failed: %w", field.Name, err)
 	}
+
+	if !found {
+		return nil
+	}
+
+	if err = validateField(field.Name, field.Tag.Get("validate"), ptrValue); err != nil {
+		return fmt.Errorf("field %s preload failed: %w", field.Name, err)
+	}
+
+	dst.Set(ptrValue.Elem())
 	return nil
 }
 
 func (c *Configure) handleLazyOrWatchedField(field reflect.StructField, fieldValue reflect.Value, ct configTag, funcs FieldLazyLoadMap, loadTimeout time.Duration) error {
 	fieldPtr := fieldValue.Addr().UnsafePointer()
 	fieldType := field.Type.Elem()
+	rules := field.Tag.Get("validate")
 	if ct.Watch {
-		callbackOk := c.OnKeyChange(ct.Namespace, ct.Key, func(b []byte) error {
+		decodeField := func(b []byte) (reflect.Value, error) {
 			ptrValue := reflect.New(fieldType)
 			fn := driver.GetDecoderOrDefault(ct.Format)
-			err := fn(b, ptrValue.Interface())
+			if err := fn(b, ptrValue.Interface()); err != nil {
+				return ptrValue, err
+			}
+			if err := decryptNested(ct.Namespace, ct.Key, b, ptrValue.Interface()); err != nil {
+				return ptrValue, err
+			}
+			return ptrValue, validateField(field.Name, rules, ptrValue)
+		}
+
+		// the invalid value vetoes the reload in the prepare phase, the deleted key is ignored like OnKeyChange
+		if c.transactional && !c.OnKeyPrepare(ct.Namespace, ct.Key, func(b []byte) error {
+			if b == nil {
+				return nil
+			}
+			_, err := decodeField(b)
+			return err
+		}) {
+			return fmt.Errorf("key: %s %s not watchable but %s is watched", ct.Namespace, ct.Key, field.Name)
+		}
+
+		callbackOk := c.OnKeyChange(ct.Namespace, ct.Key, func(b []byte) error {
+			ptrValue, err := decodeField(b)
 			if err != nil {
+				// keep the old value if the new value is invalid
+				c.logger.Errorf("field %s reload rejected, keep the old value: %s", field.Name, err.Error())
 				return err
 			}
 
@@ -167,12 +324,21 @@ func (c *Configure) handleLazyOrWatchedField(field reflect.StructField, fieldVal
 	loadFunc := func() error {
 		loadCtx, loadCancel := context.WithTimeout(context.Background(), loadTimeout)
 		ptrValue := reflect.New(fieldType)
-		err := c.Decode(loadCtx, ct.Namespace, ct.Key, ptrValue.Interface(), driver.GetDecoderOrDefault(ct.Format))
+		found, err := c.decodeTag(loadCtx, ct, ptrValue)
 		loadCancel()
 		if err != nil {
 			return err
 		}
 
+		// the optional field without default value keeps nil
+		if !found {
+			return nil
+		}
+
+		if err = validateField(field.Name, rules, ptrValue); err != nil {
+			return err
+		}
+
 		atomic.StorePointer((*unsafe.Pointer)(fieldPtr), ptrValue.UnsafePointer())
 		return nil
 	}
@@ -189,6 +355,30 @@ func (c *Configure) handleLazyOrWatchedField(field reflect.StructField, fieldVal
 	return nil
 }
 
+// decodeTag decodes the value of the tag key into ptr.
+// if the key not found and the tag is optional, the default value is decoded by the format of the tag,
+// and found is false when the optional key not found and no default value.
+func (c *Configure) decodeTag(ctx context.Context, ct configTag, ptr reflect.Value) (found bool, err error) {
+	fn := driver.GetDecoderOrDefault(ct.Format)
+	err = c.Decode(ctx, ct.Namespace, ct.Key, ptr.Interface(), fn)
+	if err == nil {
+		return true, nil
+	}
+
+	if !ct.Optional || !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+
+	if !ct.HasDefault {
+		return false, nil
+	}
+
+	if err = fn([]byte(ct.Default), ptr.Interface()); err != nil {
+		return false, fmt.Errorf("invalid default value %s: %w", ct.Default, err)
+	}
+	return true, nil
+}
+
 func validateDst(dst any) (reflect.Value, error) {
 	v := reflect.ValueOf(dst)
 	if v.Kind() != reflect.Ptr {
@@ -209,22 +399,26 @@ type configTag struct {
 	Format    string
 	Lazy      bool
 	Watch     bool
+	// Optional indicates the key may not exist, the field uses the default value or keeps zero.
+	Optional bool
+	// Default is the literal default value of the optional key, it is decoded by the format.
+	Default    string
+	HasDefault bool
 }
 
 func parseConfigTag(tag string) (configTag, error) {
 	var ct configTag
-	kvs := strings.Split(tag, ";")
-	for _, kv := range kvs {
-		if strings.TrimSpace(kv) == "" {
-			continue
-		}
+	opts, err := splitTag(tag)
+	if err != nil {
+		return ct, fmt.Errorf("invalid config tag: %s: %w", tag, err)
+	}
 
-		i := strings.Index(kv, ":")
-		if i <= 0 {
+	for _, opt := range opts {
+		if opt.key == "" || !opt.hasValue {
 			return ct, fmt.Errorf("invalid config tag: %s", tag)
 		}
-		key := strings.TrimSpace(kv[:i])
-		value := strings.TrimSpace(kv[i+1:])
+
+		key, value := opt.key, opt.value
 		switch key {
 		case "key":
 			ct.Key = value
@@ -244,12 +438,99 @@ func parseConfigTag(tag string) (configTag, error) {
 				return ct, fmt.Errorf("invalid watch value in config tag: %s", value)
 			}
 			ct.Watch = watch
+		case "optional":
+			optional, err := strconv.ParseBool(value)
+			if err != nil {
+				return ct, fmt.Errorf("invalid optional value in config tag: %s", value)
+			}
+			ct.Optional = optional
+		case "default":
+			// the key with default value is optional
+			ct.Default = value
+			ct.HasDefault = true
+			ct.Optional = true
 		}
 	}
 
-	if ct.Key == "" || ct.Namespace == "" {
-		return ct, fmt.Errorf("config tag must have key and namespace, tag: %s", tag)
+	return ct, nil
+}
+
+// tagOption is an option of the config or validate tag, LIKE: key:name, required
+type tagOption struct {
+	key   string
+	value string
+	// hasValue indicates the option has the ':' separator, LIKE: default: is an empty default value.
+	hasValue bool
+}
+
+func (o tagOption) String() string {
+	if !o.hasValue {
+		return o.key
 	}
+	return o.key + ":" + o.value
+}
 
-	return ct, nil
+// splitTag splits the tag into the options separated by ';', the key and the value are trimmed.
+// the value quoted by single quotes can contain ';' and is kept as is without the quotes,
+// LIKE: default:'a;b', regex:'^[a-z;]+$'. a single quote in the quoted value is written as two single quotes.
+func splitTag(tag string) ([]tagOption, error) {
+	var opts []tagOption
+	for i := 0; i < len(tag); {
+		end := strings.IndexByte(tag[i:], ';')
+		if end < 0 {
+			end = len(tag)
+		} else {
+			end += i
+		}
+
+		colon := strings.IndexByte(tag[i:end], ':')
+		if colon < 0 {
+			if key := strings.TrimSpace(tag[i:end]); key != "" {
+				opts = append(opts, tagOption{key: key})
+			}
+			i = end + 1
+			continue
+		}
+
+		opt := tagOption{key: strings.TrimSpace(tag[i : i+colon]), hasValue: true}
+		rest := strings.TrimLeft(tag[i+colon+1:], " ")
+		if !strings.HasPrefix(rest, "'") {
+			opt.value = strings.TrimSpace(tag[i+colon+1 : end])
+			opts = append(opts, opt)
+			i = end + 1
+			continue
+		}
+
+		// the quoted value ends at the single quote not followed by another one
+		var sb strings.Builder
+		j, closed := 1, false
+		for j < len(rest) {
+			if rest[j] != '\'' {
+				sb.WriteByte(rest[j])
+				j++
+				continue
+			}
+			if j+1 < len(rest) && rest[j+1] == '\'' {
+				sb.WriteByte('\'')
+				j += 2
+				continue
+			}
+			closed = true
+			j++
+			break
+		}
+		if !closed {
+			return nil, fmt.Errorf("unterminated quoted value of %s", opt.key)
+		}
+
+		after := strings.TrimLeft(rest[j:], " ")
+		if after != "" && after[0] != ';' {
+			return nil, fmt.Errorf("unexpected %s after the quoted value of %s", after, opt.key)
+		}
+		opt.value = sb.String()
+		opts = append(opts, opt)
+		i = len(tag) - len(after) + 1
+	}
+
+	return opts, nil
 }
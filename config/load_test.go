@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 	"unsafe"
@@ -29,6 +32,11 @@ type configDemo struct {
 	notExist *string   `config:"namespace:test/demo1;key:notExist;lazy:true"`
 }
 
+// loadPointer loads the pointer field atomically, the watched pointer field is stored by the hooks atomically.
+func loadPointer[T any](p **T) *T {
+	return (*T)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(p))))
+}
+
 type addrDemo struct {
 	Province string `yaml:"province"`
 	City     string `yaml:"city"`
@@ -108,3 +116,189 @@ func TestConfigure_InitAndPreload(t *testing.T) {
 	}
 	fmt.Println(err)
 }
+
+func TestConfigure_InitAndPreload_Optional(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("name: demo\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	var c struct {
+		Name    string        `config:"namespace:app;key:name;default:unknown"`
+		Timeout time.Duration `config:"namespace:app;key:timeout;default:3s"`
+		Host    string        `config:"namespace:app;key:host;optional:true"`
+		retry   *int          `config:"namespace:app;key:retry;optional:true;watch:true"`
+		port    *int          `config:"namespace:app;key:port;default:8080;watch:true"`
+		DSN     string        `config:"namespace:app;key:dsn;default:'user:pass@/db?a=1;b=2'"`
+	}
+	_, err = engine.InitAndPreload(&c, time.Second)
+	testz.Nil(t, err)
+	testz.Equal(t, "demo", c.Name)
+	testz.Equal(t, 3*time.Second, c.Timeout)
+	testz.Equal(t, "", c.Host)
+	if c.retry != nil {
+		t.Errorf("retry should be nil")
+	}
+	testz.Equal(t, 8080, *c.port)
+	testz.Equal(t, "user:pass@/db?a=1;b=2", c.DSN)
+
+	testz.Nil(t, os.WriteFile(file, []byte("name: demo\nretry: 5\nport: 9090\n"), 0666))
+	eventually(t, func() bool {
+		retry := loadPointer(&c.retry)
+		return retry != nil && *retry == 5 && *loadPointer(&c.port) == 9090
+	})
+	testz.Equal(t, 5, *c.retry)
+	testz.Equal(t, 9090, *c.port)
+
+	var c2 struct {
+		Port int `config:"namespace:app;key:none;default:abc"`
+	}
+	_, err = engine.InitAndPreload(&c2, time.Second)
+	if err == nil {
+		t.Errorf("invalid default value should be error")
+	}
+}
+
+func TestParseConfigTag(t *testing.T) {
+	ct, err := parseConfigTag(`namespace:app; key:dsn ;default:'user:pass@/db?a=1;b=2';watch:true`)
+	testz.Nil(t, err)
+	testz.Equal(t, configTag{Namespace: "app", Key: "dsn", Watch: true, Optional: true,
+		Default: "user:pass@/db?a=1;b=2", HasDefault: true}, ct)
+
+	// the quoted value is kept as is, and the single quote is written as two
+	ct, err = parseConfigTag(`key:motd;default:' it''s; ok '`)
+	testz.Nil(t, err)
+	testz.Equal(t, " it's; ok ", ct.Default)
+
+	// the empty default value
+	ct, err = parseConfigTag(`key:motd;default:`)
+	testz.Nil(t, err)
+	testz.Equal(t, true, ct.HasDefault)
+	testz.Equal(t, "", ct.Default)
+
+	for _, tag := range []string{`key:dsn;default:'a;b`, `key:dsn;default:'a' b`, `key:dsn;lazy`} {
+		_, err = parseConfigTag(tag)
+		testz.Equal(t, true, err != nil, tag)
+	}
+}
+
+type httpCfg struct {
+	Port    int           `config:"key:port"`
+	timeout *string       `config:"key:timeout;watch:true"`
+	addr    *addrDemo     `config:"namespace:test/demo1;key:addr;lazy:true"`
+	Limits  []limitConfig `config:"namespace:app"`
+}
+
+type limitConfig struct {
+	Rate int `config:"key:rate"`
+}
+
+type baseCfg struct {
+	Name string `config:"key:name"`
+}
+
+type serverCfg struct {
+	baseCfg `config:"namespace:app"`
+	HTTP    httpCfg  `config:"namespace:app"`
+	db      *dbCfg   `config:"namespace:db"`
+	Ignored struct{} `json:"ignored"`
+}
+
+type dbCfg struct {
+	Host string `config:"key:host"`
+	pool *int   `config:"key:pool;lazy:true"`
+}
+
+func TestConfigure_InitAndPreload_Nested(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("name: demo\nport: 80\ntimeout: 1s\nrate: 10\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "db.yaml"), []byte("host: 127.0.0.1\npool: 8\n"), 0666))
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "demo.yaml"), []byte("addr:\n  province: sichuan\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source: "file://" + dir,
+			Configs: []meta.Rule{
+				{Namespace: "app", Path: "app.yaml", Watch: true},
+				{Namespace: "db", Path: "db.yaml"},
+				{Namespace: "test/demo1", Path: "demo.yaml"},
+			},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	c := serverCfg{HTTP: httpCfg{Limits: make([]limitConfig, 2)}}
+	funcs, err := engine.InitAndPreload(&c, time.Second)
+	testz.Nil(t, err)
+	testz.Equal(t, "demo", c.Name)
+	testz.Equal(t, 80, c.HTTP.Port)
+	testz.Equal(t, "1s", *c.HTTP.timeout)
+	testz.Equal(t, 10, c.HTTP.Limits[1].Rate)
+	testz.Equal(t, "127.0.0.1", c.db.Host)
+	if c.HTTP.addr != nil || c.db.pool != nil {
+		t.Errorf("lazy fields should be nil")
+	}
+
+	_, err = engine.TryLoad(unsafe.Pointer(&c.HTTP.addr), funcs)
+	testz.Nil(t, err)
+	testz.Equal(t, "sichuan", c.HTTP.addr.Province)
+
+	_, err = engine.TryLoad(unsafe.Pointer(&c.db.pool), funcs)
+	testz.Nil(t, err)
+	testz.Equal(t, 8, *c.db.pool)
+
+	testz.Nil(t, os.WriteFile(file, []byte("name: demo\nport: 80\ntimeout: 2s\nrate: 10\n"), 0666))
+	eventually(t, func() bool { return *loadPointer(&c.HTTP.timeout) == "2s" })
+	testz.Equal(t, "2s", *c.HTTP.timeout)
+
+	var bad struct {
+		Inner struct {
+			Port int `config:"key:port"`
+		}
+	}
+	_, err = engine.InitAndPreload(&bad, time.Second)
+	if err == nil {
+		t.Errorf("nested field without namespace should be error")
+	}
+}
+
+type nodeCfg struct {
+	Name string `config:"namespace:app;key:name"`
+	Next *nodeCfg
+}
+
+func TestConfigure_InitAndPreload_Recursive(t *testing.T) {
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: demo\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml"}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the nil pointer of the self-referential type is not allocated forever
+	var n nodeCfg
+	_, err = engine.InitAndPreload(&n, time.Second)
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "field Next: self-referential type"))
+	testz.Equal(t, true, n.Next == nil)
+
+	var list struct {
+		Head nodeCfg
+	}
+	_, err = engine.InitAndPreload(&list, time.Second)
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "field Head.Next: self-referential type"))
+}
@@ -13,8 +13,21 @@ type Rule struct {
 	Namespace string `json:"namespace" yaml:"namespace"`
 	Path      string `json:"path" yaml:"path"`
 	Watch     bool   `json:"watch" yaml:"watch"`
+	// Merge is the merge policy of the files matched by a glob or directory path of the file source,
+	// MergeOverride by default.
+	Merge string `json:"merge,omitempty" yaml:"merge,omitempty"`
+	// Poll watches the files of the file source by polling instead of the file system notification,
+	// LIKE: the files on NFS or FUSE mounts where the notification never arrives. it implies Watch.
+	Poll bool `json:"poll,omitempty" yaml:"poll,omitempty"`
 }
 
+const (
+	// MergeOverride merges the files in lexical order, the later file wins when a key is defined in multiple files.
+	MergeOverride = "override"
+	// MergeError fails the load when a key is defined in multiple files.
+	MergeError = "error"
+)
+
 func (c *Config) SourceSchema() string {
 	i := strings.Index(c.Source, "://")
 	if i >= 0 {
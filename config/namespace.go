@@ -0,0 +1,189 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+)
+
+// OnNamespaceReload registers a hook that is called with all the changed keys of the namespace together,
+// once per file reload or etcd revision, so that the related keys like user and password are applied at once.
+// changed maps the key to the new effective value, the value is nil if the key is deleted.
+// the values are decrypted, and interpolated if interpolation is enabled.
+func (c *Configure) OnNamespaceReload(namespace string, hook func(changed map[string][]byte) error) bool {
+	ok := c.onBatchEvent(namespace, func(events []KeyEvent) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		var errs []error
+		for _, group := range splitByRevision(events) {
+			changed := make(map[string][]byte, len(group))
+			for _, ev := range group {
+				value := ev.NewValue
+				if ev.Type == EventDeleted {
+					value = nil
+				} else if c.interpolate {
+					b, err := c.interpolateBytes(ctx, namespace, ev.Key, value)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("key %s: %w", ev.Key, err))
+						continue
+					}
+					value = b
+				}
+				changed[ev.Key] = value
+			}
+
+			if err := hook(changed); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+
+	if !ok {
+		c.logger.Warnf("OnNamespaceReload register failed: namespace=%s", namespace)
+	}
+	return ok
+}
+
+// splitByRevision splits the events into groups of the consecutive events with the same revision,
+// the events of a file reload share the same revision, and an etcd watch response may contain several revisions.
+func splitByRevision(events []KeyEvent) [][]KeyEvent {
+	var groups [][]KeyEvent
+	start := 0
+	for i := 1; i <= len(events); i++ {
+		if i == len(events) || events[i].Revision != events[start].Revision {
+			groups = append(groups, events[start:i])
+			start = i
+		}
+	}
+	return groups
+}
+
+type pinCtxKey struct{}
+
+// pins is the pinned namespaces of a Configure in the context.
+type pins struct {
+	cfg        *Configure
+	namespaces map[string]*pinnedNamespace
+}
+
+// pinnedNamespace is the view of the layers of a namespace.
+type pinnedNamespace struct {
+	// listed is the raw values listed from each layer at the time of Pin, nil if the layer can not list its keys.
+	listed []map[string]string
+
+	// mu guards resolved.
+	mu sync.Mutex
+	// resolved is the values of the keys not listed, which are read from each layer by the first read,
+	// LIKE: the env key db.host normalized to DB_HOST, or the layer can not list its keys.
+	resolved []map[string]pinnedValue
+}
+
+type pinnedValue struct {
+	value  string
+	exists bool
+}
+
+// Pin returns a context that pins a consistent view of the namespaces,
+// the reads with the context through Get, String, Decode and so on see the values at the time of Pin,
+// and are not affected by the reloads after it.
+// the keys of each layer are listed at the time of Pin, a file is read at once, and each etcd prefix is listed
+// separately with its cached values, so the values of different prefixes may be at different revisions.
+// the key not listed, LIKE: the key normalized by the driver, or the key of a layer that can not list its keys,
+// is read from the layer by the first read with the context, and the later reads see the same value.
+func (c *Configure) Pin(ctx context.Context, namespaces ...string) (context.Context, error) {
+	p := pins{cfg: c, namespaces: make(map[string]*pinnedNamespace, len(namespaces))}
+	if parent, ok := ctx.Value(pinCtxKey{}).(*pins); ok && parent.cfg == c {
+		for ns, pn := range parent.namespaces {
+			p.namespaces[ns] = pn
+		}
+	}
+
+	for _, ns := range namespaces {
+		layers, ok := c.ds[ns]
+		if !ok {
+			return ctx, fmt.Errorf("namespace %s: %w", ns, ErrNotFound)
+		}
+
+		pn := pinnedNamespace{
+			listed:   make([]map[string]string, len(layers)),
+			resolved: make([]map[string]pinnedValue, len(layers)),
+		}
+		for i, l := range layers {
+			entries, err := driver.Entries(ctx, l.driver, ns)
+			if err != nil {
+				if errors.Is(err, driver.ErrNotSupported) {
+					continue
+				}
+				return ctx, fmt.Errorf("pin namespace %s from %s failed: %w", ns, l.source, err)
+			}
+
+			values := make(map[string]string, len(entries))
+			for _, e := range entries {
+				values[e.Key] = string(e.Value)
+			}
+			pn.listed[i] = values
+		}
+		p.namespaces[ns] = &pn
+	}
+
+	return context.WithValue(ctx, pinCtxKey{}, &p), nil
+}
+
+// getPinned gets the raw value of the literal key from the pinned namespace, the higher layer overrides the lower layer.
+// pinned is false if the namespace is not pinned in the context.
+func (c *Configure) getPinned(ctx context.Context, namespace, key string) (value string, pinned bool, err error) {
+	p, ok := ctx.Value(pinCtxKey{}).(*pins)
+	if !ok || p.cfg != c {
+		return "", false, nil
+	}
+
+	pn, ok := p.namespaces[namespace]
+	if !ok {
+		return "", false, nil
+	}
+
+	layers := c.ds[namespace]
+	for i := len(layers) - 1; i >= 0; i-- {
+		if value, ok := pn.listed[i][key]; ok {
+			return value, true, nil
+		}
+
+		v, err := pn.resolve(ctx, i, layers[i], namespace, key)
+		if err != nil {
+			return "", true, err
+		}
+		if v.exists {
+			return v.value, true, nil
+		}
+	}
+
+	return "", true, ErrNotFound
+}
+
+// resolve reads the key not listed from the layer i once, and keeps the value for the later reads.
+func (pn *pinnedNamespace) resolve(ctx context.Context, i int, l layer, namespace, key string) (pinnedValue, error) {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+
+	if v, ok := pn.resolved[i][key]; ok {
+		return v, nil
+	}
+
+	s, err := l.driver.GetString(ctx, namespace, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return pinnedValue{}, err
+	}
+
+	v := pinnedValue{value: s, exists: err == nil}
+	if pn.resolved[i] == nil {
+		pn.resolved[i] = make(map[string]pinnedValue)
+	}
+	pn.resolved[i][key] = v
+	return v, nil
+}
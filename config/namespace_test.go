@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+)
+
+func TestConfigure_OnNamespaceReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("user: root\npassword: pwd\nhost: localhost\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	var (
+		mu      sync.Mutex
+		reloads []map[string][]byte
+	)
+	ok := engine.OnNamespaceReload("db", func(changed map[string][]byte) error {
+		mu.Lock()
+		reloads = append(reloads, changed)
+		mu.Unlock()
+		return nil
+	})
+	testz.Equal(t, true, ok)
+
+	testz.Nil(t, os.WriteFile(file, []byte("user: admin\npassword: pwd2\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reloads) >= 1
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	testz.Equal(t, 1, len(reloads))
+	testz.Equal(t, map[string][]byte{
+		"user":     []byte("admin"),
+		"password": []byte("pwd2"),
+		"host":     nil,
+	}, reloads[0])
+}
+
+func TestConfigure_Pin(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("user: root\npassword: pwd\nmaster:\n  port: 3306\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx, err := engine.Pin(context.Background(), "db")
+	testz.Nil(t, err)
+
+	testz.Nil(t, os.WriteFile(file, []byte("user: admin\npassword: pwd2\nmaster:\n  port: 3307\n"), 0666))
+	eventually(t, func() bool {
+		user, err := engine.String(context.Background(), "db", "user")
+		return err == nil && user == "admin"
+	})
+
+	user, err := engine.String(ctx, "db", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "root", user)
+	password, err := engine.String(ctx, "db", "password")
+	testz.Nil(t, err)
+	testz.Equal(t, "pwd", password)
+	port, err := engine.Int(ctx, "db", "master.port")
+	testz.Nil(t, err)
+	testz.Equal(t, 3306, port)
+
+	user, err = engine.String(context.Background(), "db", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "admin", user)
+
+	_, err = engine.Pin(context.Background(), "none")
+	testz.Equal(t, true, err != nil)
+}
+
+func TestConfigure_PinLayers(t *testing.T) {
+	t.Setenv("GOLT_PIN_DB_HOST", "127.0.0.1")
+
+	bd := newBaseDriver(map[string]string{"user": "root"})
+	driver.RegisterDriver("base-pin", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return bd, nil
+	})
+
+	engine, err := NewConfigure([]meta.Config{
+		{Source: "env://GOLT_PIN_", Configs: []meta.Rule{{Namespace: "app", Path: ""}}},
+		{Source: "base-pin://", Configs: []meta.Rule{{Namespace: "app", Path: "/app/"}}},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the layer can not list its keys does not fail the Pin
+	ctx, err := engine.Pin(context.Background(), "app")
+	testz.Nil(t, err)
+
+	// the keys normalized by the env driver are found like the reads without Pin
+	for _, key := range []string{"db.host", "DB_HOST", "db_host"} {
+		host, err := engine.String(ctx, "app", key)
+		testz.Nil(t, err)
+		testz.Equal(t, "127.0.0.1", host, key)
+	}
+
+	// the key of the layer can not list its keys keeps the value of the first read
+	user, err := engine.String(ctx, "app", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "root", user)
+
+	bd.set("user", "admin")
+	user, err = engine.String(ctx, "app", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "root", user)
+
+	user, err = engine.String(context.Background(), "app", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "admin", user)
+
+	_, err = engine.String(ctx, "app", "none")
+	testz.Equal(t, ErrNotFound, err)
+}
+
+func TestSplitByRevision(t *testing.T) {
+	events := []KeyEvent{
+		{Key: "a", Revision: 1},
+		{Key: "b", Revision: 1},
+		{Key: "c", Revision: 2},
+		{Key: "d", Revision: 3},
+		{Key: "e", Revision: 3},
+	}
+
+	groups := splitByRevision(events)
+	testz.Equal(t, 3, len(groups))
+	testz.Equal(t, 2, len(groups[0]))
+	testz.Equal(t, "c", groups[1][0].Key)
+	testz.Equal(t, 2, len(groups[2]))
+	testz.Equal(t, 0, len(splitByRevision(nil)))
+}
@@ -9,7 +9,11 @@ import (
 	"time"
 
 	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/driver/consul"
+	"github.com/welllog/golt/config/driver/env"
 	"github.com/welllog/golt/config/driver/etcd"
+	"github.com/welllog/golt/config/driver/file"
+	"github.com/welllog/golt/config/driver/remote"
 	"github.com/welllog/golt/config/meta"
 	"github.com/welllog/golt/contract"
 	"github.com/welllog/olog"
@@ -36,31 +40,83 @@ func NewConfigure(cfs []meta.Config, options ...Option) (*Configure, error) {
 		opts.logger = logger
 	}
 
-	etcdOpts := make([]etcd.Option, 0, 4)
+	etcdOpts := make([]etcd.Option, 0, 5)
 	if opts.etcdWatchCommonPrefixMinLen != 0 {
 		etcdOpts = append(etcdOpts, etcd.WithCommonPrefixMinLen(opts.etcdWatchCommonPrefixMinLen))
 	}
 	if opts.etcdPreload {
 		etcdOpts = append(etcdOpts, etcd.WithPreload())
 	}
+	if opts.etcdCacheDir != "" {
+		etcdOpts = append(etcdOpts, etcd.WithCacheDir(opts.etcdCacheDir))
+	}
+	if opts.etcdLoadTimeout > 0 {
+		etcdOpts = append(etcdOpts, etcd.WithLoadTimeout(opts.etcdLoadTimeout))
+	}
 	if opts.closeEtcdCli {
 		etcdOpts = append(etcdOpts, etcd.WithCloseCustomEtcdClient())
 	}
 
+	fs := make(factories, 6)
 	if opts.etcdCli != nil {
 		etcdOpts2 := append(etcdOpts, etcd.WithCustomEtcdClient(opts.etcdCli))
-		driver.RegisterDriver("custom_etcd", func(c meta.Config, l contract.Logger) (driver.Driver, error) {
+		fs["custom_etcd"] = func(c meta.Config, l contract.Logger) (driver.Driver, error) {
 			return etcd.NewAdvanced(c, l, etcdOpts2...)
-		})
+		}
 	}
 
 	if len(etcdOpts) > 0 {
-		driver.RegisterDriver("etcd", func(c meta.Config, l contract.Logger) (driver.Driver, error) {
+		fs["etcd"] = func(c meta.Config, l contract.Logger) (driver.Driver, error) {
 			return etcd.NewAdvanced(c, l, etcdOpts...)
-		})
+		}
+	}
+
+	if opts.filePollInterval > 0 {
+		fs["file"] = func(c meta.Config, l contract.Logger) (driver.Driver, error) {
+			return file.NewAdvanced(c, l, file.WithPollInterval(opts.filePollInterval))
+		}
+	}
+
+	if len(opts.httpOpts) > 0 {
+		newHTTP := func(c meta.Config, l contract.Logger) (driver.Driver, error) {
+			return remote.NewAdvanced(c, l, opts.httpOpts...)
+		}
+		fs["http"] = newHTTP
+		fs["https"] = newHTTP
 	}
 
-	return newConfigure(cfs, opts.logger)
+	consulOpts := make([]consul.Option, 0, 2)
+	if opts.consulToken != "" {
+		consulOpts = append(consulOpts, consul.WithToken(opts.consulToken))
+	}
+	if opts.consulPreload {
+		consulOpts = append(consulOpts, consul.WithPreload())
+	}
+
+	if len(consulOpts) > 0 {
+		fs["consul"] = func(c meta.Config, l contract.Logger) (driver.Driver, error) {
+			return consul.NewAdvanced(c, l, consulOpts...)
+		}
+	}
+
+	if len(opts.envDotFiles) > 0 {
+		fs["env"] = func(c meta.Config, l contract.Logger) (driver.Driver, error) {
+			return env.NewAdvanced(c, l, env.WithDotEnvFiles(opts.envDotFiles...))
+		}
+	}
+
+	return newConfigure(cfs, opts, fs)
+}
+
+// factories overlays the driver registry with the drivers built from the options of a Configure,
+// so the options do not leak into the other Configures.
+type factories map[string]func(meta.Config, contract.Logger) (driver.Driver, error)
+
+func (f factories) new(c meta.Config, logger contract.Logger) (driver.Driver, error) {
+	if factory, ok := f[c.SourceSchema()]; ok {
+		return factory(c, logger)
+	}
+	return driver.New(c, logger)
 }
 
 func FromFile(file string, options ...Option) (*Configure, error) {
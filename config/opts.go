@@ -1,6 +1,10 @@
 package config
 
 import (
+	"crypto/tls"
+	"time"
+
+	"github.com/welllog/golt/config/driver/remote"
 	"github.com/welllog/golt/contract"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -12,7 +16,19 @@ type configOptions struct {
 	etcdCli                     *clientv3.Client
 	etcdWatchCommonPrefixMinLen int
 	etcdPreload                 bool
+	etcdCacheDir                string
+	etcdLoadTimeout             time.Duration
 	closeEtcdCli                bool
+	envDotFiles                 []string
+	filePollInterval            time.Duration
+	httpOpts                    []remote.Option
+	consulToken                 string
+	consulPreload               bool
+	interpolate                 bool
+	transactional               bool
+	historySize                 int
+	historySinks                []HistorySink
+	historyHashKey              []byte
 }
 
 func WithLogger(logger contract.Logger) Option {
@@ -44,3 +60,128 @@ func WithEtcdPreload() Option {
 		opts.etcdPreload = true
 	}
 }
+
+// WithEtcdCacheDir persists the last-known-good values of etcd to the dir, it implies WithEtcdPreload.
+// if etcd is unreachable at startup, the etcd driver starts from the cache in degraded mode,
+// see Configure.Health.
+func WithEtcdCacheDir(dir string) Option {
+	return func(opts *configOptions) {
+		opts.etcdCacheDir = dir
+	}
+}
+
+// WithEtcdLoadTimeout sets the timeout of loading all keys of an etcd prefix, default is 1 minute.
+// with WithEtcdCacheDir, the preload of all prefixes shares the timeout before falling back to the cache, default is 10 seconds.
+func WithEtcdLoadTimeout(timeout time.Duration) Option {
+	return func(opts *configOptions) {
+		opts.etcdLoadTimeout = timeout
+	}
+}
+
+// WithEnvDotFiles sets the .env files used as fallback by the env driver, the earlier file has higher priority.
+func WithEnvDotFiles(files ...string) Option {
+	return func(opts *configOptions) {
+		opts.envDotFiles = files
+	}
+}
+
+// WithFilePollInterval sets the interval of the polling watcher of the file driver, default is 2 seconds.
+// the polling watcher is used by the rules with poll, or when the file system notification is unavailable.
+func WithFilePollInterval(interval time.Duration) Option {
+	return func(opts *configOptions) {
+		opts.filePollInterval = interval
+	}
+}
+
+// WithInterpolation enables the expansion of references in the config values:
+// ${ENV} and ${ENV:-default} reference the environment variables,
+// ${namespace:key} and ${namespace:key:-default} reference other config keys.
+// use $${ to escape the literal ${.
+func WithInterpolation() Option {
+	return func(opts *configOptions) {
+		opts.interpolate = true
+	}
+}
+
+// WithTransactionalReload enables the two-phase reload for the validators of InitAndPreload and Watch:
+// the new value of a watched key is validated before the reload is cached,
+// the invalid value rejects the whole reload and the previous values are kept visible to Get, see OnKeyPrepare.
+func WithTransactionalReload() Option {
+	return func(opts *configOptions) {
+		opts.transactional = true
+	}
+}
+
+// WithHistory keeps the latest size change records of each watched key, see Configure.History.
+func WithHistory(size int) Option {
+	return func(opts *configOptions) {
+		opts.historySize = size
+	}
+}
+
+// WithHistorySink writes every change record to the sink, LIKE: NewJSONLinesSink,
+// it enables the history of the default size 16 if WithHistory is not set.
+func WithHistorySink(sink HistorySink) Option {
+	return func(opts *configOptions) {
+		opts.historySinks = append(opts.historySinks, sink)
+	}
+}
+
+// WithHistoryHashKey sets the key of the hmac of the values in the change records,
+// so that the hashes in the sinks can be compared across restarts and replicas which share the key.
+// the key should be kept secret like the values, default is a random key of each Configure.
+func WithHistoryHashKey(key []byte) Option {
+	return func(opts *configOptions) {
+		opts.historyHashKey = key
+	}
+}
+
+// WithHTTPHeader adds the header to every request of the http driver, LIKE: Authorization: Bearer xxx.
+func WithHTTPHeader(key, value string) Option {
+	return func(opts *configOptions) {
+		opts.httpOpts = append(opts.httpOpts, remote.WithHeader(key, value))
+	}
+}
+
+// WithHTTPTLSConfig sets the tls config of the https driver, LIKE: the private CA or the client certificate.
+func WithHTTPTLSConfig(config *tls.Config) Option {
+	return func(opts *configOptions) {
+		opts.httpOpts = append(opts.httpOpts, remote.WithTLSConfig(config))
+	}
+}
+
+// WithHTTPTimeout sets the timeout of a request of the http driver, default is 10 seconds.
+func WithHTTPTimeout(timeout time.Duration) Option {
+	return func(opts *configOptions) {
+		opts.httpOpts = append(opts.httpOpts, remote.WithTimeout(timeout))
+	}
+}
+
+// WithHTTPRetry sets the number of retries of a failed request of the http driver and the first backoff,
+// default is 2 retries from 500 milliseconds, the backoff is doubled after each retry.
+func WithHTTPRetry(retries int, backoff time.Duration) Option {
+	return func(opts *configOptions) {
+		opts.httpOpts = append(opts.httpOpts, remote.WithRetry(retries, backoff))
+	}
+}
+
+// WithHTTPPollInterval sets the interval of polling the watched documents of the http driver, default is 10 seconds.
+func WithHTTPPollInterval(interval time.Duration) Option {
+	return func(opts *configOptions) {
+		opts.httpOpts = append(opts.httpOpts, remote.WithPollInterval(interval))
+	}
+}
+
+// WithConsulToken sets the ACL token of the consul driver, default is the env CONSUL_HTTP_TOKEN.
+func WithConsulToken(token string) Option {
+	return func(opts *configOptions) {
+		opts.consulToken = token
+	}
+}
+
+// WithConsulPreload loads all keys of the consul prefixes when the configure is created.
+func WithConsulPreload() Option {
+	return func(opts *configOptions) {
+		opts.consulPreload = true
+	}
+}
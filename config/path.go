@@ -0,0 +1,302 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/welllog/golt/config/driver"
+	"gopkg.in/yaml.v3"
+)
+
+// pathSegment is a segment of the key path, it is a map key or an array index.
+type pathSegment struct {
+	key   string
+	index int
+	// isIndex indicates whether the segment is an array index, LIKE: [0]
+	isIndex bool
+}
+
+// isKeyPath reports whether the key may be a path into the nested value, LIKE: db.master.host, servers[0].port
+func isKeyPath(key string) bool {
+	return strings.ContainsAny(key, ".[")
+}
+
+// parseKeyPath parses the key path into segments.
+func parseKeyPath(path string) ([]pathSegment, error) {
+	var segs []pathSegment
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		var indexes []int
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			name = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("invalid key path: %s", path)
+				}
+
+				n, err := strconv.Atoi(rest[1:end])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index in key path: %s", path)
+				}
+				indexes = append(indexes, n)
+				rest = rest[end+1:]
+			}
+		}
+
+		if name == "" && (len(segs) > 0 || len(indexes) == 0) {
+			return nil, fmt.Errorf("invalid key path: %s", path)
+		}
+
+		if name != "" {
+			segs = append(segs, pathSegment{key: name})
+		}
+		for _, n := range indexes {
+			segs = append(segs, pathSegment{index: n, isIndex: true})
+		}
+	}
+
+	return segs, nil
+}
+
+// splitKeyPath returns the candidates of root key and the rest segments,
+// the shorter root key is in the front, LIKE: a.b.c -> (a, b.c), (a.b, c)
+func splitKeyPath(path string) []keyPathCandidate {
+	var cs []keyPathCandidate
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' && path[i] != '[' {
+			continue
+		}
+
+		rest := path[i:]
+		if rest[0] == '.' {
+			rest = rest[1:]
+		}
+
+		segs, err := parseKeyPath(rest)
+		if err != nil || i == 0 {
+			continue
+		}
+		cs = append(cs, keyPathCandidate{root: path[:i], segs: segs})
+	}
+	return cs
+}
+
+type keyPathCandidate struct {
+	root string
+	segs []pathSegment
+}
+
+// getPath gets the nested value of the key path.
+// the root value which is not a document is a miss, the next root is tried,
+// and its error is returned only if no root resolves the key path.
+func (c *Configure) getPath(ctx context.Context, namespace, path string) ([]byte, error) {
+	var pathErr error
+	for _, kc := range splitKeyPath(path) {
+		b, err := c.getRawNoPath(ctx, namespace, kc.root)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		// the root value may be an encrypted document
+		if b, err = decrypt(namespace, kc.root, b); err != nil {
+			return nil, err
+		}
+
+		sub, ok, err := extractPath(b, kc.segs)
+		if err != nil {
+			if pathErr == nil {
+				pathErr = fmt.Errorf("namespace %s key %s: %w", namespace, kc.root, err)
+			}
+			continue
+		}
+
+		if ok {
+			return sub, nil
+		}
+	}
+
+	if pathErr != nil {
+		return nil, pathErr
+	}
+	return nil, ErrNotFound
+}
+
+// resolveKeyPath returns the root key and the segments of the key path for watching.
+// if the root key not exists now, the first segment is used as the root key.
+func (c *Configure) resolveKeyPath(namespace, path string) (string, []pathSegment, bool) {
+	cs := splitKeyPath(path)
+	if len(cs) == 0 {
+		return "", nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	for _, kc := range cs {
+		if _, err := c.getRawNoPath(ctx, namespace, kc.root); err == nil {
+			return kc.root, kc.segs, true
+		}
+	}
+
+	return cs[0].root, cs[0].segs, true
+}
+
+// extractPath decodes the value as yaml(json is compatible) or toml, and returns the value of the path.
+// the scalar string is returned as is, other values are encoded as json.
+func extractPath(b []byte, segs []pathSegment) ([]byte, bool, error) {
+	var doc any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		var m map[string]any
+		if tomlErr := toml.Unmarshal(b, &m); tomlErr != nil {
+			return nil, false, fmt.Errorf("value is not a yaml/json/toml document: %w", err)
+		}
+		doc = m
+	}
+
+	v, ok := lookupPath(doc, segs)
+	if !ok {
+		return nil, false, nil
+	}
+
+	out, err := encodePathValue(v)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+func lookupPath(v any, segs []pathSegment) (any, bool) {
+	for _, seg := range segs {
+		if v == nil {
+			return nil, false
+		}
+
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Map:
+			if seg.isIndex {
+				return nil, false
+			}
+
+			var found bool
+			iter := rv.MapRange()
+			for iter.Next() {
+				if fmt.Sprint(iter.Key().Interface()) == seg.key {
+					v = iter.Value().Interface()
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case reflect.Slice, reflect.Array:
+			if !seg.isIndex || seg.index >= rv.Len() {
+				return nil, false
+			}
+			v = rv.Index(seg.index).Interface()
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+func encodePathValue(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(val), nil
+	case time.Time:
+		return []byte(val.Format(time.RFC3339Nano)), nil
+	}
+
+	return json.Marshal(normalizePathValue(v))
+}
+
+// normalizePathValue converts the map with non-string keys, which json not supported.
+func normalizePathValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(val))
+		for k, e := range val {
+			m[k] = normalizePathValue(e)
+		}
+		return m
+	case map[any]any:
+		m := make(map[string]any, len(val))
+		for k, e := range val {
+			m[fmt.Sprint(k)] = normalizePathValue(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(val))
+		for i, e := range val {
+			s[i] = normalizePathValue(e)
+		}
+		return s
+	case []map[string]any:
+		s := make([]any, len(val))
+		for i, e := range val {
+			s[i] = normalizePathValue(e)
+		}
+		return s
+	}
+	return v
+}
+
+// pathHook wraps the hook registered on a key path,
+// and only calls the hook when the nested value changes. the root value is decrypted before extracting.
+type pathHook struct {
+	mu   sync.Mutex
+	segs []pathSegment
+	hook func([]byte) error
+	last []byte
+	// exists indicates whether the nested value exists in last change
+	exists bool
+}
+
+func (h *pathHook) handle(b []byte) error {
+	b, err := driver.Decrypt(b)
+	if err != nil {
+		return err
+	}
+
+	sub, ok, err := extractPath(b, h.segs)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// the nested value removed will not trigger the hook
+	if !ok {
+		h.exists = false
+		return nil
+	}
+
+	if h.exists && bytes.Equal(h.last, sub) {
+		return nil
+	}
+
+	h.exists = true
+	h.last = append(h.last[:0], sub...)
+	return h.hook(sub)
+}
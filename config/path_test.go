@@ -0,0 +1,169 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/driver/etcd"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestParseKeyPath(t *testing.T) {
+	segs, err := parseKeyPath("servers[0].port")
+	testz.Nil(t, err)
+	testz.Equal(t, []pathSegment{{key: "servers"}, {index: 0, isIndex: true}, {key: "port"}}, segs)
+
+	segs, err = parseKeyPath("[1][2].a")
+	testz.Nil(t, err)
+	testz.Equal(t, []pathSegment{{index: 1, isIndex: true}, {index: 2, isIndex: true}, {key: "a"}}, segs)
+
+	for _, p := range []string{"a..b", "a[x]", "a[1", "a.", "a[-1]"} {
+		_, err = parseKeyPath(p)
+		if err == nil {
+			t.Errorf("path %s should be invalid", p)
+		}
+	}
+}
+
+func TestConfigure_KeyPath(t *testing.T) {
+	tkv := testKV{}
+	twt := testWatcher{}
+	ctx := context.Background()
+	tkv.Put(ctx, "/v1/path/db", `{"master":{"host":"10.0.0.1","port":3306},"slaves":[{"host":"10.0.0.2"}]}`)
+	driver.RegisterDriver("etcd", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return etcd.NewAdvanced(config, logger, etcd.WithCustomEtcdClient(&clientv3.Client{KV: &tkv, Watcher: &twt}))
+	})
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	content := "db:\n  master:\n    host: 127.0.0.1\n    port: 3306\nservers:\n  - name: a\n    port: 80\n  - name: b\n    port: 81\n"
+	testz.Nil(t, os.WriteFile(file, []byte(content), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+		{
+			Source:  "etcd://127.0.0.1:2379",
+			Configs: []meta.Rule{{Namespace: "remote", Path: "/v1/path/", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	host, err := engine.String(ctx, "app", "db.master.host")
+	testz.Nil(t, err)
+	testz.Equal(t, "127.0.0.1", host)
+
+	port, err := engine.Int(ctx, "app", "servers[1].port")
+	testz.Nil(t, err)
+	testz.Equal(t, 81, port)
+
+	var master struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	testz.Nil(t, engine.JsonDecode(ctx, "app", "db.master", &master))
+	testz.Equal(t, "127.0.0.1", master.Host)
+	testz.Equal(t, 3306, master.Port)
+
+	_, err = engine.String(ctx, "app", "servers[2].port")
+	testz.Equal(t, ErrNotFound, err)
+
+	host, err = engine.String(ctx, "remote", "db.slaves[0].host")
+	testz.Nil(t, err)
+	testz.Equal(t, "10.0.0.2", host)
+
+	var c struct {
+		port int     `config:"namespace:remote;key:db.master.port"`
+		host *string `config:"namespace:app;key:db.master.host;watch:true"`
+	}
+	_, err = engine.InitAndPreload(&c, time.Second)
+	testz.Nil(t, err)
+	testz.Equal(t, 3306, c.port)
+	testz.Equal(t, "127.0.0.1", *c.host)
+
+	var (
+		mu           sync.Mutex
+		hosts, ports []string
+	)
+	record := func(values *[]string) func([]byte) error {
+		return func(b []byte) error {
+			mu.Lock()
+			*values = append(*values, string(b))
+			mu.Unlock()
+			return nil
+		}
+	}
+	hostsLen := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(hosts)
+	}
+	engine.OnKeyChange("app", "db.master.host", record(&hosts))
+	engine.OnKeyChange("app", "db.master.port", record(&ports))
+	engine.OnKeyChange("remote", "db.master.host", record(&hosts))
+
+	// the change of the other key does not trigger the hooks of the key path,
+	// it is checked by the hosts of the next change
+	testz.Nil(t, os.WriteFile(file, []byte(content+"name: changed\n"), 0666))
+	eventually(t, func() bool {
+		name, err := engine.String(ctx, "app", "name")
+		return err == nil && name == "changed"
+	})
+
+	testz.Nil(t, os.WriteFile(file, []byte(strings.Replace(content, "127.0.0.1", "127.0.0.2", 1)), 0666))
+	eventually(t, func() bool { return hostsLen() >= 1 })
+	mu.Lock()
+	testz.Equal(t, []string{"127.0.0.2"}, hosts)
+	testz.Equal(t, 0, len(ports))
+	mu.Unlock()
+	eventually(t, func() bool { return *loadPointer(&c.host) == "127.0.0.2" })
+
+	// etcd only notify the put of the cached key
+	twt.notifyCreate("/v1/path/db", `{"master":{"host":"10.0.0.9","port":3306}}`)
+	eventually(t, func() bool { return hostsLen() >= 2 })
+	mu.Lock()
+	testz.Equal(t, []string{"127.0.0.2", "10.0.0.9"}, hosts)
+	mu.Unlock()
+}
+
+func TestConfigure_KeyPathRootMismatch(t *testing.T) {
+	tkv := testKV{}
+	ctx := context.Background()
+	tkv.Put(ctx, "/v1/mismatch/cache", "{invalid")
+	tkv.Put(ctx, "/v1/mismatch/cache.redis", `{"host":"10.0.0.3"}`)
+	tkv.Put(ctx, "/v1/mismatch/broken", "{invalid")
+	driver.RegisterDriver("etcd", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return etcd.NewAdvanced(config, logger, etcd.WithCustomEtcdClient(&clientv3.Client{KV: &tkv, Watcher: &testWatcher{}}))
+	})
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "etcd://127.0.0.1:2379",
+			Configs: []meta.Rule{{Namespace: "remote", Path: "/v1/mismatch/"}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the root cache is not a document, the next root cache.redis resolves the key path
+	host, err := engine.String(ctx, "remote", "cache.redis.host")
+	testz.Nil(t, err)
+	testz.Equal(t, "10.0.0.3", host)
+
+	// the error is returned if no root resolves the key path
+	_, err = engine.String(ctx, "remote", "broken.host")
+	testz.Equal(t, true, err != nil && !errors.Is(err, ErrNotFound))
+}
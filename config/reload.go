@@ -0,0 +1,196 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+)
+
+// ReloadStatus is the result of the last reload of a namespace validated by the prepare hooks.
+type ReloadStatus struct {
+	Namespace string
+	// Source is the source of the layer reloaded, LIKE: file://etc/, etcd://127.0.0.1:2379
+	Source string
+	// Rejected indicates the reload is vetoed by a prepare hook, and the previous values are kept.
+	Rejected bool
+	// Err is the error that vetoes the reload.
+	Err error
+	// Keys is the changed keys of the reload.
+	Keys []string
+	// Revision is the etcd mod revision, or the modify time in unix nano of the file.
+	Revision int64
+	At       time.Time
+}
+
+// preparer dispatches the changed keys of a namespace reload to the prepare hooks of the keys.
+type preparer struct {
+	mu    sync.RWMutex
+	hooks map[string][]prepareHook
+}
+
+type prepareHook struct {
+	// segs is the nested path in the value of the key, nil means the whole value.
+	segs []pathSegment
+	hook func([]byte) error
+}
+
+// OnKeyPrepare registers a hook that validates the new effective value of the key before a reload is cached,
+// this is the prepare phase of the two-phase reload. if the hook returns an error,
+// the whole reload of the file or etcd watch response is rejected, the previous values are kept visible to Get,
+// and the hooks of OnKeyChange are not called. the value is nil if the key is deleted.
+// the rejection is logged and reported by ReloadStatus.
+// the key can be a path into the nested value like OnKeyChange.
+func (c *Configure) OnKeyPrepare(namespace, key string, hook func([]byte) error) bool {
+	ph := prepareHook{hook: hook}
+	if isKeyPath(key) && !c.hasKey(namespace, key) {
+		if root, segs, ok := c.resolveKeyPath(namespace, key); ok {
+			key, ph.segs = root, segs
+		}
+	}
+
+	c.prepMu.Lock()
+	defer c.prepMu.Unlock()
+
+	p, ok := c.preparers[namespace]
+	if !ok {
+		p = &preparer{hooks: make(map[string][]prepareHook)}
+		var registered bool
+		for i, l := range c.ds[namespace] {
+			idx, source := i, l.source
+			if driver.OnBatchPrepare(l.driver, namespace, func(events []KeyEvent) error {
+				return c.prepare(p, idx, source, events)
+			}) {
+				registered = true
+			}
+		}
+
+		if !registered {
+			c.logger.Warnf("OnKeyPrepare register failed: namespace=%s key=%s", namespace, key)
+			return false
+		}
+
+		if c.preparers == nil {
+			c.preparers = make(map[string]*preparer)
+		}
+		c.preparers[namespace] = p
+	}
+
+	p.mu.Lock()
+	p.hooks[key] = append(p.hooks[key], ph)
+	p.mu.Unlock()
+
+	return true
+}
+
+// ReloadStatus returns the status of the last reload of the namespace,
+// false is returned if the namespace has no prepare hook or has not been reloaded.
+func (c *Configure) ReloadStatus(namespace string) (ReloadStatus, bool) {
+	c.prepMu.Lock()
+	defer c.prepMu.Unlock()
+
+	s, ok := c.statuses[namespace]
+	return s, ok
+}
+
+// prepare validates the events of the layer idx by the prepare hooks, and records the reload status.
+func (c *Configure) prepare(p *preparer, idx int, source string, events []KeyEvent) error {
+	status := ReloadStatus{Source: source, Keys: make([]string, 0, len(events)), At: time.Now()}
+	for _, ev := range events {
+		status.Namespace = ev.Namespace
+		status.Keys = append(status.Keys, ev.Key)
+		status.Revision = max(status.Revision, ev.Revision)
+	}
+
+	status.Err = c.validateReload(p, idx, events)
+	status.Rejected = status.Err != nil
+
+	c.prepMu.Lock()
+	if c.statuses == nil {
+		c.statuses = make(map[string]ReloadStatus)
+	}
+	c.statuses[status.Namespace] = status
+	c.prepMu.Unlock()
+
+	return status.Err
+}
+
+func (c *Configure) validateReload(p *preparer, idx int, events []KeyEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	for _, ev := range events {
+		p.mu.RLock()
+		hooks := p.hooks[ev.Key]
+		p.mu.RUnlock()
+
+		if len(hooks) == 0 {
+			continue
+		}
+
+		if len(c.ds[ev.Namespace]) > 1 {
+			var fire bool
+			if ev, fire = c.effectiveEvent(ev, idx); !fire {
+				continue
+			}
+		}
+
+		ev, err := decryptEvent(ev)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", ev.Key, err)
+		}
+
+		for _, h := range hooks {
+			b, changed, err := h.value(ev)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", ev.Key, err)
+			}
+
+			if !changed {
+				continue
+			}
+
+			if c.interpolate && b != nil {
+				if b, err = c.interpolateBytes(ctx, ev.Namespace, ev.Key, b); err != nil {
+					return fmt.Errorf("key %s: %w", ev.Key, err)
+				}
+			}
+
+			if err := h.hook(b); err != nil {
+				return fmt.Errorf("key %s: %w", ev.Key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// value returns the new value of the hook, and whether it is changed by the event.
+func (h *prepareHook) value(ev KeyEvent) ([]byte, bool, error) {
+	if h.segs == nil {
+		return ev.NewValue, true, nil
+	}
+
+	var (
+		newValue, oldValue []byte
+		newOk, oldOk       bool
+		err                error
+	)
+	if ev.Type != EventDeleted {
+		if newValue, newOk, err = extractPath(ev.NewValue, h.segs); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if ev.OldValue != nil {
+		oldValue, oldOk, _ = extractPath(ev.OldValue, h.segs)
+	}
+
+	if newOk == oldOk && bytes.Equal(newValue, oldValue) {
+		return nil, false, nil
+	}
+	return newValue, true, nil
+}
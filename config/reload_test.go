@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/meta"
+)
+
+func TestConfigure_OnKeyPrepare(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("user: root\npassword: pwd\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ok := engine.OnKeyPrepare("db", "password", func(b []byte) error {
+		if string(b) == "bad" {
+			return errors.New("weak password")
+		}
+		return nil
+	})
+	testz.Equal(t, true, ok)
+
+	var (
+		mu    sync.Mutex
+		users []string
+	)
+	engine.OnKeyChange("db", "user", func(b []byte) error {
+		mu.Lock()
+		users = append(users, string(b))
+		mu.Unlock()
+		return nil
+	})
+
+	_, ok = engine.ReloadStatus("db")
+	testz.Equal(t, false, ok)
+
+	// the whole reload is rejected, the user is not changed either
+	testz.Nil(t, os.WriteFile(file, []byte("user: admin\npassword: bad\n"), 0666))
+	eventually(t, func() bool {
+		_, ok := engine.ReloadStatus("db")
+		return ok
+	})
+
+	ctx := context.Background()
+	user, err := engine.String(ctx, "db", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "root", user)
+	password, err := engine.String(ctx, "db", "password")
+	testz.Nil(t, err)
+	testz.Equal(t, "pwd", password)
+
+	status, ok := engine.ReloadStatus("db")
+	testz.Equal(t, true, ok)
+	testz.Equal(t, true, status.Rejected)
+	testz.Equal(t, true, strings.Contains(status.Err.Error(), "weak password"))
+	testz.Equal(t, []string{"password", "user"}, status.Keys)
+	testz.Equal(t, "file://"+dir, status.Source)
+
+	testz.Nil(t, os.WriteFile(file, []byte("user: admin\npassword: strong\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(users) >= 1
+	})
+
+	user, err = engine.String(ctx, "db", "user")
+	testz.Nil(t, err)
+	testz.Equal(t, "admin", user)
+
+	status, _ = engine.ReloadStatus("db")
+	testz.Equal(t, false, status.Rejected)
+
+	mu.Lock()
+	testz.Equal(t, []string{"admin"}, users)
+	mu.Unlock()
+}
+
+func TestConfigure_TransactionalReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	content := "pool:\n  size: 10\n  dsn: mysql://localhost\n  mode: rw\n  timeout: 1s\nretry: 3\n"
+	testz.Nil(t, os.WriteFile(file, []byte(content), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	}, WithTransactionalReload())
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	var c struct {
+		pool *poolConfig `config:"namespace:db;key:pool;watch:true"`
+	}
+	_, err = engine.InitAndPreload(&c, time.Second)
+	testz.Nil(t, err)
+
+	retry, err := Watch[int](engine, "db", "retry", nil)
+	testz.Nil(t, err)
+
+	// the invalid pool rejects the reload, the retry is not changed although it is valid
+	content2 := strings.Replace(strings.Replace(content, "size: 10", "size: 0", 1), "retry: 3", "retry: 4", 1)
+	testz.Nil(t, os.WriteFile(file, []byte(content2), 0666))
+	eventually(t, func() bool {
+		_, ok := engine.ReloadStatus("db")
+		return ok
+	})
+
+	testz.Equal(t, 10, c.pool.Size)
+	testz.Equal(t, 3, retry.Load())
+
+	ctx := context.Background()
+	n, err := engine.Int(ctx, "db", "retry")
+	testz.Nil(t, err)
+	testz.Equal(t, 3, n)
+
+	status, _ := engine.ReloadStatus("db")
+	testz.Equal(t, true, status.Rejected)
+}
@@ -0,0 +1,150 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/welllog/golt/config/driver"
+)
+
+// AESGCMName is the decryptor name of AES-256-GCM in the envelope.
+const AESGCMName = "aesgcm"
+
+// AESGCMKeySize is the key size of AES-256-GCM.
+const AESGCMKeySize = 32
+
+var _ driver.Decryptor = (*AESGCM)(nil)
+
+// AESGCM encrypts and decrypts values with AES-256-GCM.
+// it holds multiple keys by key id for key rotation, new values are encrypted by the primary key,
+// and the values encrypted by the old keys can still be decrypted.
+type AESGCM struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewAESGCM creates an AESGCM with the keys, the primary key is used to encrypt.
+func NewAESGCM(primaryKeyID string, keys map[string][]byte) (*AESGCM, error) {
+	if _, ok := keys[primaryKeyID]; !ok {
+		return nil, fmt.Errorf("primary key %s not found", primaryKeyID)
+	}
+
+	a := AESGCM{
+		primary: primaryKeyID,
+		aeads:   make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for id, key := range keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %s must not contain ':'", id)
+		}
+
+		if len(key) != AESGCMKeySize {
+			return nil, fmt.Errorf("key %s size must be %d bytes, but got %d", id, AESGCMKeySize, len(key))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		a.aeads[id] = aead
+	}
+
+	return &a, nil
+}
+
+// Register registers the AESGCM as the decryptor of the envelopes named aesgcm.
+func (a *AESGCM) Register() *AESGCM {
+	driver.RegisterDecryptor(AESGCMName, a)
+	return a
+}
+
+// Encrypt encrypts the plaintext by the primary key and returns the envelope,
+// LIKE: enc:aesgcm:<key id>:<base64 ciphertext>
+func (a *AESGCM) Encrypt(plaintext []byte) (string, error) {
+	return a.EncryptWithKey(a.primary, plaintext)
+}
+
+// EncryptWithKey encrypts the plaintext by the key of keyID and returns the envelope.
+func (a *AESGCM) EncryptWithKey(keyID string, plaintext []byte) (string, error) {
+	aead, ok := a.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", keyID)
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// the key id is authenticated to avoid the ciphertext being moved to another key
+	ciphertext := aead.Seal(nonce, nonce, plaintext, []byte(keyID))
+	return driver.Envelope(AESGCMName, keyID, ciphertext), nil
+}
+
+// Decrypt decrypts the ciphertext(nonce + sealed data) by the key of keyID.
+func (a *AESGCM) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	aead, ok := a.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", keyID)
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(keyID))
+}
+
+// ReadKeyFile reads the base64 encoded key from the file.
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file %s failed: %w", path, err)
+	}
+
+	return decodeKey(string(b))
+}
+
+// ReadKeyEnv reads the base64 encoded key from the environment variable.
+func ReadKeyEnv(name string) ([]byte, error) {
+	s, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("key env %s not set", name)
+	}
+
+	return decodeKey(s)
+}
+
+// GenerateKey generates a random key and returns it base64 encoded.
+func GenerateKey() (string, error) {
+	key := make([]byte, AESGCMKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64 encoded: %w", err)
+	}
+
+	if len(key) != AESGCMKeySize {
+		return nil, fmt.Errorf("key size must be %d bytes, but got %d", AESGCMKeySize, len(key))
+	}
+	return key, nil
+}
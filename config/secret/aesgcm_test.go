@@ -0,0 +1,108 @@
+package secret
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+)
+
+func newTestAESGCM(t *testing.T, primary string, ids ...string) *AESGCM {
+	t.Helper()
+
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		k, err := GenerateKey()
+		testz.Nil(t, err)
+		keys[id], err = decodeKey(k)
+		testz.Nil(t, err)
+	}
+
+	a, err := NewAESGCM(primary, keys)
+	testz.Nil(t, err)
+	return a
+}
+
+func decryptEnvelope(a *AESGCM, envelope string) ([]byte, error) {
+	_, keyID, ciphertext, err := driver.ParseEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	return a.Decrypt(keyID, ciphertext)
+}
+
+func TestAESGCM_RoundTrip(t *testing.T) {
+	a := newTestAESGCM(t, "k2", "k1", "k2")
+
+	envelope, err := a.Encrypt([]byte("p@ss"))
+	testz.Nil(t, err)
+	testz.Equal(t, true, strings.HasPrefix(envelope, "enc:aesgcm:k2:"))
+
+	plaintext, err := decryptEnvelope(a, envelope)
+	testz.Nil(t, err)
+	testz.Equal(t, "p@ss", string(plaintext))
+
+	// the value encrypted by the old key can still be decrypted
+	envelope, err = a.EncryptWithKey("k1", []byte("old"))
+	testz.Nil(t, err)
+	plaintext, err = decryptEnvelope(a, envelope)
+	testz.Nil(t, err)
+	testz.Equal(t, "old", string(plaintext))
+
+	// the same plaintext is encrypted with a random nonce
+	other, err := a.Encrypt([]byte("old"))
+	testz.Nil(t, err)
+	testz.Equal(t, true, other != envelope)
+}
+
+func TestAESGCM_WrongKey(t *testing.T) {
+	a := newTestAESGCM(t, "k1", "k1", "k2")
+	b := newTestAESGCM(t, "k1", "k1")
+
+	envelope, err := a.Encrypt([]byte("p@ss"))
+	testz.Nil(t, err)
+
+	// the key of the same id but different content
+	_, err = decryptEnvelope(b, envelope)
+	testz.Equal(t, true, err != nil)
+
+	// the key id is authenticated, the ciphertext can not be moved to another key
+	_, _, ciphertext, err := driver.ParseEnvelope(envelope)
+	testz.Nil(t, err)
+	_, err = a.Decrypt("k2", ciphertext)
+	testz.Equal(t, true, err != nil)
+
+	_, err = a.Decrypt("k3", ciphertext)
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "key k3 not found"))
+
+	_, err = NewAESGCM("k1", map[string][]byte{"k1": []byte("short")})
+	testz.Equal(t, true, err != nil)
+
+	_, err = decodeKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	testz.Equal(t, true, err != nil)
+}
+
+func TestAESGCM_Tampered(t *testing.T) {
+	a := newTestAESGCM(t, "k1", "k1")
+
+	envelope, err := a.Encrypt([]byte("p@ss"))
+	testz.Nil(t, err)
+
+	_, keyID, ciphertext, err := driver.ParseEnvelope(envelope)
+	testz.Nil(t, err)
+
+	for i := range ciphertext {
+		tampered := append([]byte(nil), ciphertext...)
+		tampered[i] ^= 0x01
+		_, err = decryptEnvelope(a, driver.Envelope(AESGCMName, keyID, tampered))
+		testz.Equal(t, true, err != nil)
+	}
+
+	_, err = a.Decrypt(keyID, ciphertext[:len(ciphertext)-1])
+	testz.Equal(t, true, err != nil)
+
+	_, err = a.Decrypt(keyID, ciphertext[:4])
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "too short"))
+}
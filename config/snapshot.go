@@ -0,0 +1,105 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/driver/snapshot"
+	"github.com/welllog/golt/config/meta"
+)
+
+type (
+	Snapshot      = snapshot.Snapshot
+	SnapshotValue = snapshot.Value
+)
+
+// RedactedValue replaces the value of the secret in the snapshot with RedactSecrets.
+const RedactedValue = "[REDACTED]"
+
+type snapshotOptions struct {
+	redactSecrets bool
+}
+
+type SnapshotOption func(*snapshotOptions)
+
+// RedactSecrets removes the values of the encrypted secrets from the snapshot,
+// by default the secrets are kept encrypted.
+func RedactSecrets() SnapshotOption {
+	return func(o *snapshotOptions) {
+		o.redactSecrets = true
+	}
+}
+
+// Snapshot walks every namespace and key, and returns the effective raw values.
+// the values are not decrypted or interpolated, the encrypted secrets are kept encrypted unless RedactSecrets.
+// the layers of the drivers which can not list the keys are skipped and reported in Snapshot.Unsupported.
+// the snapshot can be saved by Snapshot.WriteFile and booted by Restore.
+func (c *Configure) Snapshot(ctx context.Context, options ...SnapshotOption) (*Snapshot, error) {
+	opts := snapshotOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	s := Snapshot{
+		CreatedAt:  time.Now(),
+		Namespaces: make(map[string]map[string]SnapshotValue, len(c.ds)),
+	}
+
+	for ns, layers := range c.ds {
+		values := make(map[string]SnapshotValue)
+		// the higher layer overrides the lower layer
+		for _, l := range layers {
+			entries, err := driver.Entries(ctx, l.driver, ns)
+			if errors.Is(err, driver.ErrNotSupported) {
+				if s.Unsupported == nil {
+					s.Unsupported = make(map[string][]string)
+				}
+				s.Unsupported[ns] = append(s.Unsupported[ns], l.source)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("snapshot namespace %s from %s failed: %w", ns, l.source, err)
+			}
+
+			for _, e := range entries {
+				v := SnapshotValue{
+					Value:    string(e.Value),
+					Source:   l.source,
+					Revision: e.Revision,
+					Secret:   driver.IsEnvelope(e.Value),
+				}
+				if v.Secret && opts.redactSecrets {
+					v.Value, v.Redacted = RedactedValue, true
+				}
+				values[e.Key] = v
+			}
+		}
+		s.Namespaces[ns] = values
+	}
+
+	return &s, nil
+}
+
+// Restore boots a Configure from the snapshot file with the snapshot:// driver,
+// all the namespaces of the snapshot are served. the redacted secrets are not found in the Configure.
+func Restore(file string, options ...Option) (*Configure, error) {
+	s, err := snapshot.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file %s: %w", file, err)
+	}
+
+	rules := make([]meta.Rule, 0, len(s.Namespaces))
+	for ns := range s.Namespaces {
+		rules = append(rules, meta.Rule{Namespace: ns})
+	}
+	slices.SortFunc(rules, func(a, b meta.Rule) int {
+		return strings.Compare(a.Namespace, b.Namespace)
+	})
+
+	return NewConfigure([]meta.Config{{Source: "snapshot://" + file, Configs: rules}}, options...)
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/config/secret"
+	"github.com/welllog/golt/contract"
+)
+
+func TestConfigure_Snapshot(t *testing.T) {
+	key, err := secret.GenerateKey()
+	testz.Nil(t, err)
+	t.Setenv("GOLT_TEST_SNAPSHOT_KEY", key)
+	raw, err := secret.ReadKeyEnv("GOLT_TEST_SNAPSHOT_KEY")
+	testz.Nil(t, err)
+	aes, err := secret.NewAESGCM("k1", map[string][]byte{"k1": raw})
+	testz.Nil(t, err)
+	aes.Register()
+	password, err := aes.Encrypt([]byte("p@ss"))
+	testz.Nil(t, err)
+
+	lowDir, highDir := t.TempDir(), t.TempDir()
+	err = os.WriteFile(filepath.Join(lowDir, "db.yaml"), []byte("host: localhost\nport: 3306\n"), 0666)
+	testz.Nil(t, err)
+	err = os.WriteFile(filepath.Join(highDir, "db.yaml"), []byte("port: 3307\npassword: "+password+"\n"), 0666)
+	testz.Nil(t, err)
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + lowDir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml"}},
+		},
+		{
+			Source:  "file://" + highDir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml"}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	s, err := engine.Snapshot(ctx)
+	testz.Nil(t, err)
+
+	db := s.Namespaces["db"]
+	testz.Equal(t, 3, len(db))
+	testz.Equal(t, "localhost", db["host"].Value)
+	testz.Equal(t, "file://"+lowDir, db["host"].Source)
+	testz.Equal(t, "3307", db["port"].Value)
+	testz.Equal(t, "file://"+highDir, db["port"].Source)
+	testz.Equal(t, true, db["port"].Revision > 0)
+	testz.Equal(t, true, db["password"].Secret)
+	testz.Equal(t, password, db["password"].Value)
+
+	file := filepath.Join(t.TempDir(), "dump.json")
+	testz.Nil(t, s.WriteFile(file))
+
+	restored, err := Restore(file)
+	testz.Nil(t, err)
+	defer restored.Close()
+
+	port, err := restored.Int(ctx, "db", "port")
+	testz.Nil(t, err)
+	testz.Equal(t, 3307, port)
+
+	pwd, err := restored.String(ctx, "db", "password")
+	testz.Nil(t, err)
+	testz.Equal(t, "p@ss", pwd)
+
+	s, err = engine.Snapshot(ctx, RedactSecrets())
+	testz.Nil(t, err)
+	testz.Equal(t, RedactedValue, s.Namespaces["db"]["password"].Value)
+	testz.Equal(t, true, s.Namespaces["db"]["password"].Redacted)
+	testz.Nil(t, s.WriteFile(file))
+
+	restored, err = Restore(file)
+	testz.Nil(t, err)
+	defer restored.Close()
+
+	_, err = restored.String(ctx, "db", "password")
+	testz.Equal(t, ErrNotFound, err)
+}
+
+func TestConfigure_SnapshotUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	testz.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: demo\nport: 8080\n"), 0666))
+
+	bd := newBaseDriver(map[string]string{"port": "9090"})
+	driver.RegisterDriver("base-snapshot", func(meta.Config, contract.Logger) (driver.Driver, error) {
+		return bd, nil
+	})
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml"}},
+		},
+		{
+			Source:  "base-snapshot://",
+			Configs: []meta.Rule{{Namespace: "app"}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the layer can not list the keys is skipped and reported
+	s, err := engine.Snapshot(context.Background())
+	testz.Nil(t, err)
+	testz.Equal(t, map[string][]string{"app": {"base-snapshot://"}}, s.Unsupported)
+	testz.Equal(t, 2, len(s.Namespaces["app"]))
+	testz.Equal(t, "demo", s.Namespaces["app"]["name"].Value)
+	testz.Equal(t, "8080", s.Namespaces["app"]["port"].Value)
+}
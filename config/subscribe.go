@@ -0,0 +1,196 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/welllog/golt/contract"
+)
+
+var ErrClosed = errors.New("config closed")
+
+// OverflowPolicy decides what to do when the channel of a subscription is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the reload until the batch is received or the subscription is closed.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the batch that can not be sent.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest batch in the channel to make room for the new one.
+	OverflowDropOldest
+)
+
+// SubscribeOptions is the options of Configure.Subscribe.
+type SubscribeOptions struct {
+	// Buffer is the buffer size of the channel.
+	// the drop policies require at least 1 buffer, the Buffer less than 1 is treated as 1.
+	Buffer int
+	// Overflow is the policy when the channel is full, the default is OverflowBlock.
+	Overflow OverflowPolicy
+}
+
+// ChangeBatch is the changed keys of a namespace in one file reload or etcd watch response.
+type ChangeBatch struct {
+	Namespace string
+	// Events is ordered as the driver reports, it is shared by all subscribers and should not be modified.
+	Events []KeyEvent
+}
+
+// Subscribe returns a channel that receives the batched changes of the namespace.
+// the file driver delivers one batch per reload and the etcd driver one batch per watch response,
+// the events are the changes of the effective values like OnKeyEvent.
+// the channel is closed when the ctx is done or the Configure is closed.
+func (c *Configure) Subscribe(ctx context.Context, namespace string, opts SubscribeOptions) (<-chan ChangeBatch, error) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	subs, ok := c.subs[namespace]
+	if !ok {
+		if !c.onBatchEvent(namespace, func(events []KeyEvent) error {
+			c.publish(ChangeBatch{Namespace: namespace, Events: events})
+			return nil
+		}) {
+			c.logger.Warnf("Subscribe failed: namespace=%s", namespace)
+			return nil, fmt.Errorf("namespace %s is not watched", namespace)
+		}
+
+		if c.subs == nil {
+			c.subs = make(map[string]map[*subscriber]struct{})
+		}
+		subs = make(map[*subscriber]struct{})
+		c.subs[namespace] = subs
+	}
+
+	s := newSubscriber(namespace, opts, c.logger)
+	subs[s] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.unsubscribe(s)
+		case <-s.done:
+		}
+	}()
+
+	return s.ch, nil
+}
+
+// publish sends the batch to the subscribers of the namespace.
+func (c *Configure) publish(batch ChangeBatch) {
+	c.subMu.Lock()
+	subs := make([]*subscriber, 0, len(c.subs[batch.Namespace]))
+	for s := range c.subs[batch.Namespace] {
+		subs = append(subs, s)
+	}
+	c.subMu.Unlock()
+
+	for _, s := range subs {
+		s.send(batch)
+	}
+}
+
+func (c *Configure) unsubscribe(s *subscriber) {
+	c.subMu.Lock()
+	delete(c.subs[s.namespace], s)
+	c.subMu.Unlock()
+
+	s.close()
+}
+
+// closeSubscribers closes all the subscriptions, the Subscribe after it returns ErrClosed.
+func (c *Configure) closeSubscribers() {
+	c.subMu.Lock()
+	c.closed = true
+	subs := c.subs
+	c.subs = nil
+	c.subMu.Unlock()
+
+	for _, m := range subs {
+		for s := range m {
+			s.close()
+		}
+	}
+}
+
+type subscriber struct {
+	namespace string
+	ch        chan ChangeBatch
+	overflow  OverflowPolicy
+	logger    contract.Logger
+
+	// mu guards the send and close of ch, done is closed first to release the blocked send.
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newSubscriber(namespace string, opts SubscribeOptions, logger contract.Logger) *subscriber {
+	buffer := opts.Buffer
+	if buffer < 1 && opts.Overflow != OverflowBlock {
+		buffer = 1
+	}
+
+	return &subscriber{
+		namespace: namespace,
+		ch:        make(chan ChangeBatch, buffer),
+		overflow:  opts.Overflow,
+		logger:    logger,
+		done:      make(chan struct{}),
+	}
+}
+
+func (s *subscriber) send(batch ChangeBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	switch s.overflow {
+	case OverflowDropNewest:
+		select {
+		case s.ch <- batch:
+		default:
+			s.logger.Warnf("subscription of namespace %s is full, drop the newest batch", s.namespace)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.ch <- batch:
+				return
+			default:
+			}
+
+			select {
+			case <-s.ch:
+				s.logger.Warnf("subscription of namespace %s is full, drop the oldest batch", s.namespace)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- batch:
+		case <-s.done:
+		}
+	}
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
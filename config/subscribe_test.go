@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/meta"
+)
+
+func newSubscribeTestConfigure(t *testing.T, content string) (*Configure, string) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	err := os.WriteFile(file, []byte(content), 0666)
+	testz.Nil(t, err)
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	return engine, file
+}
+
+func TestConfigure_Subscribe(t *testing.T) {
+	engine, file := newSubscribeTestConfigure(t, "user: root\npassword: pwd\nhost: localhost\n")
+	defer engine.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := engine.Subscribe(ctx, "db", SubscribeOptions{Buffer: 4})
+	testz.Nil(t, err)
+
+	err = os.WriteFile(file, []byte("user: admin\npassword: pwd2\nport: 3306\n"), 0666)
+	testz.Nil(t, err)
+
+	select {
+	case batch := <-ch:
+		testz.Equal(t, "db", batch.Namespace)
+		testz.Equal(t, 4, len(batch.Events))
+
+		types := make(map[string]EventType, len(batch.Events))
+		for _, ev := range batch.Events {
+			types[ev.Key] = ev.Type
+		}
+		testz.Equal(t, EventDeleted, types["host"])
+		testz.Equal(t, EventUpdated, types["password"])
+		testz.Equal(t, EventCreated, types["port"])
+		testz.Equal(t, EventUpdated, types["user"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("batch not received")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		testz.Equal(t, false, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after ctx canceled")
+	}
+
+	_, err = engine.Subscribe(context.Background(), "none", SubscribeOptions{})
+	testz.Equal(t, true, err != nil)
+}
+
+func TestConfigure_Subscribe_Overflow(t *testing.T) {
+	engine, file := newSubscribeTestConfigure(t, "user: root\n")
+
+	newest, err := engine.Subscribe(context.Background(), "db", SubscribeOptions{Overflow: OverflowDropNewest})
+	testz.Nil(t, err)
+	oldest, err := engine.Subscribe(context.Background(), "db", SubscribeOptions{Overflow: OverflowDropOldest})
+	testz.Nil(t, err)
+
+	// the reload hook is registered after the subscriptions, the batch is published to them before it is called
+	reloaded := make(chan struct{}, 2)
+	testz.Equal(t, true, engine.OnNamespaceReload("db", func(map[string][]byte) error {
+		reloaded <- struct{}{}
+		return nil
+	}))
+
+	for _, user := range []string{"u1", "u2"} {
+		err = os.WriteFile(file, []byte("user: "+user+"\n"), 0666)
+		testz.Nil(t, err)
+		select {
+		case <-reloaded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("reload not received")
+		}
+	}
+
+	batch := <-newest
+	testz.Equal(t, "u1", string(batch.Events[0].NewValue))
+	batch = <-oldest
+	testz.Equal(t, "u2", string(batch.Events[0].NewValue))
+
+	engine.Close()
+	_, ok := <-newest
+	testz.Equal(t, false, ok)
+	_, ok = <-oldest
+	testz.Equal(t, false, ok)
+
+	_, err = engine.Subscribe(context.Background(), "db", SubscribeOptions{})
+	testz.Equal(t, ErrClosed, err)
+}
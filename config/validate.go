@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Validator is implemented by the config types which validate themselves,
+// it is called after the validate tags are checked.
+type Validator interface {
+	Validate() error
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// validateField validates the decoded value pointed to by ptr,
+// rules is the validate tag of the field, LIKE: `validate:"required;min:1;max:100"`.
+// the validate tags of the nested struct fields are also checked.
+// supported rules:
+//
+//	required: the value must not be zero
+//	min:<n>: number >= n, length of string/slice/map >= n, duration >= n(LIKE: 1s)
+//	max:<n>: number <= n, length of string/slice/map <= n, duration <= n
+//	oneof:<a b c>: the value must be one of the space separated values
+//	regex:<expr>: the string must match the regular expression
+//
+// the argument quoted by single quotes can contain ';', LIKE: regex:'^[a-z;]+$', see splitTag.
+func validateField(name, rules string, ptr reflect.Value) error {
+	v := ptr.Elem()
+	if rules != "" {
+		if err := checkRules(name, rules, v); err != nil {
+			return err
+		}
+	}
+
+	if err := validateNested(name, v); err != nil {
+		return err
+	}
+
+	if vd, ok := ptr.Interface().(Validator); ok {
+		if err := vd.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateNested checks the validate tags of the struct fields in v recursively.
+func validateNested(name string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return validateNested(name, v.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateNested(fmt.Sprintf("%s[%d]", name, i), v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			fieldName := name + "." + field.Name
+			fieldValue := v.Field(i)
+			if !field.IsExported() && fieldValue.CanAddr() {
+				// the unexported field is loaded by unsafe, rebuild it like initStruct so that it can be read
+				fieldValue = reflect.NewAt(field.Type, unsafe.Pointer(fieldValue.UnsafeAddr())).Elem()
+			}
+
+			if rules := field.Tag.Get("validate"); rules != "" {
+				if err := checkRules(fieldName, rules, fieldValue); err != nil {
+					return err
+				}
+			}
+
+			if err := validateNested(fieldName, fieldValue); err != nil {
+				return err
+			}
+		}
+	default:
+	}
+
+	return nil
+}
+
+func checkRules(name, rules string, v reflect.Value) error {
+	opts, err := splitTag(rules)
+	if err != nil {
+		return fmt.Errorf("%s invalid validate tag %s: %w", name, rules, err)
+	}
+
+	for _, rule := range opts {
+		key, arg := rule.key, rule.value
+
+		var err error
+		switch key {
+		case "required":
+			if isZero(v) {
+				err = fmt.Errorf("is required")
+			}
+		case "min":
+			err = checkBound(v, arg, true)
+		case "max":
+			err = checkBound(v, arg, false)
+		case "oneof":
+			// fmt prints the reflect.Value without Interface, it is safe for the unexported field
+			s := fmt.Sprint(indirect(v))
+			if !slices.Contains(strings.Fields(arg), s) {
+				err = fmt.Errorf("value %s must be one of [%s]", s, arg)
+			}
+		case "regex":
+			err = checkRegex(v, arg)
+		default:
+			err = fmt.Errorf("unknown validate rule %s", key)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s validate %s: %w", name, rule, err)
+		}
+	}
+
+	return nil
+}
+
+func checkBound(v reflect.Value, arg string, isMin bool) error {
+	v = indirect(v)
+
+	var value, bound float64
+	var parseErr error
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		d, parseErr = time.ParseDuration(arg)
+		value, bound = float64(v.Int()), float64(d)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		value = float64(v.Int())
+		bound, parseErr = strconv.ParseFloat(arg, 64)
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		value = float64(v.Uint())
+		bound, parseErr = strconv.ParseFloat(arg, 64)
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		value = v.Float()
+		bound, parseErr = strconv.ParseFloat(arg, 64)
+	case v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Array:
+		value = float64(v.Len())
+		bound, parseErr = strconv.ParseFloat(arg, 64)
+	default:
+		return fmt.Errorf("not supported for %s", v.Type())
+	}
+
+	if parseErr != nil {
+		return fmt.Errorf("invalid bound %s: %w", arg, parseErr)
+	}
+
+	if isMin && value < bound {
+		return fmt.Errorf("value %v less than %s", v, arg)
+	}
+
+	if !isMin && value > bound {
+		return fmt.Errorf("value %v greater than %s", v, arg)
+	}
+
+	return nil
+}
+
+func checkRegex(v reflect.Value, expr string) error {
+	v = indirect(v)
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("not supported for %s", v.Type())
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid regex: %w", err)
+	}
+
+	if !re.MatchString(v.String()) {
+		return fmt.Errorf("value %q not match", v.String())
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// indirect returns the value that v points to, the nil pointer returns the zero value.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Zero(v.Type().Elem())
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/meta"
+)
+
+type poolConfig struct {
+	Size    int           `yaml:"size" validate:"min:1;max:100"`
+	DSN     string        `yaml:"dsn" validate:"required;regex:^mysql://"`
+	Mode    string        `yaml:"mode" validate:"oneof:rw ro"`
+	Timeout time.Duration `yaml:"timeout" validate:"min:100ms;max:10s"`
+	Tags    []string      `yaml:"tags" validate:"max:2"`
+}
+
+func (p *poolConfig) Validate() error {
+	if p.Mode == "ro" && p.Size > 10 {
+		return errors.New("read only pool size must not greater than 10")
+	}
+	return nil
+}
+
+func TestValidateField(t *testing.T) {
+	valid := poolConfig{Size: 10, DSN: "mysql://localhost", Mode: "ro", Timeout: time.Second}
+	testz.Nil(t, validateField("pool", "required", reflect.ValueOf(&valid)))
+
+	tests := []struct {
+		modify func(p *poolConfig)
+		errMsg string
+	}{
+		{func(p *poolConfig) { p.Size = 0 }, "pool.Size validate min:1"},
+		{func(p *poolConfig) { p.Size = 101 }, "pool.Size validate max:100"},
+		{func(p *poolConfig) { p.DSN = "" }, "pool.DSN validate required"},
+		{func(p *poolConfig) { p.DSN = "pg://localhost" }, "pool.DSN validate regex:^mysql://"},
+		{func(p *poolConfig) { p.Mode = "wo" }, "pool.Mode validate oneof:rw ro"},
+		{func(p *poolConfig) { p.Timeout = time.Millisecond }, "pool.Timeout validate min:100ms"},
+		{func(p *poolConfig) { p.Tags = []string{"a", "b", "c"} }, "pool.Tags validate max:2"},
+		{func(p *poolConfig) { p.Size = 11 }, "read only pool size"},
+	}
+
+	for _, tt := range tests {
+		p := valid
+		tt.modify(&p)
+		err := validateField("pool", "", reflect.ValueOf(&p))
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("expect error %s, got %v", tt.errMsg, err)
+		}
+	}
+
+	n := 0
+	err := validateField("n", "required", reflect.ValueOf(&n))
+	testz.Equal(t, true, err != nil)
+}
+
+func TestValidateField_QuotedRule(t *testing.T) {
+	// the quoted regex contains ';'
+	rules := `required; regex:'^[a-z]+(;[a-z]+)*$' ;max:20`
+	s := "a;b;c"
+	testz.Nil(t, validateField("s", rules, reflect.ValueOf(&s)))
+
+	s = "a;1"
+	err := validateField("s", rules, reflect.ValueOf(&s))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "s validate regex:^[a-z]+(;[a-z]+)*$"))
+
+	s = strings.Repeat("a;", 10) + "a"
+	err = validateField("s", rules, reflect.ValueOf(&s))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "s validate max:20"))
+
+	s = "it's"
+	testz.Nil(t, validateField("s", `regex:'^it''s$'`, reflect.ValueOf(&s)))
+
+	err = validateField("s", `regex:'^a;b`, reflect.ValueOf(&s))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "unterminated"))
+}
+
+type listenConfig struct {
+	host string `validate:"required"`
+	port int    `validate:"min:1;max:65535"`
+	mode string `validate:"oneof:http https"`
+}
+
+type serverConfig struct {
+	Listen listenConfig
+	admin  *listenConfig
+}
+
+func TestValidateField_Unexported(t *testing.T) {
+	valid := serverConfig{
+		Listen: listenConfig{host: "localhost", port: 80, mode: "http"},
+		admin:  &listenConfig{host: "localhost", port: 81, mode: "https"},
+	}
+	testz.Nil(t, validateField("server", "", reflect.ValueOf(&valid)))
+
+	tests := []struct {
+		modify func(s *serverConfig)
+		errMsg string
+	}{
+		{func(s *serverConfig) { s.Listen.port = 0 }, "server.Listen.port validate min:1: value 0 less than 1"},
+		{func(s *serverConfig) { s.Listen.mode = "tcp" }, "server.Listen.mode validate oneof:http https: value tcp"},
+		{func(s *serverConfig) { s.admin.host = "" }, "server.admin.host validate required"},
+		{func(s *serverConfig) { s.admin.port = 70000 }, "server.admin.port validate max:65535: value 70000 greater"},
+	}
+
+	for _, tt := range tests {
+		s := valid
+		admin := *valid.admin
+		s.admin = &admin
+		tt.modify(&s)
+		err := validateField("server", "", reflect.ValueOf(&s))
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("expect error %s, got %v", tt.errMsg, err)
+		}
+	}
+
+	// the struct not addressable is also checked
+	var c any = serverConfig{Listen: listenConfig{host: "localhost", mode: "http"}}
+	err := validateNested("server", reflect.ValueOf(c))
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "value 0 less than 1"))
+}
+
+func TestConfigure_InitAndPreload_Validate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "db.yaml")
+	content := "pool:\n  size: 10\n  dsn: mysql://localhost\n  mode: rw\n  timeout: 1s\nretry: 3\n"
+	testz.Nil(t, os.WriteFile(file, []byte(content), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "db", Path: "db.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	var c struct {
+		pool  *poolConfig `config:"namespace:db;key:pool;watch:true"`
+		Retry int         `config:"namespace:db;key:retry" validate:"min:1;max:5"`
+	}
+	_, err = engine.InitAndPreload(&c, time.Second)
+	testz.Nil(t, err)
+	testz.Equal(t, 10, c.pool.Size)
+	testz.Equal(t, 3, c.Retry)
+
+	var c2 struct {
+		Retry int `config:"namespace:db;key:retry" validate:"max:2"`
+	}
+	c2.Retry = 1
+	_, err = engine.InitAndPreload(&c2, time.Second)
+	testz.Equal(t, true, err != nil && strings.Contains(err.Error(), "Retry validate max:2"))
+	testz.Equal(t, 1, c2.Retry)
+
+	// the hook is registered after the field, it is called after the field is reloaded
+	reloaded := make(chan struct{}, 1)
+	engine.OnKeyChange("db", "pool", func([]byte) error {
+		reloaded <- struct{}{}
+		return nil
+	})
+	waitReload := func() {
+		t.Helper()
+		select {
+		case <-reloaded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("reload not received")
+		}
+	}
+
+	// the invalid reload is rejected and the old value is kept
+	testz.Nil(t, os.WriteFile(file, []byte(strings.Replace(content, "size: 10", "size: 0", 1)), 0666))
+	waitReload()
+	testz.Equal(t, 10, c.pool.Size)
+
+	testz.Nil(t, os.WriteFile(file, []byte(strings.Replace(content, "size: 10", "size: 20", 1)), 0666))
+	waitReload()
+	testz.Equal(t, 20, c.pool.Size)
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/welllog/golt/config/driver"
+)
+
+// Value is a watched config value which is safe for concurrent readers.
+// the value is replaced atomically when the key changes, and the update subscribers are notified.
+type Value[T any] struct {
+	ptr atomic.Pointer[T]
+
+	cfg       *Configure
+	namespace string
+	key       string
+	decoder   driver.Decoder
+	timeout   time.Duration
+	// inert disables the hooks of the Value whose initial load failed, the hooks can not be unregistered.
+	inert atomic.Bool
+
+	// mu guards the loading and the subscribers
+	mu   sync.Mutex
+	subs []func(old, new T)
+}
+
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	lazy    bool
+	timeout time.Duration
+}
+
+// LazyLoad delays the first load of the value until Load is called.
+func LazyLoad() WatchOption {
+	return func(o *watchOptions) {
+		o.lazy = true
+	}
+}
+
+// LoadTimeout sets the timeout of loading the value, default is 3 seconds.
+func LoadTimeout(timeout time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.timeout = timeout
+	}
+}
+
+// Watch creates a Value of the key which is decoded by the decoder, and registers a hook to update the value when the key changes.
+// if decoder is nil, the yaml decoder is used.
+// the value is loaded immediately unless LazyLoad is set, the new value is validated like InitAndPreload,
+// and the invalid value is rejected and the old value is kept.
+func Watch[T any](cfg *Configure, namespace, key string, decoder driver.Decoder, options ...WatchOption) (*Value[T], error) {
+	opts := watchOptions{timeout: 3 * time.Second}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if decoder == nil {
+		decoder = driver.GetDecoderOrDefault("")
+	}
+
+	v := Value[T]{
+		cfg:       cfg,
+		namespace: namespace,
+		key:       key,
+		decoder:   decoder,
+		timeout:   opts.timeout,
+	}
+
+	// the hooks are registered before the value is loaded, so that the change during the loading is not lost.
+	// the invalid value vetoes the reload in the prepare phase, the deleted key is ignored like OnKeyChange
+	if cfg.transactional && !cfg.OnKeyPrepare(namespace, key, func(b []byte) error {
+		if b == nil || v.inert.Load() {
+			return nil
+		}
+		p := new(T)
+		if err := decoder(b, p); err != nil {
+			return err
+		}
+		if err := decryptNested(namespace, key, b, p); err != nil {
+			return err
+		}
+		return v.validate(p)
+	}) {
+		return nil, fmt.Errorf("key: %s %s not watchable", namespace, key)
+	}
+
+	if !cfg.OnKeyChange(namespace, key, v.update) {
+		v.inert.Store(true)
+		return nil, fmt.Errorf("key: %s %s not watchable", namespace, key)
+	}
+
+	if !opts.lazy {
+		if _, err := v.TryLoad(); err != nil {
+			v.inert.Store(true)
+			return nil, err
+		}
+	}
+
+	return &v, nil
+}
+
+// Load returns the current value, the zero value is returned if the value can not be loaded.
+func (v *Value[T]) Load() T {
+	val, _ := v.TryLoad()
+	return val
+}
+
+// TryLoad returns the current value, the value is loaded if it has not been loaded.
+func (v *Value[T]) TryLoad() (T, error) {
+	if p := v.ptr.Load(); p != nil {
+		return *p, nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// loaded by other goroutine or hook
+	if p := v.ptr.Load(); p != nil {
+		return *p, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	p := new(T)
+	if err := v.cfg.Decode(ctx, v.namespace, v.key, p, v.decoder); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if err := v.validate(p); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	v.ptr.Store(p)
+	return *p, nil
+}
+
+// OnUpdate subscribes the update of the value, fn is called after the new value is stored.
+// the old value is zero if the value has not been loaded before the update.
+func (v *Value[T]) OnUpdate(fn func(old, new T)) {
+	v.mu.Lock()
+	v.subs = append(v.subs, fn)
+	v.mu.Unlock()
+}
+
+// update is the hook of the key change.
+func (v *Value[T]) update(b []byte) error {
+	if v.inert.Load() {
+		return nil
+	}
+
+	p := new(T)
+	if err := v.decoder(b, p); err != nil {
+		return err
+	}
+
+	if err := decryptNested(v.namespace, v.key, b, p); err != nil {
+		return err
+	}
+
+	if err := v.validate(p); err != nil {
+		v.cfg.logger.Errorf("%s %s reload rejected, keep the old value: %s", v.namespace, v.key, err.Error())
+		return err
+	}
+
+	v.mu.Lock()
+	old := v.ptr.Swap(p)
+	subs := v.subs
+	v.mu.Unlock()
+
+	var oldVal T
+	if old != nil {
+		oldVal = *old
+	}
+
+	for _, fn := range subs {
+		fn(oldVal, *p)
+	}
+	return nil
+}
+
+func (v *Value[T]) validate(p *T) error {
+	return validateField(v.namespace+":"+v.key, "", reflect.ValueOf(p))
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/welllog/golib/testz"
+	"github.com/welllog/golt/config/driver"
+	"github.com/welllog/golt/config/meta"
+	"github.com/welllog/golt/contract"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	testz.Nil(t, os.WriteFile(file, []byte("work: {\"title\": \"engineer\", \"salary\": 100}\nport: 80\n"), 0666))
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "file://" + dir,
+			Configs: []meta.Rule{{Namespace: "app", Path: "app.yaml", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	w, err := Watch[work](engine, "app", "work", json.Unmarshal)
+	testz.Nil(t, err)
+	testz.Equal(t, work{Title: "engineer", Salary: 100}, w.Load())
+
+	port, err := Watch[int](engine, "app", "port", nil, LazyLoad())
+	testz.Nil(t, err)
+	testz.Equal(t, 80, port.Load())
+
+	_, err = Watch[int](engine, "app", "none", nil)
+	testz.Equal(t, ErrNotFound, err)
+
+	var mu sync.Mutex
+	var updates [][2]work
+	w.OnUpdate(func(old, new work) {
+		mu.Lock()
+		updates = append(updates, [2]work{old, new})
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = w.Load()
+				}
+			}
+		}()
+	}
+
+	testz.Nil(t, os.WriteFile(file, []byte("work: {\"title\": \"manager\", \"salary\": 200}\nport: 81\n"), 0666))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(updates) >= 1 && port.Load() == 81
+	})
+	close(stop)
+	wg.Wait()
+
+	testz.Equal(t, work{Title: "manager", Salary: 200}, w.Load())
+	testz.Equal(t, 81, port.Load())
+
+	mu.Lock()
+	defer mu.Unlock()
+	testz.Equal(t, [][2]work{{{Title: "engineer", Salary: 100}, {Title: "manager", Salary: 200}}}, updates)
+}
+
+func TestWatch_LoadFailed(t *testing.T) {
+	bd := newBaseDriver(map[string]string{"port": "80"})
+	driver.RegisterDriver("base-watch", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return bd, nil
+	})
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "base-watch://",
+			Configs: []meta.Rule{{Namespace: "app", Path: "/app/", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the hook is left inert if the loading fails
+	_, err = Watch[int](engine, "app", "none", nil)
+	testz.Equal(t, ErrNotFound, err)
+	testz.Equal(t, 1, bd.hookCount("none"))
+	bd.set("none", "not a number")
+
+	port, err := Watch[int](engine, "app", "port", nil)
+	testz.Nil(t, err)
+	bd.set("port", "81")
+	testz.Equal(t, 81, port.Load())
+}
+
+func TestWatch_ChangedWhileLoading(t *testing.T) {
+	bd := newBaseDriver(map[string]string{"port": "80"})
+	driver.RegisterDriver("base-loading", func(config meta.Config, logger contract.Logger) (driver.Driver, error) {
+		return bd, nil
+	})
+
+	engine, err := NewConfigure([]meta.Config{
+		{
+			Source:  "base-loading://",
+			Configs: []meta.Rule{{Namespace: "app", Path: "/app/", Watch: true}},
+		},
+	})
+	testz.Nil(t, err)
+	defer engine.Close()
+
+	// the key changes right after it is read by the initial load,
+	// the hooks registered at the time of the change are called by another goroutine like the watchers
+	changed := make(chan struct{})
+	var once sync.Once
+	bd.onGet = func(key string) {
+		once.Do(func() {
+			hooks := bd.put("port", "81")
+			go func() {
+				for _, hook := range hooks {
+					_ = hook([]byte("81"))
+				}
+				close(changed)
+			}()
+		})
+	}
+
+	port, err := Watch[int](engine, "app", "port", nil)
+	testz.Nil(t, err)
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("key not changed")
+	}
+	testz.Equal(t, 81, port.Load())
+}
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"sync"
 
 	"github.com/welllog/golib/strz"
 	"github.com/welllog/golt/contract"
+	"github.com/welllog/golt/internal/keyhook"
 	"github.com/welllog/olog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -20,12 +25,45 @@ type entry struct {
 	value string
 	// exists is to distinguish the key content is empty or not exists.
 	exists bool
+	// revision is the mod revision of the value, it is 0 if the value is not loaded by preload or watch.
+	revision int64
+}
+
+// KeyEventType is the type of the key lifecycle event.
+type KeyEventType int
+
+const (
+	KeyCreated KeyEventType = iota + 1
+	KeyUpdated
+	KeyDeleted
+)
+
+// KeyEvent is the lifecycle event of a key, Key is the key without prefix.
+type KeyEvent struct {
+	Key      string
+	Type     KeyEventType
+	OldValue []byte
+	NewValue []byte
+	// Revision is the mod revision of the key.
+	Revision int64
+}
+
+// keyEvents reads the KeyEvent for the hooks.
+var keyEvents = keyhook.Events[KeyEvent]{
+	Key: func(ev KeyEvent) string { return ev.Key },
+	Value: func(ev KeyEvent) ([]byte, bool) {
+		return ev.NewValue, ev.Type != KeyDeleted
+	},
+	Same: func(a, b KeyEvent) bool {
+		return a.Key == b.Key && a.Type == b.Type && bytes.Equal(a.OldValue, b.OldValue) && bytes.Equal(a.NewValue, b.NewValue)
+	},
 }
 
 type Kv struct {
 	prefix  string
 	entries map[string]*entry
-	hooks   map[string][]func([]byte) error
+	// hooks is the hooks of the keys, the prepare hooks validate the changed keys of a watch response before they are cached.
+	hooks *keyhook.Hooks[KeyEvent]
 
 	mu     sync.RWMutex
 	client *clientv3.Client
@@ -37,7 +75,7 @@ func NewKv(prefix string, client *clientv3.Client) *Kv {
 	kv := Kv{
 		prefix:  prefix,
 		entries: make(map[string]*entry, 5),
-		hooks:   make(map[string][]func([]byte) error),
+		hooks:   keyhook.New("prefix "+prefix, keyEvents),
 		client:  client,
 		logger:  olog.DynamicLogger{},
 	}
@@ -69,7 +107,7 @@ func (k *Kv) Preload(ctx context.Context) error {
 		if !ok {
 			// if not exists, create a new entry
 			k.entries[string(v.Key[l:])] = &entry{
-				value: string(v.Value), exists: true,
+				value: string(v.Value), exists: true, revision: v.ModRevision,
 			}
 			continue
 		}
@@ -78,6 +116,7 @@ func (k *Kv) Preload(ctx context.Context) error {
 		if !e.exists || !bytes.Equal(strz.UnsafeBytes(e.value), v.Value) {
 			e.value = string(v.Value)
 			e.exists = true
+			e.revision = v.ModRevision
 		}
 	}
 	k.mu.Unlock()
@@ -85,13 +124,108 @@ func (k *Kv) Preload(ctx context.Context) error {
 	return nil
 }
 
+// Reconcile loads all keys with the prefix from etcd, and applies the differences to the cache,
+// the hooks are called for the keys changed since the last load, LIKE: the changes while etcd is unreachable.
+// an error is returned if the changes are rejected by the prepare hooks, the cache is kept unchanged.
+func (k *Kv) Reconcile(ctx context.Context) error {
+	rsp, err := k.client.Get(ctx, k.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	l := len(k.prefix)
+	events := make([]*clientv3.Event, 0, len(rsp.Kvs))
+	found := make(map[string]struct{}, len(rsp.Kvs))
+	for _, v := range rsp.Kvs {
+		events = append(events, &clientv3.Event{Type: clientv3.EventTypePut, Kv: v})
+		found[string(v.Key[l:])] = struct{}{}
+	}
+
+	var revision int64
+	if rsp.Header != nil {
+		revision = rsp.Header.Revision
+	}
+
+	k.mu.RLock()
+	for key, e := range k.entries {
+		if _, ok := found[key]; !ok && e.exists {
+			events = append(events, &clientv3.Event{
+				Type: clientv3.EventTypeDelete,
+				Kv:   &mvccpb.KeyValue{Key: []byte(k.prefix + key), ModRevision: revision},
+			})
+		}
+	}
+	k.mu.RUnlock()
+
+	if err := k.handle(events, true); err != nil {
+		return fmt.Errorf("reconcile rejected: %w", err)
+	}
+	return nil
+}
+
+// Values returns the existing values in the cache, the key is without the prefix.
+func (k *Kv) Values() map[string]string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	values := make(map[string]string, len(k.entries))
+	for key, e := range k.entries {
+		if e.exists {
+			values[key] = e.value
+		}
+	}
+	return values
+}
+
+// LoadValues loads the values into the cache without calling the hooks, the cached keys are not overridden.
+func (k *Kv) LoadValues(values map[string]string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for key, value := range values {
+		if _, ok := k.entries[key]; !ok {
+			k.entries[key] = &entry{value: value, exists: true}
+		}
+	}
+}
+
 // OnKeyChange registers a hook function to be called when the key changes.
 // the key removed from etcd will not trigger the hook.
 func (k *Kv) OnKeyChange(key string, hook func([]byte) error) bool {
 	key = k.cacheKey(key)
 
 	k.mu.Lock()
-	k.hooks[key] = append(k.hooks[key], hook)
+	k.hooks.OnKeyChange(key, hook)
+	k.mu.Unlock()
+
+	return true
+}
+
+// OnKeyEvent registers a hook function to be called when the key is created, updated or deleted.
+func (k *Kv) OnKeyEvent(key string, hook func(KeyEvent) error) bool {
+	key = k.cacheKey(key)
+
+	k.mu.Lock()
+	k.hooks.OnKeyEvent(key, hook)
+	k.mu.Unlock()
+
+	return true
+}
+
+// OnBatchEvent registers a hook function to be called once with all the changed keys of a watch response.
+func (k *Kv) OnBatchEvent(hook func([]KeyEvent) error) bool {
+	k.mu.Lock()
+	k.hooks.OnBatchEvent(hook)
+	k.mu.Unlock()
+
+	return true
+}
+
+// OnBatchPrepare registers a hook function to validate all the changed keys of a watch response before they are cached,
+// the changes are rejected and the previous values are kept if the hook returns an error.
+func (k *Kv) OnBatchPrepare(hook func([]KeyEvent) error) bool {
+	k.mu.Lock()
+	k.hooks.OnBatchPrepare(hook)
 	k.mu.Unlock()
 
 	return true
@@ -200,6 +334,106 @@ func (k *Kv) GetNoCache(ctx context.Context, key string) ([]byte, error) {
 	return rsp.Kvs[0].Value, nil
 }
 
+// List lists all the keys with the prefix from etcd without using the cache, ordered by key.
+// the keys of the result are without the prefix.
+func (k *Kv) List(ctx context.Context) ([]*mvccpb.KeyValue, error) {
+	rsp, err := k.client.Get(ctx, k.prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kv := range rsp.Kvs {
+		kv.Key = kv.Key[len(k.prefix):]
+	}
+	return rsp.Kvs, nil
+}
+
+// Entries returns the values served by Get ordered by key, the keys of the result are without the prefix.
+// the cached values are returned as they are, LIKE: the values not updated by the watch yet,
+// and the keys not cached are loaded from etcd, the keys cached as not exists are skipped.
+func (k *Kv) Entries(ctx context.Context) ([]*mvccpb.KeyValue, error) {
+	kvs, err := k.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	entries := kvs[:0]
+	listed := make(map[string]struct{}, len(kvs))
+	for _, kv := range kvs {
+		listed[strz.UnsafeString(kv.Key)] = struct{}{}
+
+		e, ok := k.entries[strz.UnsafeString(kv.Key)]
+		switch {
+		case !ok:
+		case !e.exists:
+			continue
+		case e.value != strz.UnsafeString(kv.Value):
+			kv.Value, kv.ModRevision = []byte(e.value), e.revision
+		}
+		entries = append(entries, kv)
+	}
+
+	// the cached keys deleted from etcd are still served until the watch removes them
+	for key, e := range k.entries {
+		if _, ok := listed[key]; !ok && e.exists {
+			entries = append(entries, &mvccpb.KeyValue{Key: []byte(key), Value: []byte(e.value), ModRevision: e.revision})
+		}
+	}
+	slices.SortFunc(entries, func(a, b *mvccpb.KeyValue) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
+
+	return entries, nil
+}
+
+// History returns at most limit changes of the key from the etcd revision history, ordered from old to new.
+// the history is read backward from the current value, and stops at the creation or the compacted revision.
+func (k *Kv) History(ctx context.Context, key string, limit int) ([]KeyEvent, error) {
+	realKey := k.etcdKey(key)
+	rsp, err := k.client.Get(ctx, realKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rsp.Kvs) == 0 {
+		return nil, nil
+	}
+
+	var events []KeyEvent
+	cur := rsp.Kvs[0]
+	for len(events) < limit {
+		ev := KeyEvent{Key: k.cacheKey(realKey), Type: KeyCreated, NewValue: cur.Value, Revision: cur.ModRevision}
+		if cur.Version <= 1 {
+			events = append(events, ev)
+			break
+		}
+
+		prev, err := k.client.Get(ctx, realKey, clientv3.WithRev(cur.ModRevision-1))
+		if err != nil {
+			if errors.Is(err, rpctypes.ErrCompacted) {
+				break
+			}
+			return nil, err
+		}
+
+		if len(prev.Kvs) == 0 {
+			events = append(events, ev)
+			break
+		}
+
+		ev.Type = KeyUpdated
+		ev.OldValue = prev.Kvs[0].Value
+		events = append(events, ev)
+		cur = prev.Kvs[0]
+	}
+
+	slices.Reverse(events)
+	return events, nil
+}
+
 // Len returns the number of entries in the cache.
 func (k *Kv) Len() int {
 	k.mu.RLock()
@@ -211,46 +445,99 @@ func (k *Kv) Len() int {
 
 // Handle handles the etcd event.
 func (k *Kv) Handle(event *clientv3.Event) {
-	switch event.Type {
-	case clientv3.EventTypePut:
-		var diff bool
+	k.HandleBatch([]*clientv3.Event{event})
+}
 
-		key := strz.UnsafeString(event.Kv.Key[len(k.prefix):])
-		k.mu.Lock()
-		e, ok := k.entries[key]
-		if !ok {
-			k.mu.Unlock()
-			return
-		}
+// HandleBatch handles the etcd events of a watch response.
+// the put of the key not cached is ignored unless the key has hooks or the Kv has batch hooks,
+// so that the hook registered on a not-yet-existing key is also called.
+// the batch hooks are called once with all the changed keys after the key hooks.
+func (k *Kv) HandleBatch(events []*clientv3.Event) {
+	_ = k.handle(events, false)
+}
 
-		if !e.exists || !bytes.Equal(strz.UnsafeBytes(e.value), event.Kv.Value) {
-			diff = true
-			e.value = string(event.Kv.Value)
-			e.exists = true
+// handle applies the events to the cache and calls the hooks of the changed keys,
+// the keys not cached are also applied if force is true.
+// if the Kv has prepare hooks, the changes are cached only if none of them returns an error,
+// the error is returned if the changes are rejected.
+func (k *Kv) handle(events []*clientv3.Event, force bool) error {
+	return k.hooks.Commit(&k.mu, k.logger, func() ([]KeyEvent, func()) {
+		changes, changed := k.diff(events, force || k.hooks.Batched())
+		return changed, func() {
+			for key, e := range changes {
+				k.entries[key] = e
+			}
 		}
-		k.mu.Unlock()
+	})
+}
 
-		if diff {
-			k.logger.Debugf("key %s changed", key)
+// diff applies the events to the copies of the entries, and returns the copies and the changed keys,
+// the copies should be put into the cache to commit the changes. it should be called with lock.
+// the key not cached is applied only if it has hooks or force is true.
+func (k *Kv) diff(events []*clientv3.Event, force bool) (map[string]*entry, []KeyEvent) {
+	var (
+		changes map[string]*entry
+		changed []KeyEvent
+	)
+
+	for _, event := range events {
+		if event.Type != clientv3.EventTypePut && event.Type != clientv3.EventTypeDelete {
+			continue
+		}
 
-			k.mu.RLock()
-			for _, hook := range k.hooks[key] {
-				if err := hook(event.Kv.Value); err != nil {
-					k.logger.Warnf("key %s hook failed: %s", key, err.Error())
+		key := string(event.Kv.Key[len(k.prefix):])
+		e, ok := changes[key]
+		if !ok {
+			cached, ok := k.entries[key]
+			switch {
+			case ok:
+				e = &entry{value: cached.value, exists: cached.exists, revision: cached.revision}
+			case force || k.hooks.Watched(key):
+				e = &entry{}
+				if event.PrevKv != nil {
+					// the key not cached but exists before the event
+					e.value, e.exists = string(event.PrevKv.Value), true
 				}
+			default:
+				continue
+			}
+
+			if changes == nil {
+				changes = make(map[string]*entry, len(events))
 			}
-			k.mu.RUnlock()
+			changes[key] = e
 		}
-	case clientv3.EventTypeDelete:
-		k.mu.Lock()
-		e, ok := k.entries[strz.UnsafeString(event.Kv.Key[len(k.prefix):])]
-		if ok {
+
+		ev := KeyEvent{Key: key, Revision: event.Kv.ModRevision}
+		if event.Type == clientv3.EventTypePut {
+			switch {
+			case !e.exists:
+				ev.Type = KeyCreated
+			case e.value != strz.UnsafeString(event.Kv.Value):
+				ev.Type = KeyUpdated
+				ev.OldValue = []byte(e.value)
+			}
+
+			if ev.Type != 0 {
+				ev.NewValue = event.Kv.Value
+				e.value = string(event.Kv.Value)
+				e.exists = true
+				e.revision = event.Kv.ModRevision
+			}
+		} else if e.exists {
+			ev.Type = KeyDeleted
+			ev.OldValue = []byte(e.value)
 			e.value = ""
 			e.exists = false
+			e.revision = event.Kv.ModRevision
+		}
+
+		if ev.Type != 0 {
+			changed = append(changed, ev)
 		}
-		k.mu.Unlock()
-	default:
 	}
+
+	return changes, changed
 }
 
 // getStringFromCache gets the value of the key from the cache.
@@ -2,12 +2,14 @@ package etcdutil
 
 import (
 	"context"
+	"errors"
 	"slices"
 	"strings"
 	"testing"
 
 	"github.com/welllog/golib/testz"
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -293,3 +295,186 @@ func (t *testKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, e
 func (t *testKV) Txn(ctx context.Context) clientv3.Txn {
 	panic("implement me")
 }
+
+func TestKv_List(t *testing.T) {
+	tkv := initTestKv()
+	c := clientv3.Client{
+		KV: tkv,
+	}
+
+	kv := NewKv("/v1/", &c)
+	kvs, err := kv.List(context.Background())
+	testz.Nil(t, err)
+
+	keys := make([]string, 0, len(kvs))
+	for _, v := range kvs {
+		keys = append(keys, string(v.Key))
+	}
+	slices.Sort(keys)
+	testz.Equal(t, []string{"bar", "baz", "baz/1", "foo"}, keys)
+}
+
+func TestKv_Entries(t *testing.T) {
+	tkv := initTestKv()
+	c := clientv3.Client{
+		KV: tkv,
+	}
+
+	ctx := context.Background()
+	kv := NewKv("/v1/", &c)
+	kv.LoadValues(map[string]string{"foo": "cached", "removed": "x"})
+	_, err := kv.Get(ctx, "bar")
+	testz.Nil(t, err)
+
+	// the changes not applied to the cache yet
+	tkv.Put(ctx, "/v1/bar", "changed")
+	tkv.Put(ctx, "/v1/qux", "new")
+	tkv.Delete(ctx, "/v1/baz")
+	_, err = kv.Get(ctx, "baz")
+	testz.Equal(t, ErrNotFound, err)
+	tkv.Put(ctx, "/v1/baz", "demo3")
+
+	entries, err := kv.Entries(ctx)
+	testz.Nil(t, err)
+
+	values := make([]string, 0, len(entries))
+	for _, e := range entries {
+		values = append(values, string(e.Key)+"="+string(e.Value))
+	}
+	testz.Equal(t, []string{"bar=demo2", "baz/1=demo4", "foo=cached", "qux=new", "removed=x"}, values)
+
+	for _, e := range entries {
+		v, err := kv.GetString(ctx, string(e.Key))
+		testz.Nil(t, err)
+		testz.Equal(t, v, string(e.Value))
+	}
+}
+
+func TestKv_Reconcile(t *testing.T) {
+	tkv := initTestKv()
+	c := clientv3.Client{
+		KV: tkv,
+	}
+
+	kv := NewKv("/v1/", &c)
+	kv.LoadValues(map[string]string{"foo": "old", "removed": "x"})
+
+	var events []KeyEvent
+	kv.OnKeyEvent("foo", func(ev KeyEvent) error {
+		events = append(events, ev)
+		return nil
+	})
+	kv.OnKeyEvent("removed", func(ev KeyEvent) error {
+		events = append(events, ev)
+		return nil
+	})
+
+	err := kv.Reconcile(context.Background())
+	testz.Nil(t, err)
+
+	slices.SortFunc(events, func(a, b KeyEvent) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	testz.Equal(t, 2, len(events))
+	testz.Equal(t, KeyUpdated, events[0].Type)
+	testz.Equal(t, "demo1", string(events[0].NewValue))
+	testz.Equal(t, KeyDeleted, events[1].Type)
+
+	values := kv.Values()
+	testz.Equal(t, 4, len(values))
+	testz.Equal(t, "demo3", values["baz"])
+}
+
+func TestKv_Reconcile_Rejected(t *testing.T) {
+	tkv := initTestKv()
+	c := clientv3.Client{
+		KV: tkv,
+	}
+
+	kv := NewKv("/v1/", &c)
+	kv.LoadValues(map[string]string{"foo": "old"})
+
+	var batches int
+	kv.OnBatchPrepare(func([]KeyEvent) error {
+		return errors.New("invalid")
+	})
+	kv.OnBatchEvent(func([]KeyEvent) error {
+		batches++
+		return nil
+	})
+
+	err := kv.Reconcile(context.Background())
+	testz.Equal(t, true, err != nil)
+	testz.Equal(t, 0, batches)
+	testz.Equal(t, map[string]string{"foo": "old"}, kv.Values())
+}
+
+// historyKV keeps all the versions of the keys, and the revisions before compacted are not readable.
+type historyKV struct {
+	*testKV
+	versions  map[string][]*mvccpb.KeyValue
+	compacted int64
+}
+
+func (h *historyKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	var op clientv3.Op
+	for _, opt := range opts {
+		opt(&op)
+	}
+
+	rev := op.Rev()
+	if rev > 0 && rev <= h.compacted {
+		return nil, rpctypes.ErrCompacted
+	}
+
+	var ret clientv3.GetResponse
+	versions := h.versions[key]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if rev == 0 || versions[i].ModRevision <= rev {
+			ret.Kvs = append(ret.Kvs, versions[i])
+			break
+		}
+	}
+	return &ret, nil
+}
+
+func TestKv_History(t *testing.T) {
+	hkv := historyKV{versions: map[string][]*mvccpb.KeyValue{
+		"/v1/foo": {
+			{Key: []byte("/v1/foo"), Value: []byte("v1"), ModRevision: 2, Version: 1},
+			{Key: []byte("/v1/foo"), Value: []byte("v2"), ModRevision: 5, Version: 2},
+			{Key: []byte("/v1/foo"), Value: []byte("v3"), ModRevision: 9, Version: 3},
+		},
+	}}
+	c := clientv3.Client{
+		KV: &hkv,
+	}
+
+	kv := NewKv("/v1/", &c)
+	ctx := context.Background()
+	events, err := kv.History(ctx, "foo", 10)
+	testz.Nil(t, err)
+	testz.Equal(t, 3, len(events))
+	testz.Equal(t, KeyCreated, events[0].Type)
+	testz.Equal(t, "v1", string(events[0].NewValue))
+	testz.Equal(t, KeyUpdated, events[2].Type)
+	testz.Equal(t, "v2", string(events[2].OldValue))
+	testz.Equal(t, "v3", string(events[2].NewValue))
+	testz.Equal(t, int64(9), events[2].Revision)
+
+	events, err = kv.History(ctx, "foo", 1)
+	testz.Nil(t, err)
+	testz.Equal(t, 1, len(events))
+	testz.Equal(t, int64(9), events[0].Revision)
+
+	// the history stops at the change whose previous value has been compacted
+	hkv.compacted = 4
+	events, err = kv.History(ctx, "foo", 10)
+	testz.Nil(t, err)
+	testz.Equal(t, 1, len(events))
+	testz.Equal(t, int64(9), events[0].Revision)
+
+	events, err = kv.History(ctx, "none", 10)
+	testz.Nil(t, err)
+	testz.Equal(t, 0, len(events))
+}
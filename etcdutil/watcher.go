@@ -17,6 +17,12 @@ type Observer interface {
 	Handle(event *clientv3.Event)
 }
 
+// BatchObserver is the Observer that handles all the events of a watch response at once.
+type BatchObserver interface {
+	Observer
+	HandleBatch(events []*clientv3.Event)
+}
+
 type Watcher struct {
 	client             *clientv3.Client
 	observers          []Observer
@@ -100,31 +106,50 @@ func (w *Watcher) watch(ctx context.Context, prefix string) {
 	w.wg.Done()
 
 	for ret := range ch {
-		for _, ev := range ret.Events {
-			if ev.Type != clientv3.EventTypePut && ev.Type != clientv3.EventTypeDelete {
-				continue
-			}
+		for _, obs := range w.observers {
+			var events []*clientv3.Event
+			for _, ev := range ret.Events {
+				if ev.Type != clientv3.EventTypePut && ev.Type != clientv3.EventTypeDelete {
+					continue
+				}
 
-			key := strz.UnsafeString(ev.Kv.Key)
-			w.logger.Debugf("key %s %s", key, ev.Type.String())
-			for _, obs := range w.observers {
+				key := strz.UnsafeString(ev.Kv.Key)
 				if strings.HasPrefix(key, obs.Prefix()) {
-					w.logger.Debugf("key %s %s", key, obs.Prefix())
-					func() {
-						defer func() {
-							if r := recover(); r != nil {
-								w.logger.Errorf("observer.Handle panic: %v", r)
-							}
-						}()
-						obs.Handle(ev)
-					}()
+					w.logger.Debugf("key %s %s %s", key, ev.Type.String(), obs.Prefix())
+					events = append(events, ev)
 				}
 			}
+
+			if len(events) > 0 {
+				w.notify(obs, events)
+			}
 		}
 	}
 	w.logger.Warnf("watch etcd key prefix: %s stopped", prefix)
 }
 
+// notify sends the events to the observer, the BatchObserver receives the events at once.
+func (w *Watcher) notify(obs Observer, events []*clientv3.Event) {
+	if bo, ok := obs.(BatchObserver); ok {
+		w.safeHandle(func() { bo.HandleBatch(events) })
+		return
+	}
+
+	for _, ev := range events {
+		w.safeHandle(func() { obs.Handle(ev) })
+	}
+}
+
+func (w *Watcher) safeHandle(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.logger.Errorf("observer.Handle panic: %v", r)
+		}
+	}()
+
+	fn()
+}
+
 func commonPrefix(s1, s2 string, commonSize int) string {
 	var prefix string
 	for i := 0; ; i++ {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -60,6 +61,197 @@ func TestKv_Handle(t *testing.T) {
 	testz.Equal(t, ErrNotFound, err)
 }
 
+func TestKv_OnKeyEvent(t *testing.T) {
+	tkv := initTestKv()
+	twt := testWatcher{}
+	c := clientv3.Client{
+		KV:      tkv,
+		Watcher: &twt,
+	}
+
+	kv := NewKv("/v1/", &c)
+	watcher := NewWatcher(&c)
+	watcher.Attach(kv)
+	ctx := context.Background()
+	watcher.Run(ctx)
+
+	var (
+		mu     sync.Mutex
+		events []KeyEvent
+		values []string
+	)
+	kv.OnKeyEvent("new", func(ev KeyEvent) error {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+		return nil
+	})
+	kv.OnKeyChange("new", func(b []byte) error {
+		mu.Lock()
+		values = append(values, string(b))
+		mu.Unlock()
+		return nil
+	})
+
+	twt.notifyCreate("/v1/new", "v1")
+	time.Sleep(time.Millisecond)
+	twt.notifyCreate("/v1/new", "v2")
+	time.Sleep(time.Millisecond)
+	twt.notifyDel("/v1/new")
+	time.Sleep(time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	testz.Equal(t, 3, len(events))
+	testz.Equal(t, KeyCreated, events[0].Type)
+	testz.Equal(t, "v1", string(events[0].NewValue))
+	testz.Equal(t, KeyUpdated, events[1].Type)
+	testz.Equal(t, "v1", string(events[1].OldValue))
+	testz.Equal(t, "v2", string(events[1].NewValue))
+	testz.Equal(t, KeyDeleted, events[2].Type)
+	testz.Equal(t, "v2", string(events[2].OldValue))
+	testz.Equal(t, []string{"v1", "v2"}, values)
+}
+
+func TestKv_OnBatchEvent(t *testing.T) {
+	tkv := initTestKv()
+	twt := testWatcher{}
+	c := clientv3.Client{
+		KV:      tkv,
+		Watcher: &twt,
+	}
+
+	kv := NewKv("/v1/", &c)
+	watcher := NewWatcher(&c)
+	watcher.Attach(kv)
+	ctx := context.Background()
+	watcher.Run(ctx)
+
+	var (
+		mu      sync.Mutex
+		batches [][]KeyEvent
+	)
+	kv.OnBatchEvent(func(events []KeyEvent) error {
+		mu.Lock()
+		batches = append(batches, events)
+		mu.Unlock()
+		return nil
+	})
+
+	twt.notify("/v1/", clientv3.WatchResponse{
+		Events: []*clientv3.Event{
+			{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/v1/user"), Value: []byte("root")}},
+			{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/v1/password"), Value: []byte("secret")}},
+		},
+	})
+	time.Sleep(time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	testz.Equal(t, 1, len(batches))
+	testz.Equal(t, 2, len(batches[0]))
+	testz.Equal(t, "user", batches[0][0].Key)
+	testz.Equal(t, KeyCreated, batches[0][0].Type)
+	testz.Equal(t, "password", batches[0][1].Key)
+	testz.Equal(t, "secret", string(batches[0][1].NewValue))
+}
+
+func TestKv_OnBatchPrepare(t *testing.T) {
+	tkv := initTestKv()
+	twt := testWatcher{}
+	c := clientv3.Client{
+		KV:      tkv,
+		Watcher: &twt,
+	}
+
+	kv := NewKv("/v1/", &c)
+	watcher := NewWatcher(&c)
+	watcher.Attach(kv)
+	ctx := context.Background()
+	watcher.Run(ctx)
+
+	kv.OnBatchPrepare(func(events []KeyEvent) error {
+		for _, ev := range events {
+			if string(ev.NewValue) == "bad" {
+				return fmt.Errorf("key %s invalid", ev.Key)
+			}
+		}
+		return nil
+	})
+
+	var changed atomic.Int32
+	kv.OnKeyChange("foo", func(b []byte) error {
+		changed.Add(1)
+		return nil
+	})
+
+	// the valid foo is rejected together with the invalid bar
+	twt.notify("/v1/", clientv3.WatchResponse{
+		Events: []*clientv3.Event{
+			{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/v1/foo"), Value: []byte("demo10")}},
+			{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/v1/bar"), Value: []byte("bad")}},
+		},
+	})
+	time.Sleep(time.Millisecond)
+
+	val, err := kv.GetString(ctx, "foo")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo1", val)
+	testz.Equal(t, int32(0), changed.Load())
+
+	twt.notifyCreate("/v1/foo", "demo10")
+	time.Sleep(time.Millisecond)
+
+	val, err = kv.GetString(ctx, "foo")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo10", val)
+	testz.Equal(t, int32(1), changed.Load())
+}
+
+func TestKv_OnBatchPrepare_CacheChanged(t *testing.T) {
+	tkv := initTestKv()
+	c := clientv3.Client{
+		KV: tkv,
+	}
+
+	ctx := context.Background()
+	kv := NewKv("/v1/", &c)
+
+	var prepared [][]KeyEvent
+	kv.OnBatchPrepare(func(events []KeyEvent) error {
+		prepared = append(prepared, events)
+		if len(prepared) == 1 {
+			// the key is cached by Get while the changes are validated
+			_, err := kv.Get(ctx, "bar")
+			testz.Nil(t, err)
+		}
+		return nil
+	})
+
+	var batches [][]KeyEvent
+	kv.OnBatchEvent(func(events []KeyEvent) error {
+		batches = append(batches, events)
+		return nil
+	})
+
+	kv.HandleBatch([]*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/v1/bar"), Value: []byte("demo10")}},
+	})
+
+	// the changes are validated again on the cache changed by Get
+	testz.Equal(t, 2, len(prepared))
+	testz.Equal(t, KeyCreated, prepared[0][0].Type)
+	testz.Equal(t, KeyUpdated, prepared[1][0].Type)
+
+	testz.Equal(t, 1, len(batches))
+	testz.Equal(t, KeyUpdated, batches[0][0].Type)
+	testz.Equal(t, "demo2", string(batches[0][0].OldValue))
+
+	val, err := kv.GetString(ctx, "bar")
+	testz.Nil(t, err)
+	testz.Equal(t, "demo10", val)
+}
+
 func TestWatcher_SetCommonPrefixMinLen(t *testing.T) {
 	twt := testWatcher{}
 	c := clientv3.Client{
@@ -152,6 +344,16 @@ func (t *testWatcher) notifyDel(key string) {
 	}
 }
 
+func (t *testWatcher) notify(key string, wrsp clientv3.WatchResponse) {
+	t.mu.RLock()
+	for _, v := range t.chs {
+		if strings.HasPrefix(key, v.key) {
+			v.ch <- wrsp
+		}
+	}
+	t.mu.RUnlock()
+}
+
 func (t *testWatcher) RequestProgress(ctx context.Context) error {
 	panic("implement me")
 }
@@ -0,0 +1,146 @@
+// Package keyhook dispatches the changes of a key cache to the hooks registered on it,
+// it is shared by the config drivers which cache the keys of a remote source, LIKE: etcd, consul and http.
+package keyhook
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/welllog/golt/contract"
+)
+
+// Events reads the events of type E.
+type Events[E any] struct {
+	// Key returns the changed key of the event.
+	Key func(E) string
+	// Value returns the new value of the event, false if the key is deleted.
+	Value func(E) ([]byte, bool)
+	// Same reports whether the events change the key in the same way.
+	Same func(a, b E) bool
+}
+
+// Hooks is the hooks registered on the keys of a cache, it is guarded by the lock of the cache.
+type Hooks[E any] struct {
+	// name is the cache in the logs, LIKE: prefix /v1/app/
+	name    string
+	events  Events[E]
+	change  map[string][]func([]byte) error
+	event   map[string][]func(E) error
+	batch   []func([]E) error
+	prepare []func([]E) error
+}
+
+func New[E any](name string, events Events[E]) *Hooks[E] {
+	return &Hooks[E]{
+		name:   name,
+		events: events,
+		change: make(map[string][]func([]byte) error),
+		event:  make(map[string][]func(E) error),
+	}
+}
+
+// OnKeyChange registers a hook to be called with the new value when the key is created or updated.
+func (h *Hooks[E]) OnKeyChange(key string, hook func([]byte) error) {
+	h.change[key] = append(h.change[key], hook)
+}
+
+// OnKeyEvent registers a hook to be called when the key is created, updated or deleted.
+func (h *Hooks[E]) OnKeyEvent(key string, hook func(E) error) {
+	h.event[key] = append(h.event[key], hook)
+}
+
+// OnBatchEvent registers a hook to be called once with all the changed keys of a commit.
+func (h *Hooks[E]) OnBatchEvent(hook func([]E) error) {
+	h.batch = append(h.batch, hook)
+}
+
+// OnBatchPrepare registers a hook to validate all the changed keys before they are committed,
+// the changes are rejected if the hook returns an error.
+func (h *Hooks[E]) OnBatchPrepare(hook func([]E) error) {
+	h.prepare = append(h.prepare, hook)
+}
+
+// Watched reports whether the key has hooks.
+func (h *Hooks[E]) Watched(key string) bool {
+	return len(h.change[key]) > 0 || len(h.event[key]) > 0
+}
+
+// Batched reports whether the cache has batch or prepare hooks, they need the changes of all the keys.
+func (h *Hooks[E]) Batched() bool {
+	return len(h.batch) > 0 || len(h.prepare) > 0
+}
+
+// Commit validates the changes by the prepare hooks, commits them and calls the hooks of the changed keys.
+// diff returns the changed keys and the function to commit them into the cache, both are called with mu locked.
+// the error of the prepare hooks is returned if the changes are rejected, the cache is kept unchanged.
+func (h *Hooks[E]) Commit(mu sync.Locker, logger contract.Logger, diff func() ([]E, func())) error {
+	type call struct {
+		event      E
+		hooks      []func([]byte) error
+		eventHooks []func(E) error
+	}
+
+	mu.Lock()
+	batch, prepare := h.batch, h.prepare
+	changed, commit := diff()
+
+	// the prepare hooks are called without lock, so that the hooks can read the cache.
+	// the cache may be changed meanwhile, LIKE: a key cached by Get, so the diff is recomputed after the hooks,
+	// and validated again if it is not the same as the validated one.
+	for len(changed) > 0 && len(prepare) > 0 {
+		mu.Unlock()
+		for _, hook := range prepare {
+			if err := hook(changed); err != nil {
+				logger.Errorf("%s reload rejected, keep the previous values: %s", h.name, err.Error())
+				return err
+			}
+		}
+		mu.Lock()
+
+		validated := changed
+		changed, commit = diff()
+		if slices.EqualFunc(validated, changed, h.events.Same) {
+			break
+		}
+	}
+
+	commit()
+	calls := make([]call, 0, len(changed))
+	for _, ev := range changed {
+		key := h.events.Key(ev)
+		calls = append(calls, call{event: ev, hooks: h.change[key], eventHooks: h.event[key]})
+	}
+	mu.Unlock()
+
+	// hooks are called without lock, so that the hooks can read the cache or register new hooks,
+	// the key removed only triggers the event hooks
+	for _, c := range calls {
+		key := h.events.Key(c.event)
+		logger.Debugf("key %s changed", key)
+
+		if value, ok := h.events.Value(c.event); ok {
+			for _, hook := range c.hooks {
+				if err := hook(value); err != nil {
+					logger.Warnf("key %s hook failed: %s", key, err.Error())
+				}
+			}
+		}
+
+		for _, hook := range c.eventHooks {
+			if err := hook(c.event); err != nil {
+				logger.Warnf("key %s event hook failed: %s", key, err.Error())
+			}
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	for _, hook := range batch {
+		if err := hook(changed); err != nil {
+			logger.Warnf("%s batch hook failed: %s", h.name, err.Error())
+		}
+	}
+	return nil
+}